@@ -7,13 +7,16 @@
 package agent
 
 import (
-	"encoding/json"
+	"bufio"
+	"crypto/tls"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
@@ -24,13 +27,26 @@ import (
 	"github.com/nakabonne/gosivy/stats"
 )
 
-const defaultAddr = "127.0.0.1:0"
+const (
+	defaultAddr = "127.0.0.1:0"
+	// How long to wait for the next request.
+	readTimeout = 5 * time.Second
+)
 
 var (
-	mu        sync.Mutex
-	pidFile   string
-	listener  net.Listener
-	logWriter io.Writer
+	mu       sync.Mutex
+	pidFile  string
+	listener net.Listener
+	// The directory holding the Unix domain socket, empty if not in the Unix socket mode.
+	socketDir string
+	// The HTTP server serving the Prometheus endpoint, nil if not enabled.
+	prometheusServer *http.Server
+	// The samples kept before the diagnoser attaches, nil if not enabled.
+	hist *history
+	// Samples the gauges between the scrapes, nil if disabled.
+	smp *sampler
+
+	collector = stats.NewCollector()
 )
 
 // Options is optional settings for the started agent.
@@ -42,6 +58,75 @@ type Options struct {
 
 	// Where to emit the log to. By default ioutil.Discard is used.
 	LogWriter io.Writer
+
+	// Whether to include all numeric variables published via the expvar
+	// package in the stats. Note that the "memstats" variable is excluded
+	// because it stops the world.
+	Expvar bool
+
+	// Paths to the PEM encoded certificate and private key.
+	// If given, the agent serves over TLS.
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// Path to the PEM encoded CA certificates to verify the client certificates.
+	// If given, the diagnoser is required to present a certificate signed by one
+	// of them, that is, mutual TLS is enabled. It requires TLSCertFile and TLSKeyFile.
+	TLSClientCAFile string
+
+	// Whether to listen on a Unix domain socket in the config directory
+	// instead of a TCP port. The socket is accessible only by the owner
+	// of the process, so no TCP port is exposed. It can't be used along with Addr.
+	UnixSocket bool
+
+	// The shared secret the diagnoser is required to present in the handshake
+	// before any statistics are served. Connections failing to authenticate are
+	// rejected and logged to LogWriter. Note that the legacy protocol is refused
+	// since it can't authenticate. It should be combined with TLS when the agent
+	// is exposed to the network, otherwise the token is sent in clear text.
+	Token string
+
+	// The address to also serve the stats on the /metrics endpoint in the
+	// Prometheus text format, in the form of "host:port". All runtime/metrics
+	// are served as well. If empty, the endpoint isn't served.
+	// The TLS settings apply to it too, and the token is required as a bearer token.
+	PrometheusAddr string
+
+	// The number of samples to keep in memory, so that the diagnoser attaching
+	// later can draw what happened before it. If zero, no sample is kept.
+	HistorySize int
+
+	// How often the samples are kept. By default one second is populated.
+	HistoryInterval time.Duration
+
+	// How often the gauges such as the number of goroutines and the heap
+	// are sampled between the scrapes, so that the short spikes are reported
+	// as the ranges of the values. By default 100ms is populated.
+	// They are sampled only while a diagnoser is attached, and not at all if negative.
+	SampleInterval time.Duration
+}
+
+// config is the settings of the listening agent, which are captured once
+// Listen succeeds and handed to the connections, so that the later calls
+// can't change them underneath.
+type config struct {
+	logWriter io.Writer
+	// Whether to report the expvar variables.
+	exposeExpvar bool
+	// The shared secret the diagnoser must present. Empty means no authentication.
+	token string
+}
+
+func newConfig(opts Options) *config {
+	cfg := &config{
+		logWriter:    opts.LogWriter,
+		exposeExpvar: opts.Expvar,
+		token:        opts.Token,
+	}
+	if cfg.logWriter == nil {
+		cfg.logWriter = ioutil.Discard
+	}
+	return cfg
 }
 
 // Listen starts the gosivy agent that serves the process statistics.
@@ -49,19 +134,29 @@ type Options struct {
 // It automatically cleans up resources if the running process receives an interrupt.
 //
 // Note that the agent exposes an endpoint via a TCP connection that
-// can be used by any program on the system.
+// can be used by any program on the system, unless mutual TLS, a token or
+// a Unix domain socket is used.
 func Listen(opts Options) error {
 	mu.Lock()
 	defer mu.Unlock()
-	logWriter = opts.LogWriter
-	if logWriter == nil {
-		logWriter = ioutil.Discard
-	}
 
 	if pidFile != "" {
 		return fmt.Errorf("gosivy agent already listening at: %v", listener.Addr())
 	}
 
+	if opts.UnixSocket && opts.Addr != "" {
+		return fmt.Errorf("the address can't be given in the Unix socket mode")
+	}
+	if opts.HistorySize < 0 || opts.HistoryInterval < 0 {
+		return fmt.Errorf("the history size and interval can't be negative")
+	}
+	tlsConfig, err := newTLSConfig(opts)
+	if err != nil {
+		return fmt.Errorf("invalid TLS settings: %w", err)
+	}
+
+	cfg := newConfig(opts)
+
 	cfgDir, err := process.ConfigDir()
 	if err != nil {
 		return err
@@ -72,32 +167,123 @@ func Listen(opts Options) error {
 	}
 	gracefulShutdown()
 
-	addr := opts.Addr
-	if addr == "" {
-		addr = defaultAddr
-	}
-	ln, err := net.Listen("tcp", addr)
+	ln, target, err := newListener(opts)
 	if err != nil {
 		return err
 	}
+	if tlsConfig != nil {
+		ln = tls.NewListener(ln, tlsConfig)
+	}
 	listener = ln
-	port := listener.Addr().(*net.TCPAddr).Port
+	if opts.PrometheusAddr != "" {
+		if err := servePrometheus(opts.PrometheusAddr, tlsConfig, cfg); err != nil {
+			closeAgent()
+			return fmt.Errorf("failed to serve the Prometheus endpoint: %w", err)
+		}
+	}
 	pidFile = fmt.Sprintf("%s/%d", cfgDir, os.Getpid())
-	err = ioutil.WriteFile(pidFile, []byte(strconv.Itoa(port)), os.ModePerm)
+	err = ioutil.WriteFile(pidFile, []byte(target), os.ModePerm)
 	if err != nil {
+		closeAgent()
 		return err
 	}
 
-	go listen()
+	if opts.SampleInterval >= 0 {
+		interval := opts.SampleInterval
+		if interval == 0 {
+			interval = defaultSampleInterval
+		}
+		smp = newSampler()
+		go smp.run(interval)
+	}
+	if opts.HistorySize > 0 {
+		interval := opts.HistoryInterval
+		if interval == 0 {
+			interval = defaultHistoryInterval
+		}
+		hist = newHistory(opts.HistorySize)
+		go hist.run(interval, cfg)
+	}
+
+	go listen(ln, cfg)
 	return nil
 }
 
-// Close closes the agent, removing temporary files and closing the TCP listener.
+// servePrometheus starts serving the Prometheus endpoint in the background.
+func servePrometheus(addr string, tlsConfig *tls.Config, cfg *config) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	if tlsConfig != nil {
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+	mux := http.NewServeMux()
+	mux.Handle(prometheusPath, prometheusHandler(cfg))
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: readTimeout}
+	prometheusServer = srv
+	go func() {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			fmt.Fprintf(cfg.logWriter, "gosivy: %v\n", err)
+		}
+	}()
+	return nil
+}
+
+// newListener listens on a TCP port or a Unix domain socket, and gives back
+// the listener along with the target written into the pid file, which is
+// either the port number or the path to the socket.
+func newListener(opts Options) (net.Listener, string, error) {
+	if !opts.UnixSocket {
+		addr := opts.Addr
+		if addr == "" {
+			addr = defaultAddr
+		}
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			return nil, "", err
+		}
+		return ln, strconv.Itoa(ln.Addr().(*net.TCPAddr).Port), nil
+	}
+
+	path, err := process.SocketFile(os.Getpid())
+	if err != nil {
+		return nil, "", err
+	}
+	// Remove the socket left by the process with the same pid that didn't clean up.
+	dir := filepath.Dir(path)
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, "", err
+	}
+	// The socket is created with the permission given by the umask,
+	// so keep the others out of the directory before listening.
+	if err := os.Mkdir(dir, 0700); err != nil {
+		return nil, "", err
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		os.Remove(dir)
+		return nil, "", err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		ln.Close()
+		os.Remove(dir)
+		return nil, "", err
+	}
+	socketDir = dir
+	return ln, path, nil
+}
+
+// Close closes the agent, removing temporary files and closing the listener.
 // If no agent is listening, Close does nothing.
 func Close() {
 	mu.Lock()
 	defer mu.Unlock()
+	closeAgent()
+}
 
+// closeAgent releases whatever the agent holds. The caller must hold mu.
+func closeAgent() {
 	if pidFile != "" {
 		os.Remove(pidFile)
 		pidFile = ""
@@ -105,6 +291,22 @@ func Close() {
 	if listener != nil {
 		listener.Close()
 	}
+	if socketDir != "" {
+		os.RemoveAll(socketDir)
+		socketDir = ""
+	}
+	if prometheusServer != nil {
+		prometheusServer.Close()
+		prometheusServer = nil
+	}
+	if hist != nil {
+		hist.stop()
+		hist = nil
+	}
+	if smp != nil {
+		smp.stop()
+		smp = nil
+	}
 }
 
 // gracefulShutdown enables to automatically clean up resources if the
@@ -124,64 +326,46 @@ func gracefulShutdown() {
 	}()
 }
 
-func listen() {
+func listen(ln net.Listener, cfg *config) {
 	for {
-		conn, err := listener.Accept()
+		conn, err := ln.Accept()
 		if err != nil {
 			// TODO: Use net.ErrClosed after upgrading Go1.16, see: https://golang.org/issues/4373.
 			if !strings.Contains(err.Error(), "use of closed network connection") {
-				fmt.Fprintf(logWriter, "gosivy: %v\n", err)
+				fmt.Fprintf(cfg.logWriter, "gosivy: %v\n", err)
 			}
 			if netErr, ok := err.(net.Error); ok && !netErr.Temporary() {
 				break
 			}
 			continue
 		}
-		fmt.Fprintf(logWriter, "gosivy: accept %v\n", conn.RemoteAddr())
+		fmt.Fprintf(cfg.logWriter, "gosivy: accept %v\n", conn.RemoteAddr())
 		go func() {
-			if err := handle(conn); err != nil {
-				fmt.Fprintf(logWriter, "gosivy: %v\n", err)
+			if err := handle(conn, cfg); err != nil {
+				fmt.Fprintf(cfg.logWriter, "gosivy: %v\n", err)
 			}
 		}()
 	}
 }
 
 // handle keeps using the given connection until an issue occurred.
-func handle(conn net.Conn) error {
+// It speaks the framed protocol if the first frame is a handshake,
+// otherwise the legacy single-byte protocol unless a token is required.
+func handle(conn net.Conn, cfg *config) error {
 	defer conn.Close()
-	for {
-		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
-		sig := make([]byte, 1)
-		if _, err := conn.Read(sig); err != nil {
-			return err
-		}
-		switch sig[0] {
-		case stats.SignalMeta:
-			meta, err := stats.NewMeta()
-			if err != nil {
-				return err
-			}
-			b, err := json.Marshal(meta)
-			if err != nil {
-				return err
-			}
-			if _, err := conn.Write(append(b, stats.Delimiter)); err != nil {
-				return err
-			}
-		case stats.SignalStats:
-			s, err := stats.NewStats()
-			if err != nil {
-				return err
-			}
-			b, err := json.Marshal(s)
-			if err != nil {
-				return err
-			}
-			if _, err := conn.Write(append(b, stats.Delimiter)); err != nil {
-				return err
-			}
-		default:
-			return fmt.Errorf("unknown signal received: %b", sig[0])
-		}
+	reader := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(readTimeout))
+	first, err := reader.Peek(1)
+	if err != nil {
+		return err
+	}
+	s := newSession(cfg)
+	defer s.close()
+	if first[0] == stats.SignalHandshake {
+		return s.handleFramed(conn, reader)
+	}
+	if cfg.token != "" {
+		return fmt.Errorf("rejected unauthenticated connection from %v: legacy protocol can't authenticate", conn.RemoteAddr())
 	}
+	return s.handleLegacy(conn, reader)
 }
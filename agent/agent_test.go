@@ -1,10 +1,20 @@
 package agent
 
 import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net"
 	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/nakabonne/gosivy/process"
+	"github.com/nakabonne/gosivy/stats"
 )
 
 func TestListenAndClose(t *testing.T) {
@@ -16,3 +26,254 @@ func TestListenAndClose(t *testing.T) {
 	assert.True(t, os.IsNotExist(err))
 	assert.Empty(t, pidFile)
 }
+
+func TestListenUnixSocket(t *testing.T) {
+	os.Setenv(process.ConfigDirEnvKey, t.TempDir())
+	defer os.Unsetenv(process.ConfigDirEnvKey)
+
+	err := Listen(Options{UnixSocket: true})
+	assert.Nil(t, err)
+	path, err := process.SocketFile(os.Getpid())
+	assert.Nil(t, err)
+	info, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	addr, err := process.GetAddr(os.Getpid())
+	assert.Nil(t, err)
+	assert.Equal(t, &net.UnixAddr{Name: path, Net: "unix"}, addr)
+
+	dir, err := os.Stat(filepath.Dir(path))
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0700), dir.Mode().Perm())
+
+	Close()
+	_, err = os.Stat(filepath.Dir(path))
+	assert.True(t, os.IsNotExist(err))
+
+	err = Listen(Options{UnixSocket: true, Addr: ":9090"})
+	assert.NotNil(t, err)
+}
+
+func TestListenUnwindsOnError(t *testing.T) {
+	cfgDir := t.TempDir()
+	os.Setenv(process.ConfigDirEnvKey, cfgDir)
+	defer os.Unsetenv(process.ConfigDirEnvKey)
+
+	// The socket is removed along with its directory.
+	err := Listen(Options{UnixSocket: true, PrometheusAddr: "invalid"})
+	assert.NotNil(t, err)
+	assert.Empty(t, pidFile)
+	assert.Empty(t, socketDir)
+	path, err := process.SocketFile(os.Getpid())
+	assert.Nil(t, err)
+	_, err = os.Stat(filepath.Dir(path))
+	assert.True(t, os.IsNotExist(err))
+
+	// Failing to write the pid file stops the listeners.
+	assert.Nil(t, os.Mkdir(filepath.Join(cfgDir, strconv.Itoa(os.Getpid())), 0700))
+	err = Listen(Options{Addr: "127.0.0.1:0", PrometheusAddr: "127.0.0.1:0"})
+	assert.NotNil(t, err)
+	assert.Empty(t, pidFile)
+	assert.Nil(t, prometheusServer)
+	_, err = net.Dial("tcp", listener.Addr().String())
+	assert.NotNil(t, err)
+}
+
+func TestListenTwice(t *testing.T) {
+	os.Setenv(process.ConfigDirEnvKey, t.TempDir())
+	defer os.Unsetenv(process.ConfigDirEnvKey)
+
+	err := Listen(Options{Addr: "127.0.0.1:0", Token: "secret"})
+	assert.Nil(t, err)
+	defer Close()
+	// The failed call leaves the settings of the running agent as they are.
+	err = Listen(Options{Addr: "127.0.0.1:0", Token: "other"})
+	assert.NotNil(t, err)
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	assert.Nil(t, err)
+	defer conn.Close()
+	b, _ := json.Marshal(&stats.Hello{Version: stats.ProtocolVersion, Token: "secret"})
+	assert.Nil(t, stats.WriteFrame(conn, stats.SignalHandshake, b))
+	typ, _, err := stats.ReadFrame(conn)
+	assert.Nil(t, err)
+	assert.Equal(t, stats.SignalHandshake, typ)
+}
+
+func TestListenWithInvalidTLS(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{
+			name: "cert without key",
+			opts: Options{TLSCertFile: "cert.pem"},
+		},
+		{
+			name: "client CA without cert",
+			opts: Options{TLSClientCAFile: "ca.pem"},
+		},
+		{
+			name: "missing files",
+			opts: Options{TLSCertFile: "not-exist.pem", TLSKeyFile: "not-exist-key.pem"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Listen(tt.opts)
+			assert.NotNil(t, err)
+			assert.Empty(t, pidFile)
+		})
+	}
+}
+
+func TestHandleMetrics(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	go handle(server, &config{logWriter: ioutil.Discard})
+
+	_, err := client.Write(append([]byte{stats.SignalMetrics}, `["/gc/heap/goal:bytes","/sched/latencies:seconds"]`+"\n"...))
+	assert.Nil(t, err)
+	res, err := bufio.NewReader(client).ReadBytes(stats.Delimiter)
+	assert.Nil(t, err)
+
+	var got stats.Metrics
+	assert.Nil(t, json.Unmarshal(res, &got))
+	assert.Equal(t, stats.MetricKindUint64, got["/gc/heap/goal:bytes"].Kind)
+	assert.Equal(t, stats.MetricKindHistogram, got["/sched/latencies:seconds"].Kind)
+}
+
+func TestHandleFramed(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	go handle(server, &config{logWriter: ioutil.Discard})
+
+	// Handshake
+	b, _ := json.Marshal(&stats.Hello{Version: stats.ProtocolVersion + 1})
+	assert.Nil(t, stats.WriteFrame(client, stats.SignalHandshake, b))
+	typ, res, err := stats.ReadFrame(client)
+	assert.Nil(t, err)
+	assert.Equal(t, stats.SignalHandshake, typ)
+	var hello stats.Hello
+	assert.Nil(t, json.Unmarshal(res, &hello))
+	assert.Equal(t, stats.ProtocolVersion, hello.Version)
+	assert.Contains(t, hello.Signals, stats.SignalStats)
+
+	// Unknown signal is replied with an error without closing the connection.
+	assert.Nil(t, stats.WriteFrame(client, 0x7f, nil))
+	typ, res, err = stats.ReadFrame(client)
+	assert.Nil(t, err)
+	assert.Equal(t, stats.FrameError, typ)
+	var reply stats.ErrorReply
+	assert.Nil(t, json.Unmarshal(res, &reply))
+	assert.Equal(t, stats.ErrorCodeUnknownSignal, reply.Code)
+
+	assert.Nil(t, stats.WriteFrame(client, stats.SignalStats, nil))
+	typ, res, err = stats.ReadFrame(client)
+	assert.Nil(t, err)
+	assert.Equal(t, stats.SignalStats, typ)
+	var s stats.Stats
+	assert.Nil(t, json.Unmarshal(res, &s))
+	assert.NotZero(t, s.Goroutines)
+}
+
+func TestHandleFramedUnsupportedVersion(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	go handle(server, &config{logWriter: ioutil.Discard})
+
+	b, _ := json.Marshal(&stats.Hello{Version: 0})
+	assert.Nil(t, stats.WriteFrame(client, stats.SignalHandshake, b))
+	typ, res, err := stats.ReadFrame(client)
+	assert.Nil(t, err)
+	assert.Equal(t, stats.FrameError, typ)
+	var reply stats.ErrorReply
+	assert.Nil(t, json.Unmarshal(res, &reply))
+	assert.Equal(t, stats.ErrorCodeUnsupportedVersion, reply.Code)
+}
+
+func TestHandleWithToken(t *testing.T) {
+	cfg := &config{logWriter: ioutil.Discard, token: "secret"}
+
+	tests := []struct {
+		name     string
+		token    string
+		wantCode stats.ErrorCode
+	}{
+		{
+			name:  "right token",
+			token: "secret",
+		},
+		{
+			name:     "wrong token",
+			token:    "wrong",
+			wantCode: stats.ErrorCodeUnauthorized,
+		},
+		{
+			name:     "no token",
+			wantCode: stats.ErrorCodeUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, client := net.Pipe()
+			defer client.Close()
+			errCh := make(chan error, 1)
+			go func() { errCh <- handle(server, cfg) }()
+
+			b, _ := json.Marshal(&stats.Hello{Version: stats.ProtocolVersion, Token: tt.token})
+			assert.Nil(t, stats.WriteFrame(client, stats.SignalHandshake, b))
+			typ, res, err := stats.ReadFrame(client)
+			assert.Nil(t, err)
+			if tt.wantCode == 0 {
+				assert.Equal(t, stats.SignalHandshake, typ)
+				return
+			}
+			assert.Equal(t, stats.FrameError, typ)
+			var reply stats.ErrorReply
+			assert.Nil(t, json.Unmarshal(res, &reply))
+			assert.Equal(t, tt.wantCode, reply.Code)
+			assert.Contains(t, (<-errCh).Error(), "rejected unauthenticated connection")
+		})
+	}
+}
+
+func TestHandleLegacyWithToken(t *testing.T) {
+	cfg := &config{logWriter: ioutil.Discard, token: "secret"}
+
+	server, client := net.Pipe()
+	defer client.Close()
+	errCh := make(chan error, 1)
+	go func() { errCh <- handle(server, cfg) }()
+
+	_, err := client.Write([]byte{stats.SignalStats})
+	assert.Nil(t, err)
+	assert.Contains(t, (<-errCh).Error(), "legacy protocol can't authenticate")
+	_, err = bufio.NewReader(client).ReadBytes(stats.Delimiter)
+	assert.NotNil(t, err)
+}
+
+func TestNewSessionSchedLatencies(t *testing.T) {
+	// Schedules goroutines before the session starts.
+	var wg sync.WaitGroup
+	for i := 0; i < 1000; i++ {
+		wg.Add(1)
+		go wg.Done()
+	}
+	wg.Wait()
+
+	s := newSession(&config{})
+	defer s.close()
+	assert.NotNil(t, s.prevSchedLatencies)
+
+	// The first sample holds only what happened since the session started.
+	st, err := s.newStats()
+	assert.Nil(t, err)
+	sum := func(h *stats.Histogram) (n uint64) {
+		for _, c := range h.Counts {
+			n += c
+		}
+		return n
+	}
+	assert.Less(t, sum(st.SchedLatencies), sum(stats.NewSchedLatencies()))
+}
@@ -0,0 +1,106 @@
+package agent
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/nakabonne/gosivy/stats"
+)
+
+// customMetric is an application-specific metric registered on the agent.
+type customMetric struct {
+	stats.CustomMetric
+	value func() float64
+}
+
+var (
+	customMu sync.RWMutex
+	// Registered custom metrics in the order of registration.
+	customMetrics []customMetric
+)
+
+// RegisterGauge registers an application-specific metric which represents
+// a single value that can arbitrarily go up and down, such as queue depth
+// or the number of open DB connections. The given function is called every
+// time the diagnoser scrapes the stats, thus it must be safe for concurrent use.
+// The value is left out of the sample if it panics.
+//
+// Metrics must be registered before the diagnoser attaches
+// in order to be discovered by it.
+func RegisterGauge(name string, f func() float64) error {
+	return registerCustomMetric(name, stats.CustomMetricGauge, f)
+}
+
+// RegisterCounter registers an application-specific metric which represents
+// a cumulative value that only goes up, such as the number of cache hits.
+// The diagnoser draws its rate per second. The given function is called every
+// time the diagnoser scrapes the stats, thus it must be safe for concurrent use.
+// The value is left out of the sample if it panics.
+//
+// Metrics must be registered before the diagnoser attaches
+// in order to be discovered by it.
+func RegisterCounter(name string, f func() float64) error {
+	return registerCustomMetric(name, stats.CustomMetricCounter, f)
+}
+
+func registerCustomMetric(name string, kind stats.CustomMetricKind, f func() float64) error {
+	if name == "" {
+		return fmt.Errorf("metric name must not be empty")
+	}
+	if f == nil {
+		return fmt.Errorf("function to get the value of %q must not be nil", name)
+	}
+	customMu.Lock()
+	defer customMu.Unlock()
+	for _, m := range customMetrics {
+		if m.Name == name {
+			return fmt.Errorf("metric %q already registered", name)
+		}
+	}
+	customMetrics = append(customMetrics, customMetric{
+		CustomMetric: stats.CustomMetric{Name: name, Kind: kind},
+		value:        f,
+	})
+	return nil
+}
+
+// customMetricsMeta gives back the definitions of all registered custom metrics.
+func customMetricsMeta() []stats.CustomMetric {
+	customMu.RLock()
+	defer customMu.RUnlock()
+	ms := make([]stats.CustomMetric, 0, len(customMetrics))
+	for _, m := range customMetrics {
+		ms = append(ms, m.CustomMetric)
+	}
+	return ms
+}
+
+// customMetricsValues gives back the current values of all registered custom metrics.
+// The metrics whose function panics are logged and left out.
+func customMetricsValues(logWriter io.Writer) map[string]float64 {
+	// Don't hold the lock while calling the functions, which may take long.
+	customMu.RLock()
+	ms := make([]customMetric, len(customMetrics))
+	copy(ms, customMetrics)
+	customMu.RUnlock()
+
+	values := make(map[string]float64, len(ms))
+	for _, m := range ms {
+		if v, ok := m.call(logWriter); ok {
+			values[m.Name] = v
+		}
+	}
+	return values
+}
+
+// call gives back the current value, or false if the function panics.
+func (m *customMetric) call(logWriter io.Writer) (v float64, ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Fprintf(logWriter, "gosivy: skipped the metric %q since its function panicked: %v\n", m.Name, r)
+			ok = false
+		}
+	}()
+	return m.value(), true
+}
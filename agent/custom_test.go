@@ -0,0 +1,83 @@
+package agent
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/nakabonne/gosivy/stats"
+)
+
+func TestRegisterCustomMetric(t *testing.T) {
+	defer func() { customMetrics = nil }()
+
+	tests := []struct {
+		name     string
+		register func() error
+		wantErr  bool
+	}{
+		{
+			name: "gauge",
+			register: func() error {
+				return RegisterGauge("queue-depth", func() float64 { return 1 })
+			},
+			wantErr: false,
+		},
+		{
+			name: "counter",
+			register: func() error {
+				return RegisterCounter("cache-hits", func() float64 { return 2 })
+			},
+			wantErr: false,
+		},
+		{
+			name: "duplicated name",
+			register: func() error {
+				return RegisterGauge("queue-depth", func() float64 { return 3 })
+			},
+			wantErr: true,
+		},
+		{
+			name: "empty name",
+			register: func() error {
+				return RegisterGauge("", func() float64 { return 4 })
+			},
+			wantErr: true,
+		},
+		{
+			name: "nil function",
+			register: func() error {
+				return RegisterCounter("conns", nil)
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.register()
+			assert.Equal(t, tt.wantErr, err != nil)
+		})
+	}
+
+	assert.Equal(t, []stats.CustomMetric{
+		{Name: "queue-depth", Kind: stats.CustomMetricGauge},
+		{Name: "cache-hits", Kind: stats.CustomMetricCounter},
+	}, customMetricsMeta())
+	assert.Equal(t, map[string]float64{
+		"queue-depth": 1,
+		"cache-hits":  2,
+	}, customMetricsValues(ioutil.Discard))
+}
+
+func TestCustomMetricsValuesRecoversPanic(t *testing.T) {
+	defer func() { customMetrics = nil }()
+	assert.Nil(t, RegisterGauge("broken", func() float64 { panic("oops") }))
+	assert.Nil(t, RegisterGauge("queue-depth", func() float64 { return 1 }))
+
+	var log bytes.Buffer
+	assert.Equal(t, map[string]float64{"queue-depth": 1}, customMetricsValues(&log))
+	assert.Contains(t, log.String(), `"broken"`)
+	assert.Contains(t, log.String(), "oops")
+}
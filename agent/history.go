@@ -0,0 +1,84 @@
+package agent
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nakabonne/gosivy/stats"
+)
+
+const defaultHistoryInterval = time.Second
+
+// history keeps the latest samples taken on its own ticker in a ring buffer,
+// so that the diagnoser attaching later can draw what happened before.
+type history struct {
+	mu      sync.Mutex
+	samples []*stats.Stats
+	times   []time.Time
+	// The index of the slot to be written next.
+	next int
+	// Whether all slots are written.
+	full bool
+	done chan struct{}
+}
+
+func newHistory(size int) *history {
+	return &history{
+		samples: make([]*stats.Stats, size),
+		times:   make([]time.Time, size),
+		done:    make(chan struct{}),
+	}
+}
+
+// run keeps sampling at the given interval until stop is called.
+func (h *history) run(interval time.Duration, cfg *config) {
+	// Keeps the scheduler latencies per interval as the sessions do, but not
+	// the ranges, so that the sampler stays parked until a diagnoser attaches.
+	s := &session{cfg: cfg, prevSchedLatencies: stats.NewSchedLatencies()}
+	defer s.close()
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-h.done:
+			return
+		case now := <-tick.C:
+			st, err := s.newStats()
+			if err != nil {
+				fmt.Fprintf(cfg.logWriter, "gosivy: %v\n", err)
+				continue
+			}
+			h.add(now, st)
+		}
+	}
+}
+
+func (h *history) stop() {
+	close(h.done)
+}
+
+// add overwrites the oldest sample with the given one if full.
+func (h *history) add(t time.Time, st *stats.Stats) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.samples[h.next] = st
+	h.times[h.next] = t
+	h.next++
+	if h.next == len(h.samples) {
+		h.next = 0
+		h.full = true
+	}
+}
+
+// snapshot gives back the samples kept so far from the oldest.
+func (h *history) snapshot() ([]time.Time, []*stats.Stats) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.full {
+		return append([]time.Time{}, h.times[:h.next]...), append([]*stats.Stats{}, h.samples[:h.next]...)
+	}
+	times := append(append([]time.Time{}, h.times[h.next:]...), h.times[:h.next]...)
+	samples := append(append([]*stats.Stats{}, h.samples[h.next:]...), h.samples[:h.next]...)
+	return times, samples
+}
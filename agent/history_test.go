@@ -0,0 +1,108 @@
+package agent
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/nakabonne/gosivy/stats"
+)
+
+func TestHistorySnapshot(t *testing.T) {
+	tests := []struct {
+		name string
+		size int
+		// The number of samples added.
+		added int
+		want  []int
+	}{
+		{
+			name:  "empty",
+			size:  3,
+			added: 0,
+			want:  []int{},
+		},
+		{
+			name:  "not full",
+			size:  3,
+			added: 2,
+			want:  []int{0, 1},
+		},
+		{
+			name:  "just full",
+			size:  3,
+			added: 3,
+			want:  []int{0, 1, 2},
+		},
+		{
+			name:  "wrapped around",
+			size:  3,
+			added: 5,
+			want:  []int{2, 3, 4},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHistory(tt.size)
+			base := time.Now()
+			for i := 0; i < tt.added; i++ {
+				h.add(base.Add(time.Duration(i)*time.Second), &stats.Stats{Goroutines: i})
+			}
+			times, samples := h.snapshot()
+			assert.Len(t, times, len(tt.want))
+			got := make([]int, 0, len(samples))
+			for i, s := range samples {
+				got = append(got, s.Goroutines)
+				assert.Equal(t, base.Add(time.Duration(s.Goroutines)*time.Second), times[i])
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestServeHistory(t *testing.T) {
+	mu.Lock()
+	hist = newHistory(2)
+	mu.Unlock()
+	defer func() {
+		mu.Lock()
+		hist = nil
+		mu.Unlock()
+	}()
+	now := time.Now()
+	hist.add(now, &stats.Stats{Goroutines: 1})
+
+	s := &session{encoding: stats.EncodingBinary}
+	b, err := s.serve(stats.SignalHistory, nil)
+	assert.Nil(t, err)
+	records, err := stats.DecodeTimedBatch(stats.EncodingBinary, b)
+	assert.Nil(t, err)
+	assert.Len(t, records, 1)
+	assert.True(t, now.Equal(records[0].Time))
+	assert.Equal(t, 1, records[0].Stats.Goroutines)
+}
+
+func TestHistoryLeavesSamplerParked(t *testing.T) {
+	mu.Lock()
+	smp = newSampler()
+	mu.Unlock()
+	defer func() {
+		mu.Lock()
+		smp.stop()
+		smp = nil
+		mu.Unlock()
+	}()
+
+	h := newHistory(2)
+	go h.run(time.Millisecond, &config{logWriter: ioutil.Discard})
+	defer h.stop()
+	assert.Eventually(t, func() bool {
+		times, _ := h.snapshot()
+		return len(times) > 0
+	}, time.Second, time.Millisecond)
+	smp.mu.Lock()
+	defer smp.mu.Unlock()
+	assert.Empty(t, smp.accs)
+}
@@ -0,0 +1,51 @@
+package agent
+
+import (
+	"bytes"
+	"fmt"
+	"runtime/pprof"
+	"time"
+
+	"github.com/nakabonne/gosivy/stats"
+)
+
+// captureProfile captures the requested profile in the pprof format.
+// Note that the mutex and block profiles are empty unless the application
+// enables them by runtime.SetMutexProfileFraction and runtime.SetBlockProfileRate.
+func captureProfile(req *stats.ProfileRequest) ([]byte, error) {
+	var buf bytes.Buffer
+	switch req.Name {
+	case stats.ProfileCPU:
+		if req.Duration <= 0 || req.Duration > stats.MaxCaptureDuration {
+			return nil, &stats.ErrorReply{Code: stats.ErrorCodeBadRequest, Message: fmt.Sprintf("duration must be in (0, %v]: %v", stats.MaxCaptureDuration, req.Duration)}
+		}
+		if err := pprof.StartCPUProfile(&buf); err != nil {
+			return nil, fmt.Errorf("failed to start CPU profile: %w", err)
+		}
+		time.Sleep(req.Duration)
+		pprof.StopCPUProfile()
+	case stats.ProfileHeap, stats.ProfileAllocs, stats.ProfileMutex, stats.ProfileBlock, stats.ProfileGoroutine:
+		if err := pprof.Lookup(req.Name).WriteTo(&buf, 0); err != nil {
+			return nil, fmt.Errorf("failed to write %s profile: %w", req.Name, err)
+		}
+	default:
+		return nil, &stats.ErrorReply{Code: stats.ErrorCodeBadRequest, Message: fmt.Sprintf("unknown profile: %q", req.Name)}
+	}
+	if buf.Len() > stats.MaxFrameSize {
+		return nil, fmt.Errorf("%s profile too large: %d bytes", req.Name, buf.Len())
+	}
+	return buf.Bytes(), nil
+}
+
+// dumpGoroutines gives back the stacks of all goroutines grouped by stack,
+// in the debug=1 text format of the goroutine profile.
+func dumpGoroutines() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := pprof.Lookup(stats.ProfileGoroutine).WriteTo(&buf, 1); err != nil {
+		return nil, fmt.Errorf("failed to dump goroutines: %w", err)
+	}
+	if buf.Len() > stats.MaxFrameSize {
+		return nil, fmt.Errorf("goroutine dump too large: %d bytes", buf.Len())
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,69 @@
+package agent
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/nakabonne/gosivy/stats"
+)
+
+func TestCaptureProfile(t *testing.T) {
+	tests := []struct {
+		name     string
+		req      stats.ProfileRequest
+		wantCode stats.ErrorCode
+	}{
+		{
+			name: "cpu",
+			req:  stats.ProfileRequest{Name: stats.ProfileCPU, Duration: 10 * time.Millisecond},
+		},
+		{
+			name: "heap",
+			req:  stats.ProfileRequest{Name: stats.ProfileHeap},
+		},
+		{
+			name: "goroutine",
+			req:  stats.ProfileRequest{Name: stats.ProfileGoroutine},
+		},
+		{
+			name:     "cpu without duration",
+			req:      stats.ProfileRequest{Name: stats.ProfileCPU},
+			wantCode: stats.ErrorCodeBadRequest,
+		},
+		{
+			name:     "cpu for too long",
+			req:      stats.ProfileRequest{Name: stats.ProfileCPU, Duration: time.Hour},
+			wantCode: stats.ErrorCodeBadRequest,
+		},
+		{
+			name:     "unknown profile",
+			req:      stats.ProfileRequest{Name: "threadcreate"},
+			wantCode: stats.ErrorCodeBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := captureProfile(&tt.req)
+			if tt.wantCode != 0 {
+				var reply *stats.ErrorReply
+				assert.True(t, errors.As(err, &reply))
+				assert.Equal(t, tt.wantCode, reply.Code)
+				return
+			}
+			assert.Nil(t, err)
+			// The profile is gzip-compressed.
+			assert.Equal(t, []byte{0x1f, 0x8b}, b[:2])
+		})
+	}
+}
+
+func TestDumpGoroutines(t *testing.T) {
+	b, err := dumpGoroutines()
+	assert.Nil(t, err)
+	groups, err := stats.ParseGoroutineDump(b)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, groups)
+}
@@ -0,0 +1,235 @@
+package agent
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"runtime/metrics"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/nakabonne/gosivy/stats"
+)
+
+const (
+	prometheusPath      = "/metrics"
+	prometheusNamespace = "gosivy"
+	// The content type of the Prometheus text-based exposition format.
+	prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+	// The prefix of the Authorization header carrying the token.
+	bearerScheme = "Bearer "
+)
+
+// prometheusHandler gives back the handler serving the stats in the Prometheus text format.
+// The token is required as a bearer token if set.
+func prometheusHandler(cfg *config) http.HandlerFunc {
+	// The metrics dropped so far, which are logged only once.
+	var dropped sync.Map
+	return func(w http.ResponseWriter, r *http.Request) {
+		if cfg.token != "" {
+			auth := r.Header.Get("Authorization")
+			if !strings.HasPrefix(auth, bearerScheme) || subtle.ConstantTimeCompare([]byte(auth[len(bearerScheme):]), []byte(cfg.token)) != 1 {
+				fmt.Fprintf(cfg.logWriter, "gosivy: rejected unauthenticated request from %v\n", r.RemoteAddr)
+				http.Error(w, "authentication failed", http.StatusUnauthorized)
+				return
+			}
+		}
+		st, err := stats.NewStats()
+		if err != nil {
+			fmt.Fprintf(cfg.logWriter, "gosivy: %v\n", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		st.CustomMetrics = customMetricsValues(cfg.logWriter)
+		if cfg.exposeExpvar {
+			st.Expvars = stats.NewExpvars()
+		}
+		w.Header().Set("Content-Type", prometheusContentType)
+		bw := bufio.NewWriter(w)
+		for _, name := range writePrometheus(bw, st, customMetricsMeta(), collector.Read()) {
+			if _, ok := dropped.LoadOrStore(name, true); !ok {
+				fmt.Fprintf(cfg.logWriter, "gosivy: dropped %q from the Prometheus metrics since its name collides with another\n", name)
+			}
+		}
+		bw.Flush()
+	}
+}
+
+// prometheusWriter writes metrics in the Prometheus text format,
+// skipping the ones whose name is already written.
+type prometheusWriter struct {
+	w    io.Writer
+	seen map[string]bool
+	// The names of the metrics skipped, before sanitized.
+	dropped []string
+}
+
+// writePrometheus writes the given stats along with all runtime metrics,
+// and gives back the names of the ones dropped since their names collide with others.
+func writePrometheus(w io.Writer, st *stats.Stats, custom []stats.CustomMetric, runtimeMetrics stats.Metrics) []string {
+	p := &prometheusWriter{w: w, seen: make(map[string]bool)}
+
+	p.gauge("goroutines", "The number of goroutines that currently exist.", float64(st.Goroutines))
+	p.gauge("cpu_usage_percent", "How many percent of the CPU time the process uses.", st.CPUUsage)
+
+	m := &st.MemStats
+	p.gauge("memstats_sys_bytes", "Total bytes of memory obtained from the OS.", float64(m.Sys))
+	p.gauge("memstats_heap_alloc_bytes", "Bytes of allocated heap objects.", float64(m.HeapAlloc))
+	p.gauge("memstats_heap_sys_bytes", "Bytes of heap memory obtained from the OS.", float64(m.HeapSys))
+	p.gauge("memstats_heap_idle_bytes", "Bytes in idle (unused) spans.", float64(m.HeapIdle))
+	p.gauge("memstats_heap_inuse_bytes", "Bytes in in-use spans.", float64(m.HeapInuse))
+	p.gauge("memstats_heap_released_bytes", "Bytes of physical memory returned to the OS.", float64(m.HeapReleased))
+	p.gauge("memstats_heap_objects", "The number of allocated heap objects.", float64(m.HeapObjects))
+	p.gauge("memstats_stack_inuse_bytes", "Bytes in stack spans.", float64(m.StackInuse))
+	p.gauge("memstats_mspan_inuse_bytes", "Bytes of allocated mspan structures.", float64(m.MSpanInuse))
+	p.gauge("memstats_mcache_inuse_bytes", "Bytes of allocated mcache structures.", float64(m.MCacheInuse))
+	p.counter("memstats_mallocs_total", "Cumulative count of heap objects allocated.", float64(m.Mallocs))
+	p.counter("memstats_frees_total", "Cumulative count of heap objects freed.", float64(m.Frees))
+	p.counter("memstats_alloc_bytes_total", "Cumulative bytes allocated for heap objects.", float64(m.TotalAlloc))
+	p.gauge("memstats_next_gc_bytes", "The target heap size of the next GC cycle.", float64(m.NextGC))
+
+	gc := &st.GCStats
+	p.counter("gc_cycles_total", "The number of completed GC cycles.", float64(gc.NumGC))
+	p.counter("gc_pause_seconds_total", "Cumulative seconds in GC stop-the-world pauses.", float64(gc.PauseTotalNs)/1e9)
+	p.gauge("gc_last_timestamp_seconds", "The time the last GC cycle finished, as seconds since the Unix epoch.", float64(gc.LastGC)/1e9)
+	p.gauge("gc_cpu_fraction", "The fraction of the available CPU time used by the GC since the process started.", gc.GCCPUFraction)
+
+	for _, c := range custom {
+		v, ok := st.CustomMetrics[c.Name]
+		if !ok {
+			continue
+		}
+		help := fmt.Sprintf("Application-specific metric %q.", c.Name)
+		if c.Kind == stats.CustomMetricCounter {
+			p.counter("custom_"+c.Name, help, v)
+		} else {
+			p.gauge("custom_"+c.Name, help, v)
+		}
+	}
+	for _, name := range sortedKeys(st.Expvars) {
+		p.gauge("expvar_"+name, fmt.Sprintf("Variable %q published via expvar.", name), st.Expvars[name])
+	}
+
+	for _, d := range metrics.All() {
+		rm, ok := runtimeMetrics[d.Name]
+		if !ok {
+			continue
+		}
+		name := "runtime_" + d.Name
+		help := d.Description
+		switch rm.Kind {
+		case stats.MetricKindUint64, stats.MetricKindFloat64:
+			v := float64(rm.Uint64)
+			if rm.Kind == stats.MetricKindFloat64 {
+				v = rm.Float64
+			}
+			if d.Cumulative {
+				p.counter(name+"_total", help, v)
+			} else {
+				p.gauge(name, help, v)
+			}
+		case stats.MetricKindHistogram:
+			p.histogram(name, help, rm.Histogram)
+		}
+	}
+	return p.dropped
+}
+
+// header writes the help and type of the metric, and then gives back the full name.
+// It gives back an empty string if the name is already written.
+func (p *prometheusWriter) header(name, help, typ string) string {
+	full := prometheusNamespace + "_" + sanitizeMetricName(name)
+	if p.seen[full] {
+		p.dropped = append(p.dropped, name)
+		return ""
+	}
+	p.seen[full] = true
+	fmt.Fprintf(p.w, "# HELP %s %s\n# TYPE %s %s\n", full, escapeHelp(help), full, typ)
+	return full
+}
+
+func (p *prometheusWriter) gauge(name, help string, v float64) {
+	if name = p.header(name, help, "gauge"); name != "" {
+		fmt.Fprintf(p.w, "%s %s\n", name, formatFloat(v))
+	}
+}
+
+func (p *prometheusWriter) counter(name, help string, v float64) {
+	if name = p.header(name, help, "counter"); name != "" {
+		fmt.Fprintf(p.w, "%s %s\n", name, formatFloat(v))
+	}
+}
+
+// histogram writes the given distribution with the cumulative counts per upper bound.
+// The sum is left out since the distribution doesn't hold it.
+func (p *prometheusWriter) histogram(name, help string, h *stats.Histogram) {
+	if h == nil || len(h.Buckets) != len(h.Counts)+1 {
+		return
+	}
+	if name = p.header(name, help, "histogram"); name == "" {
+		return
+	}
+	var count uint64
+	for i, c := range h.Counts {
+		count += c
+		upper := h.Buckets[i+1]
+		if upper == math.MaxFloat64 {
+			// The infinite bound is written below.
+			continue
+		}
+		fmt.Fprintf(p.w, "%s_bucket{le=\"%s\"} %d\n", name, formatFloat(upper), count)
+	}
+	fmt.Fprintf(p.w, "%s_bucket{le=\"+Inf\"} %d\n", name, count)
+	fmt.Fprintf(p.w, "%s_count %d\n", name, count)
+}
+
+// sanitizeMetricName replaces the characters not allowed in metric names with underscores,
+// e.g. "/gc/heap/allocs:bytes" is converted into "gc_heap_allocs_bytes".
+func sanitizeMetricName(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	// Squeeze the underscores for readability.
+	s := b.String()
+	for strings.Contains(s, "__") {
+		s = strings.ReplaceAll(s, "__", "_")
+	}
+	return strings.Trim(s, "_")
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
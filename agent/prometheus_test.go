@@ -0,0 +1,209 @@
+package agent
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/nakabonne/gosivy/stats"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	st := &stats.Stats{
+		Goroutines: 8,
+		CPUUsage:   12.5,
+		CustomMetrics: map[string]float64{
+			"queue-depth": 3,
+			"cache-hits":  10,
+		},
+		Expvars: map[string]float64{"requests": 42},
+	}
+	st.MemStats.HeapAlloc = 1024
+	st.GCStats.PauseTotalNs = 1500000000
+	custom := []stats.CustomMetric{
+		{Name: "queue-depth", Kind: stats.CustomMetricGauge},
+		{Name: "cache-hits", Kind: stats.CustomMetricCounter},
+	}
+	runtimeMetrics := stats.Metrics{
+		"/sched/goroutines:goroutines": {Kind: stats.MetricKindUint64, Uint64: 8},
+		"/gc/cycles/total:gc-cycles":   {Kind: stats.MetricKindUint64, Uint64: 5},
+		"/sched/latencies:seconds": {
+			Kind: stats.MetricKindHistogram,
+			Histogram: &stats.Histogram{
+				Counts:  []uint64{1, 2, 3},
+				Buckets: []float64{0, 0.5, 1, math.MaxFloat64},
+			},
+		},
+	}
+
+	var b bytes.Buffer
+	dropped := writePrometheus(&b, st, custom, runtimeMetrics)
+	assert.Empty(t, dropped)
+	got := b.String()
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{
+			name: "gauge",
+			want: "# TYPE gosivy_goroutines gauge\ngosivy_goroutines 8\n",
+		},
+		{
+			name: "float",
+			want: "gosivy_cpu_usage_percent 12.5\n",
+		},
+		{
+			name: "memstats",
+			want: "gosivy_memstats_heap_alloc_bytes 1024\n",
+		},
+		{
+			name: "gc pause in seconds",
+			want: "# TYPE gosivy_gc_pause_seconds_total counter\ngosivy_gc_pause_seconds_total 1.5\n",
+		},
+		{
+			name: "custom gauge",
+			want: "# TYPE gosivy_custom_queue_depth gauge\ngosivy_custom_queue_depth 3\n",
+		},
+		{
+			name: "custom counter",
+			want: "# TYPE gosivy_custom_cache_hits counter\ngosivy_custom_cache_hits 10\n",
+		},
+		{
+			name: "expvar",
+			want: "gosivy_expvar_requests 42\n",
+		},
+		{
+			name: "runtime gauge",
+			want: "# TYPE gosivy_runtime_sched_goroutines_goroutines gauge\ngosivy_runtime_sched_goroutines_goroutines 8\n",
+		},
+		{
+			name: "runtime counter",
+			want: "# TYPE gosivy_runtime_gc_cycles_total_gc_cycles_total counter\ngosivy_runtime_gc_cycles_total_gc_cycles_total 5\n",
+		},
+		{
+			name: "runtime histogram",
+			want: "# TYPE gosivy_runtime_sched_latencies_seconds histogram\n" +
+				"gosivy_runtime_sched_latencies_seconds_bucket{le=\"0.5\"} 1\n" +
+				"gosivy_runtime_sched_latencies_seconds_bucket{le=\"1\"} 3\n" +
+				"gosivy_runtime_sched_latencies_seconds_bucket{le=\"+Inf\"} 6\n" +
+				"gosivy_runtime_sched_latencies_seconds_count 6\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Contains(t, got, tt.want)
+		})
+	}
+}
+
+func TestSanitizeMetricName(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "valid",
+			in:   "heap_alloc",
+			want: "heap_alloc",
+		},
+		{
+			name: "runtime metric",
+			in:   "/gc/heap/allocs:bytes",
+			want: "gc_heap_allocs_bytes",
+		},
+		{
+			name: "consecutive invalid characters",
+			in:   "cache--hits.",
+			want: "cache_hits",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, sanitizeMetricName(tt.in))
+		})
+	}
+}
+
+func TestPrometheusHandlerWithToken(t *testing.T) {
+	handler := prometheusHandler(&config{logWriter: ioutil.Discard, token: "secret"})
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantCode      int
+	}{
+		{
+			name:          "right token",
+			authorization: "Bearer secret",
+			wantCode:      http.StatusOK,
+		},
+		{
+			name:          "wrong token",
+			authorization: "Bearer wrong",
+			wantCode:      http.StatusUnauthorized,
+		},
+		{
+			name:          "token without scheme",
+			authorization: "secret",
+			wantCode:      http.StatusUnauthorized,
+		},
+		{
+			name:     "no token",
+			wantCode: http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, prometheusPath, nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+			assert.Equal(t, tt.wantCode, rec.Code)
+			if tt.wantCode == http.StatusOK {
+				assert.Equal(t, prometheusContentType, rec.Header().Get("Content-Type"))
+				assert.Contains(t, rec.Body.String(), "gosivy_goroutines ")
+			}
+		})
+	}
+}
+
+func TestPrometheusHandlerLogsDroppedMetrics(t *testing.T) {
+	defer func() { customMetrics = nil }()
+	assert.Nil(t, RegisterGauge("queue-depth", func() float64 { return 1 }))
+	// Sanitized into the same name as the above.
+	assert.Nil(t, RegisterGauge("queue_depth", func() float64 { return 2 }))
+
+	var log bytes.Buffer
+	handler := prometheusHandler(&config{logWriter: &log})
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, prometheusPath, nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, 1, strings.Count(rec.Body.String(), "# TYPE gosivy_custom_queue_depth "))
+	}
+	// Logged only once.
+	assert.Equal(t, 1, strings.Count(log.String(), `"custom_queue_depth"`))
+}
+
+func TestListenWithPrometheus(t *testing.T) {
+	err := Listen(Options{PrometheusAddr: "127.0.0.1:0"})
+	assert.Nil(t, err)
+	assert.NotNil(t, prometheusServer)
+	Close()
+	assert.Nil(t, prometheusServer)
+
+	err = Listen(Options{PrometheusAddr: "invalid"})
+	assert.NotNil(t, err)
+	assert.Empty(t, pidFile)
+	Close()
+}
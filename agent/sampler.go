@@ -0,0 +1,178 @@
+package agent
+
+import (
+	"sync"
+	"time"
+
+	"github.com/nakabonne/gosivy/stats"
+)
+
+const defaultSampleInterval = 100 * time.Millisecond
+
+// sampler samples the gauges at a higher frequency than the scrapes,
+// and feeds them to the accumulators of the sessions, so that the short
+// spikes between the scrapes aren't missed. The ticker is parked while
+// no accumulator is registered, so that the idle agent never wakes up.
+type sampler struct {
+	mu   sync.Mutex
+	accs map[*rangeAccumulator]struct{}
+	done chan struct{}
+	// Wakes the parked sampler up on registration.
+	wake chan struct{}
+	// Takes a sample of the gauges.
+	sample func() map[string]float64
+}
+
+func newSampler() *sampler {
+	return &sampler{
+		accs:   make(map[*rangeAccumulator]struct{}),
+		done:   make(chan struct{}),
+		wake:   make(chan struct{}, 1),
+		sample: stats.SampleGauges,
+	}
+}
+
+// run keeps sampling at the given interval while any accumulator is registered,
+// until stop is called.
+func (s *sampler) run(interval time.Duration) {
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.wake:
+		}
+		if !s.sampleWhileRegistered(interval) {
+			return
+		}
+	}
+}
+
+// sampleWhileRegistered keeps sampling until no accumulator is registered,
+// and tells if it's still running.
+func (s *sampler) sampleWhileRegistered(interval time.Duration) bool {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-s.done:
+			return false
+		case <-tick.C:
+			s.mu.Lock()
+			idle := len(s.accs) == 0
+			s.mu.Unlock()
+			// Nothing would be fed while no diagnoser is attached.
+			if idle {
+				return true
+			}
+			values := s.sample()
+			s.mu.Lock()
+			for acc := range s.accs {
+				acc.add(values)
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+func (s *sampler) stop() {
+	close(s.done)
+}
+
+// register gives back a new accumulator fed with the samples until unregistered.
+func (s *sampler) register() *rangeAccumulator {
+	acc := newRangeAccumulator()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accs[acc] = struct{}{}
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return acc
+}
+
+func (s *sampler) unregister(acc *rangeAccumulator) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.accs, acc)
+}
+
+// rangeAccumulator summarizes the samples since it was last taken.
+type rangeAccumulator struct {
+	mu   sync.Mutex
+	n    int
+	min  map[string]float64
+	max  map[string]float64
+	sums map[string]float64
+}
+
+func newRangeAccumulator() *rangeAccumulator {
+	acc := &rangeAccumulator{}
+	acc.reset()
+	return acc
+}
+
+func (a *rangeAccumulator) reset() {
+	a.n = 0
+	a.min = make(map[string]float64)
+	a.max = make(map[string]float64)
+	a.sums = make(map[string]float64)
+}
+
+func (a *rangeAccumulator) add(values map[string]float64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.addLocked(values)
+}
+
+func (a *rangeAccumulator) addLocked(values map[string]float64) {
+	for name, v := range values {
+		if min, ok := a.min[name]; !ok || v < min {
+			a.min[name] = v
+		}
+		if max, ok := a.max[name]; !ok || v > max {
+			a.max[name] = v
+		}
+		a.sums[name] += v
+	}
+	a.n++
+}
+
+// take gives back the ranges of the samples so far along with the given last
+// values, and then starts over.
+func (a *rangeAccumulator) take(last map[string]float64) map[string]stats.Range {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.addLocked(last)
+	ranges := make(map[string]stats.Range, len(last))
+	for name, v := range last {
+		ranges[name] = stats.Range{
+			Min:  a.min[name],
+			Max:  a.max[name],
+			Mean: a.sums[name] / float64(a.n),
+			Last: v,
+		}
+	}
+	a.reset()
+	return ranges
+}
+
+// sessionRanges gives back the accumulator for a new session, or nil if the
+// sampler isn't running.
+func sessionRanges() *rangeAccumulator {
+	mu.Lock()
+	defer mu.Unlock()
+	if smp == nil {
+		return nil
+	}
+	return smp.register()
+}
+
+// releaseRanges stops feeding the given accumulator.
+func releaseRanges(acc *rangeAccumulator) {
+	mu.Lock()
+	defer mu.Unlock()
+	if smp != nil && acc != nil {
+		smp.unregister(acc)
+	}
+}
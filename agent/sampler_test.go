@@ -0,0 +1,93 @@
+package agent
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/nakabonne/gosivy/stats"
+)
+
+func TestRangeAccumulatorTake(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples []map[string]float64
+		last    map[string]float64
+		want    map[string]stats.Range
+	}{
+		{
+			name: "no sample",
+			last: map[string]float64{"a": 3},
+			want: map[string]stats.Range{"a": {Min: 3, Max: 3, Mean: 3, Last: 3}},
+		},
+		{
+			name:    "spike between the scrapes",
+			samples: []map[string]float64{{"a": 1}, {"a": 10}, {"a": 2}},
+			last:    map[string]float64{"a": 3},
+			want:    map[string]stats.Range{"a": {Min: 1, Max: 10, Mean: 4, Last: 3}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			acc := newRangeAccumulator()
+			for _, s := range tt.samples {
+				acc.add(s)
+			}
+			assert.Equal(t, tt.want, acc.take(tt.last))
+			// It starts over once taken.
+			assert.Equal(t, map[string]stats.Range{"a": {Min: 5, Max: 5, Mean: 5, Last: 5}}, acc.take(map[string]float64{"a": 5}))
+		})
+	}
+}
+
+func TestSamplerSkipsWhileIdle(t *testing.T) {
+	var n int32
+	s := newSampler()
+	s.sample = func() map[string]float64 {
+		atomic.AddInt32(&n, 1)
+		return map[string]float64{}
+	}
+	go s.run(time.Millisecond)
+	defer s.stop()
+
+	time.Sleep(20 * time.Millisecond)
+	assert.Zero(t, atomic.LoadInt32(&n))
+	acc := s.register()
+	time.Sleep(20 * time.Millisecond)
+	assert.NotZero(t, atomic.LoadInt32(&n))
+
+	// Parked again once no one is attached.
+	s.unregister(acc)
+	time.Sleep(20 * time.Millisecond)
+	parked := atomic.LoadInt32(&n)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, parked, atomic.LoadInt32(&n))
+}
+
+func TestSessionRanges(t *testing.T) {
+	mu.Lock()
+	smp = newSampler()
+	mu.Unlock()
+	go smp.run(time.Millisecond)
+	defer func() {
+		mu.Lock()
+		smp.stop()
+		smp = nil
+		mu.Unlock()
+	}()
+
+	s := newSession(&config{})
+	defer s.close()
+	_, err := s.newStats()
+	assert.Nil(t, err)
+	time.Sleep(50 * time.Millisecond)
+	st, err := s.newStats()
+	assert.Nil(t, err)
+	r, ok := st.Ranges[stats.GaugeGoroutines]
+	assert.True(t, ok)
+	assert.Equal(t, float64(st.Goroutines), r.Last)
+	assert.LessOrEqual(t, r.Min, r.Mean)
+	assert.LessOrEqual(t, r.Mean, r.Max)
+}
@@ -0,0 +1,287 @@
+package agent
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/nakabonne/gosivy/stats"
+)
+
+// supportedSignals are the signals the agent can serve in the framed protocol.
+var supportedSignals = []byte{
+	stats.SignalMeta,
+	stats.SignalStats,
+	stats.SignalMetrics,
+	stats.SignalSubscribe,
+	stats.SignalProfile,
+	stats.SignalGoroutines,
+	stats.SignalTrace,
+	stats.SignalHistory,
+}
+
+// supportedEncodings are the encodings of stats frames the agent supports.
+var supportedEncodings = map[stats.Encoding]bool{
+	stats.EncodingJSON:   true,
+	stats.EncodingBinary: true,
+}
+
+// session holds the state of a single connection.
+type session struct {
+	cfg *config
+	// The protocol version negotiated in the handshake, 0 in the legacy protocol.
+	version int
+	// The encoding of stats frames negotiated in the handshake.
+	encoding stats.Encoding
+	// The scheduler latencies observed at the last stats request or at the start,
+	// used to serve the distribution per interval.
+	prevSchedLatencies *stats.Histogram
+	// Summarizes the gauges sampled between the stats requests,
+	// nil if they aren't sampled.
+	ranges *rangeAccumulator
+}
+
+// newSession gives back the session of a new connection, whose gauges are
+// sampled between the stats requests if the sampler is running.
+func newSession(cfg *config) *session {
+	return &session{
+		cfg:                cfg,
+		prevSchedLatencies: stats.NewSchedLatencies(),
+		ranges:             sessionRanges(),
+	}
+}
+
+func (s *session) close() {
+	releaseRanges(s.ranges)
+}
+
+// handleLegacy serves the single-byte protocol, where a request is a signal byte
+// and a response is JSON terminated by stats.Delimiter.
+func (s *session) handleLegacy(conn net.Conn, reader *bufio.Reader) error {
+	for {
+		conn.SetReadDeadline(time.Now().Add(readTimeout))
+		sig, err := reader.ReadByte()
+		if err != nil {
+			return err
+		}
+		var req []byte
+		switch sig {
+		case stats.SignalMeta, stats.SignalStats:
+		case stats.SignalMetrics:
+			if req, err = reader.ReadBytes(stats.Delimiter); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown signal received: %b", sig)
+		}
+		b, err := s.serve(sig, req)
+		if err != nil {
+			return err
+		}
+		if _, err := conn.Write(append(b, stats.Delimiter)); err != nil {
+			return err
+		}
+	}
+}
+
+// handleFramed serves the framed protocol. Unlike the legacy protocol,
+// the connection stays open even if a request couldn't be served.
+func (s *session) handleFramed(conn net.Conn, reader *bufio.Reader) error {
+	if err := s.handshake(conn, reader); err != nil {
+		return err
+	}
+	for {
+		conn.SetReadDeadline(time.Now().Add(readTimeout))
+		sig, req, err := stats.ReadFrame(reader)
+		if err != nil {
+			return err
+		}
+		if sig == stats.SignalSubscribe {
+			var sub stats.Subscription
+			if err := json.Unmarshal(req, &sub); err != nil {
+				err = &stats.ErrorReply{Code: stats.ErrorCodeBadRequest, Message: fmt.Sprintf("failed to decode subscription: %v", err)}
+				if err := writeError(conn, err); err != nil {
+					return err
+				}
+				continue
+			}
+			return s.stream(conn, reader, sub.Interval)
+		}
+		if sig == stats.SignalTrace {
+			if err := s.trace(conn, req); err != nil {
+				fmt.Fprintf(s.cfg.logWriter, "gosivy: %v\n", err)
+				if err := writeError(conn, err); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		res, err := s.serve(sig, req)
+		if err != nil {
+			fmt.Fprintf(s.cfg.logWriter, "gosivy: %v\n", err)
+			if err := writeError(conn, err); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := stats.WriteFrame(conn, sig, res); err != nil {
+			return err
+		}
+	}
+}
+
+// handshake authenticates the diagnoser if required, and then negotiates the protocol version.
+func (s *session) handshake(conn net.Conn, reader *bufio.Reader) error {
+	_, payload, err := stats.ReadFrame(reader)
+	if err != nil {
+		return err
+	}
+	var hello stats.Hello
+	if err := json.Unmarshal(payload, &hello); err != nil {
+		err = &stats.ErrorReply{Code: stats.ErrorCodeBadRequest, Message: fmt.Sprintf("failed to decode handshake: %v", err)}
+		writeError(conn, err)
+		return err
+	}
+	if s.cfg.token != "" && subtle.ConstantTimeCompare([]byte(hello.Token), []byte(s.cfg.token)) != 1 {
+		writeError(conn, &stats.ErrorReply{Code: stats.ErrorCodeUnauthorized, Message: "authentication failed"})
+		return fmt.Errorf("rejected unauthenticated connection from %v", conn.RemoteAddr())
+	}
+	if hello.Version < 1 {
+		err = &stats.ErrorReply{Code: stats.ErrorCodeUnsupportedVersion, Message: fmt.Sprintf("unsupported protocol version: %d", hello.Version)}
+		writeError(conn, err)
+		return err
+	}
+	s.version = hello.Version
+	if s.version > stats.ProtocolVersion {
+		s.version = stats.ProtocolVersion
+	}
+	s.encoding = stats.EncodingJSON
+	for _, e := range hello.Encodings {
+		if supportedEncodings[e] {
+			s.encoding = e
+			break
+		}
+	}
+	b, err := json.Marshal(&stats.Hello{
+		Version:   s.version,
+		Signals:   supportedSignals,
+		Encodings: []stats.Encoding{s.encoding},
+	})
+	if err != nil {
+		return err
+	}
+	return stats.WriteFrame(conn, stats.SignalHandshake, b)
+}
+
+// serve gives back the response to the given request.
+// An *stats.ErrorReply is given back if it is the client's fault.
+func (s *session) serve(sig byte, req []byte) ([]byte, error) {
+	switch sig {
+	case stats.SignalMeta:
+		meta, err := stats.NewMeta()
+		if err != nil {
+			return nil, err
+		}
+		meta.CustomMetrics = customMetricsMeta()
+		meta.Expvar = s.cfg.exposeExpvar
+		return json.Marshal(meta)
+	case stats.SignalStats:
+		st, err := s.newStats()
+		if err != nil {
+			return nil, err
+		}
+		return stats.EncodeStats(s.encoding, st)
+	case stats.SignalMetrics:
+		var names []string
+		if err := json.Unmarshal(req, &names); err != nil {
+			return nil, &stats.ErrorReply{Code: stats.ErrorCodeBadRequest, Message: fmt.Sprintf("failed to decode metric names: %v", err)}
+		}
+		return json.Marshal(collector.Read(names...))
+	case stats.SignalProfile:
+		var pr stats.ProfileRequest
+		if err := json.Unmarshal(req, &pr); err != nil {
+			return nil, &stats.ErrorReply{Code: stats.ErrorCodeBadRequest, Message: fmt.Sprintf("failed to decode profile request: %v", err)}
+		}
+		return captureProfile(&pr)
+	case stats.SignalGoroutines:
+		return dumpGoroutines()
+	case stats.SignalHistory:
+		return s.history()
+	default:
+		return nil, &stats.ErrorReply{Code: stats.ErrorCodeUnknownSignal, Message: fmt.Sprintf("unknown signal received: %b", sig)}
+	}
+}
+
+// trace streams an execution trace as requested.
+// An *stats.ErrorReply is given back if it is the client's fault.
+func (s *session) trace(conn net.Conn, req []byte) error {
+	var tr stats.TraceRequest
+	if err := json.Unmarshal(req, &tr); err != nil {
+		return &stats.ErrorReply{Code: stats.ErrorCodeBadRequest, Message: fmt.Sprintf("failed to decode trace request: %v", err)}
+	}
+	return streamTrace(conn, &tr)
+}
+
+// newStats samples the stats along with the application-specific values.
+func (s *session) newStats() (*stats.Stats, error) {
+	st, err := stats.NewStats()
+	if err != nil {
+		return nil, err
+	}
+	if cur := st.SchedLatencies; cur != nil {
+		st.SchedLatencies = cur.Sub(s.prevSchedLatencies)
+		s.prevSchedLatencies = cur
+	}
+	if s.ranges != nil {
+		st.Ranges = s.ranges.take(st.Gauges())
+	}
+	st.CustomMetrics = customMetricsValues(s.cfg.logWriter)
+	if s.cfg.exposeExpvar {
+		st.Expvars = stats.NewExpvars()
+	}
+	return st, nil
+}
+
+// history gives back the samples kept before attaching. The oldest ones are
+// dropped if they don't fit in a frame.
+func (s *session) history() ([]byte, error) {
+	mu.Lock()
+	h := hist
+	mu.Unlock()
+	var (
+		times   []time.Time
+		samples []*stats.Stats
+	)
+	if h != nil {
+		times, samples = h.snapshot()
+	}
+	for {
+		b, err := stats.EncodeTimedBatch(s.encoding, times, samples)
+		if err != nil {
+			return nil, err
+		}
+		if len(b) <= stats.MaxFrameSize || len(samples) == 0 {
+			return b, nil
+		}
+		drop := len(samples) - len(samples)/2
+		times, samples = times[drop:], samples[drop:]
+	}
+}
+
+// writeError replies with the given error. Errors other than *stats.ErrorReply
+// are replied as stats.ErrorCodeInternal.
+func writeError(conn net.Conn, err error) error {
+	var reply *stats.ErrorReply
+	if !errors.As(err, &reply) {
+		reply = &stats.ErrorReply{Code: stats.ErrorCodeInternal, Message: err.Error()}
+	}
+	b, err := json.Marshal(reply)
+	if err != nil {
+		return err
+	}
+	return stats.WriteFrame(conn, stats.FrameError, b)
+}
@@ -0,0 +1,114 @@
+package agent
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/nakabonne/gosivy/stats"
+)
+
+const (
+	// The shortest interval the agent samples at on subscription.
+	minStreamInterval = 100 * time.Millisecond
+	// The maximum number of samples held while the diagnoser falls behind.
+	// The oldest ones are dropped when exceeded.
+	maxStreamBacklog = 1024
+	// How long to wait for the diagnoser to receive a batch or a chunk of the trace.
+	writeTimeout = 5 * time.Second
+)
+
+// stream samples the stats on its own ticker and pushes them until the
+// connection is closed. Samples are pushed in a batch if the diagnoser
+// falls behind, so that no sample is lost to the round-trip latency.
+func (s *session) stream(conn net.Conn, reader *bufio.Reader, interval time.Duration) error {
+	if interval < minStreamInterval {
+		interval = minStreamInterval
+	}
+	// The diagnoser is not supposed to send anything on the stream,
+	// thus just waits for the connection to be closed.
+	conn.SetReadDeadline(time.Time{})
+	closed := make(chan struct{})
+	go func() {
+		io.Copy(ioutil.Discard, reader)
+		close(closed)
+	}()
+
+	var (
+		mu      sync.Mutex
+		backlog = make([]*stats.Stats, 0)
+		// When each sample in the backlog was taken.
+		times = make([]time.Time, 0)
+		// Notifies the writer that there are samples to be pushed.
+		ready = make(chan struct{}, 1)
+		done  = make(chan struct{})
+		// Waits for the sampling goroutine, which uses the session, to exit.
+		wg sync.WaitGroup
+	)
+	defer wg.Wait()
+	defer close(done)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		tick := time.NewTicker(interval)
+		defer tick.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-tick.C:
+				st, err := s.newStats()
+				if err != nil {
+					fmt.Fprintf(s.cfg.logWriter, "gosivy: %v\n", err)
+					continue
+				}
+				mu.Lock()
+				backlog = append(backlog, st)
+				times = append(times, now)
+				if len(backlog) > maxStreamBacklog {
+					backlog = backlog[len(backlog)-maxStreamBacklog:]
+					times = times[len(times)-maxStreamBacklog:]
+				}
+				mu.Unlock()
+				select {
+				case ready <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-closed:
+			return nil
+		case <-ready:
+			mu.Lock()
+			batch, batchTimes := backlog, times
+			backlog = make([]*stats.Stats, 0, len(batch))
+			times = make([]time.Time, 0, len(batch))
+			mu.Unlock()
+			b, err := s.encodePush(batch, batchTimes)
+			if err != nil {
+				return err
+			}
+			conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := stats.WriteFrame(conn, stats.SignalSubscribe, b); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// encodePush encodes the samples to be pushed. The times are sent along with
+// them only since protocol version 2.
+func (s *session) encodePush(batch []*stats.Stats, times []time.Time) ([]byte, error) {
+	if s.version < 2 {
+		return stats.EncodeBatch(s.encoding, batch)
+	}
+	return stats.EncodeTimedBatch(s.encoding, times, batch)
+}
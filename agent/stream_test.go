@@ -0,0 +1,52 @@
+package agent
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/nakabonne/gosivy/stats"
+)
+
+func TestEncodePush(t *testing.T) {
+	now := time.Now()
+	batch := []*stats.Stats{{Goroutines: 1}, {Goroutines: 2}}
+	times := []time.Time{now, now.Add(time.Second)}
+	tests := []struct {
+		name    string
+		version int
+		// Whether the times are sent along.
+		wantTimes bool
+	}{
+		{
+			name:    "version 1",
+			version: 1,
+		},
+		{
+			name:      "version 2",
+			version:   2,
+			wantTimes: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &session{version: tt.version, encoding: stats.EncodingBinary}
+			b, err := s.encodePush(batch, times)
+			assert.Nil(t, err)
+			if !tt.wantTimes {
+				got, err := stats.DecodeBatch(stats.EncodingBinary, b)
+				assert.Nil(t, err)
+				assert.Equal(t, batch, got)
+				return
+			}
+			got, err := stats.DecodeTimedBatch(stats.EncodingBinary, b)
+			assert.Nil(t, err)
+			assert.Len(t, got, 2)
+			for i, rec := range got {
+				assert.True(t, times[i].Equal(rec.Time))
+				assert.Equal(t, batch[i], rec.Stats)
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package agent
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"runtime/trace"
+	"time"
+
+	"github.com/nakabonne/gosivy/stats"
+)
+
+const (
+	// traceSampleInterval is how often the goroutine states are sampled while tracing.
+	traceSampleInterval = 10 * time.Millisecond
+	// traceChunkSize is the most bytes of the trace carried in a frame.
+	traceChunkSize = 1 << 20
+)
+
+// Runtime metrics summarizing the trace.
+const (
+	metricGCCycles          = "/gc/cycles/total:gc-cycles"
+	metricGoroutinesCreated = "/sched/goroutines-created:goroutines"
+	metricGCPauses          = "/gc/pauses:seconds"
+	metricRunning           = "/sched/goroutines/running:goroutines"
+	metricRunnable          = "/sched/goroutines/runnable:goroutines"
+	metricWaiting           = "/sched/goroutines/waiting:goroutines"
+	metricNotInGo           = "/sched/goroutines/not-in-go:goroutines"
+)
+
+// stwPauseMetrics cover all stop-the-world pauses. The GC pauses are used instead
+// if the running Go runtime doesn't support them.
+var stwPauseMetrics = []string{
+	"/sched/pauses/total/gc:seconds",
+	"/sched/pauses/total/other:seconds",
+}
+
+// streamTrace captures an execution trace, streaming it to w in FrameTraceData frames
+// as it's written, and then replies with its summary.
+func streamTrace(w io.Writer, req *stats.TraceRequest) error {
+	if req.Duration <= 0 || req.Duration > stats.MaxCaptureDuration {
+		return &stats.ErrorReply{Code: stats.ErrorCodeBadRequest, Message: fmt.Sprintf("duration must be in (0, %v]: %v", stats.MaxCaptureDuration, req.Duration)}
+	}
+	// Leave no deadline behind for the requests that follow.
+	defer setWriteDeadline(w, time.Time{})
+	bw := bufio.NewWriterSize(&traceWriter{w: w}, traceChunkSize)
+	if err := trace.Start(bw); err != nil {
+		return fmt.Errorf("failed to start tracing: %w", err)
+	}
+	summary := summarizeRuntime(req.Duration)
+	// Stop returns once the whole trace is written.
+	trace.Stop()
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to send the trace: %w", err)
+	}
+
+	b, err := json.Marshal(&stats.TraceReply{Summary: summary})
+	if err != nil {
+		return err
+	}
+	setWriteDeadline(w, time.Now().Add(writeTimeout))
+	return stats.WriteFrame(w, stats.SignalTrace, b)
+}
+
+// traceWriter writes the trace in FrameTraceData frames.
+type traceWriter struct {
+	w io.Writer
+}
+
+func (t *traceWriter) Write(p []byte) (int, error) {
+	var n int
+	for n < len(p) {
+		end := n + traceChunkSize
+		if end > len(p) {
+			end = len(p)
+		}
+		// Don't let a stalled client block the tracing forever.
+		setWriteDeadline(t.w, time.Now().Add(writeTimeout))
+		if err := stats.WriteFrame(t.w, stats.FrameTraceData, p[n:end]); err != nil {
+			return n, err
+		}
+		n = end
+	}
+	return n, nil
+}
+
+// setWriteDeadline sets the deadline for the writes to w if it supports, like net.Conn.
+func setWriteDeadline(w io.Writer, t time.Time) {
+	if d, ok := w.(interface{ SetWriteDeadline(time.Time) error }); ok {
+		d.SetWriteDeadline(t)
+	}
+}
+
+// summarizeRuntime observes the runtime for the given duration.
+func summarizeRuntime(d time.Duration) stats.TraceSummary {
+	names := append([]string{metricGCCycles, metricGoroutinesCreated, metricGCPauses}, stwPauseMetrics...)
+	stateNames := []string{metricRunning, metricRunnable, metricWaiting, metricNotInGo}
+	before := collector.Read(names...)
+
+	// Integrate the number of goroutines in each state over time.
+	states := make(map[string]float64, len(stateNames))
+	supported := true
+	start := time.Now()
+	last := start
+	tick := time.NewTicker(traceSampleInterval)
+	defer tick.Stop()
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	for done := false; !done; {
+		select {
+		case <-tick.C:
+		case <-timer.C:
+			done = true
+		}
+		now := time.Now()
+		ms := collector.Read(stateNames...)
+		for _, name := range stateNames {
+			if ms[name].Kind != stats.MetricKindUint64 {
+				supported = false
+				continue
+			}
+			states[name] += float64(ms[name].Uint64) * now.Sub(last).Seconds()
+		}
+		last = now
+	}
+	after := collector.Read(names...)
+
+	s := stats.TraceSummary{
+		Duration:          last.Sub(start),
+		GCCycles:          after.Uint64Value(metricGCCycles) - before.Uint64Value(metricGCCycles),
+		GoroutinesCreated: -1,
+		Running:           -1,
+		Runnable:          -1,
+		Blocked:           -1,
+		Syscall:           -1,
+	}
+	if after[metricGoroutinesCreated].Kind == stats.MetricKindUint64 {
+		s.GoroutinesCreated = int64(after.Uint64Value(metricGoroutinesCreated) - before.Uint64Value(metricGoroutinesCreated))
+	}
+	if supported {
+		seconds := func(name string) time.Duration { return time.Duration(states[name] * float64(time.Second)) }
+		s.Running = seconds(metricRunning)
+		s.Runnable = seconds(metricRunnable)
+		s.Blocked = seconds(metricWaiting)
+		s.Syscall = seconds(metricNotInGo)
+	}
+
+	pauses := stwPauseMetrics
+	if after[pauses[0]].Kind != stats.MetricKindHistogram {
+		pauses = []string{metricGCPauses}
+	}
+	for _, name := range pauses {
+		a, b := after[name], before[name]
+		if a.Kind != stats.MetricKindHistogram || b.Kind != stats.MetricKindHistogram {
+			continue
+		}
+		count, total, max := summarizeHistogram(a.Histogram.Sub(b.Histogram))
+		s.STWPauses += count
+		s.STWPauseTotal += time.Duration(total * float64(time.Second))
+		if m := time.Duration(max * float64(time.Second)); m > s.STWPauseMax {
+			s.STWPauseMax = m
+		}
+	}
+	return s
+}
+
+// summarizeHistogram gives back the number of values, along with the total and
+// the maximum estimated from the bucket boundaries. Each value is regarded as
+// the middle of its bucket, and the maximum as the upper bound of the last bucket.
+func summarizeHistogram(h *stats.Histogram) (count uint64, total, max float64) {
+	for i, c := range h.Counts {
+		if c == 0 {
+			continue
+		}
+		lower, upper := h.Buckets[i], h.Buckets[i+1]
+		switch {
+		case upper == math.MaxFloat64:
+			upper = lower
+		case lower == -math.MaxFloat64:
+			lower = upper
+		}
+		count += c
+		total += float64(c) * (lower + upper) / 2
+		max = upper
+	}
+	return count, total, max
+}
@@ -0,0 +1,141 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/nakabonne/gosivy/stats"
+)
+
+func TestStreamTrace(t *testing.T) {
+	tests := []struct {
+		name     string
+		req      stats.TraceRequest
+		wantCode stats.ErrorCode
+	}{
+		{
+			name: "valid duration",
+			req:  stats.TraceRequest{Duration: 50 * time.Millisecond},
+		},
+		{
+			name:     "no duration",
+			req:      stats.TraceRequest{},
+			wantCode: stats.ErrorCodeBadRequest,
+		},
+		{
+			name:     "too long",
+			req:      stats.TraceRequest{Duration: time.Hour},
+			wantCode: stats.ErrorCodeBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := streamTrace(&buf, &tt.req)
+			if tt.wantCode != 0 {
+				var reply *stats.ErrorReply
+				assert.True(t, errors.As(err, &reply))
+				assert.Equal(t, tt.wantCode, reply.Code)
+				assert.Zero(t, buf.Len())
+				return
+			}
+			assert.Nil(t, err)
+			var trace []byte
+			typ, payload, err := stats.ReadFrame(&buf)
+			for ; err == nil && typ == stats.FrameTraceData; typ, payload, err = stats.ReadFrame(&buf) {
+				trace = append(trace, payload...)
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, stats.SignalTrace, typ)
+			assert.NotEmpty(t, trace)
+			var reply stats.TraceReply
+			assert.Nil(t, json.Unmarshal(payload, &reply))
+			assert.GreaterOrEqual(t, int64(reply.Summary.Duration), int64(tt.req.Duration))
+			assert.Zero(t, buf.Len())
+		})
+	}
+}
+
+func TestTraceWriter(t *testing.T) {
+	var buf bytes.Buffer
+	data := bytes.Repeat([]byte{1}, traceChunkSize*5/2)
+	n, err := (&traceWriter{w: &buf}).Write(data)
+	assert.Nil(t, err)
+	assert.Equal(t, len(data), n)
+
+	var sizes []int
+	for buf.Len() > 0 {
+		typ, payload, err := stats.ReadFrame(&buf)
+		assert.Nil(t, err)
+		assert.Equal(t, stats.FrameTraceData, typ)
+		sizes = append(sizes, len(payload))
+	}
+	assert.Equal(t, []int{traceChunkSize, traceChunkSize, traceChunkSize / 2}, sizes)
+}
+
+// deadlineBuffer records the write deadlines set.
+type deadlineBuffer struct {
+	bytes.Buffer
+	deadlines []time.Time
+}
+
+func (d *deadlineBuffer) SetWriteDeadline(t time.Time) error {
+	d.deadlines = append(d.deadlines, t)
+	return nil
+}
+
+func TestStreamTraceWriteDeadline(t *testing.T) {
+	var buf deadlineBuffer
+	err := streamTrace(&buf, &stats.TraceRequest{Duration: 10 * time.Millisecond})
+	assert.Nil(t, err)
+	// The trace frames and the reply.
+	assert.GreaterOrEqual(t, len(buf.deadlines), 3)
+	for _, d := range buf.deadlines[:len(buf.deadlines)-1] {
+		assert.False(t, d.IsZero())
+	}
+	// Cleared once done.
+	assert.True(t, buf.deadlines[len(buf.deadlines)-1].IsZero())
+}
+
+func TestSummarizeHistogram(t *testing.T) {
+	tests := []struct {
+		name      string
+		h         *stats.Histogram
+		wantCount uint64
+		wantTotal float64
+		wantMax   float64
+	}{
+		{
+			name: "empty",
+			h:    &stats.Histogram{Counts: []uint64{0, 0}, Buckets: []float64{0, 1, 2}},
+		},
+		{
+			name:      "finite buckets",
+			h:         &stats.Histogram{Counts: []uint64{2, 1, 0}, Buckets: []float64{0, 1, 2, 3}},
+			wantCount: 3,
+			wantTotal: 2*0.5 + 1.5,
+			wantMax:   2,
+		},
+		{
+			name:      "infinite bounds",
+			h:         &stats.Histogram{Counts: []uint64{1, 0, 1}, Buckets: []float64{-math.MaxFloat64, 1, 2, math.MaxFloat64}},
+			wantCount: 2,
+			wantTotal: 1 + 2,
+			wantMax:   2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			count, total, max := summarizeHistogram(tt.h)
+			assert.Equal(t, tt.wantCount, count)
+			assert.Equal(t, tt.wantTotal, total)
+			assert.Equal(t, tt.wantMax, max)
+		})
+	}
+}
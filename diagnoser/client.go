@@ -0,0 +1,374 @@
+package diagnoser
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/nakabonne/gosivy/stats"
+)
+
+const (
+	// handshakeTimeout is how long to wait for the reply to the handshake.
+	handshakeTimeout = 5 * time.Second
+	// The number of subscription intervals to wait for the next push before
+	// regarding the connection as broken.
+	missedPushes = 3
+	// The shortest time to wait for the next push, so that the short intervals
+	// don't make a slow link regarded as broken.
+	minReceiveTimeout = 5 * time.Second
+)
+
+// DialOptions is optional settings to connect to the agent.
+type DialOptions struct {
+	// The TLS settings to connect to the agent serving over TLS.
+	// If nil, plain TCP is used.
+	TLSConfig *tls.Config
+	// The shared secret to authenticate to the agent requiring it.
+	Token string
+}
+
+// HostAddr is a TCP address in the form of "host:port", whose host name is
+// resolved only when dialed. It is kept as is so that the certificate of
+// the agent serving over TLS is verified against the host name.
+type HostAddr string
+
+func (a HostAddr) Network() string { return "tcp" }
+
+func (a HostAddr) String() string { return string(a) }
+
+// client talks to the agent in the framed protocol if the agent supports it,
+// otherwise in the legacy single-byte protocol.
+type client struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	// Whether to speak the legacy single-byte protocol.
+	legacy bool
+	// The negotiated protocol version, which is 0 in the legacy protocol.
+	version int
+	// Signals supported by the agent.
+	signals map[byte]bool
+	// The encoding of stats frames.
+	encoding stats.Encoding
+	// How long to wait for the next push once subscribed.
+	receiveTimeout time.Duration
+}
+
+// dial connects to the agent and negotiates the protocol.
+// It falls back to the legacy protocol if the agent closes the connection
+// on the handshake, which is what agents predating the framed protocol do.
+func dial(addr net.Addr, opts DialOptions) (*client, error) {
+	conn, err := dialConn(addr, opts)
+	if err != nil {
+		return nil, err
+	}
+	c := &client{
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+	}
+	err = c.handshake(opts.Token)
+	if err == nil {
+		return c, nil
+	}
+	conn.Close()
+	if !isClosedByPeer(err) {
+		return nil, fmt.Errorf("failed to handshake: %w", err)
+	}
+
+	conn, err = dialConn(addr, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &client{
+		conn:     conn,
+		reader:   bufio.NewReader(conn),
+		legacy:   true,
+		encoding: stats.EncodingJSON,
+		// Only these are guaranteed to be supported by the legacy agents.
+		signals: map[byte]bool{
+			stats.SignalMeta:  true,
+			stats.SignalStats: true,
+		},
+	}, nil
+}
+
+// dialConn connects to the given TCP or Unix domain socket address.
+func dialConn(addr net.Addr, opts DialOptions) (net.Conn, error) {
+	if opts.TLSConfig == nil {
+		conn, err := net.Dial(addr.Network(), addr.String())
+		if err != nil {
+			return nil, fmt.Errorf("failed to dial %s: %w", addr.Network(), err)
+		}
+		return conn, nil
+	}
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: handshakeTimeout}, addr.Network(), addr.String(), opts.TLSConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial TLS: %w", err)
+	}
+	return conn, nil
+}
+
+func (c *client) handshake(token string) error {
+	b, err := json.Marshal(&stats.Hello{
+		Version:   stats.ProtocolVersion,
+		Signals:   []byte{stats.SignalMeta, stats.SignalStats, stats.SignalMetrics, stats.SignalSubscribe, stats.SignalProfile, stats.SignalGoroutines, stats.SignalTrace, stats.SignalHistory},
+		Encodings: []stats.Encoding{stats.EncodingBinary, stats.EncodingJSON},
+		Token:     token,
+	})
+	if err != nil {
+		return err
+	}
+	if err := stats.WriteFrame(c.conn, stats.SignalHandshake, b); err != nil {
+		return err
+	}
+	c.conn.SetReadDeadline(time.Now().Add(handshakeTimeout))
+	defer c.conn.SetReadDeadline(time.Time{})
+	res, err := c.readFrame(stats.SignalHandshake)
+	if err != nil {
+		return err
+	}
+	var hello stats.Hello
+	if err := json.Unmarshal(res, &hello); err != nil {
+		return fmt.Errorf("failed to decode handshake: %w", err)
+	}
+	c.version = hello.Version
+	c.encoding = stats.EncodingJSON
+	if len(hello.Encodings) > 0 {
+		c.encoding = hello.Encodings[0]
+	}
+	c.signals = make(map[byte]bool, len(hello.Signals))
+	for _, s := range hello.Signals {
+		c.signals[s] = true
+	}
+	return nil
+}
+
+// isClosedByPeer checks if the given error is caused by the connection closed by the agent.
+func isClosedByPeer(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET)
+}
+
+func (c *client) close() error {
+	return c.conn.Close()
+}
+
+// supports checks if the agent supports the given signal.
+func (c *client) supports(sig byte) bool {
+	return c.signals[sig]
+}
+
+func (c *client) meta() (*stats.Meta, error) {
+	res, err := c.request(stats.SignalMeta, nil)
+	if err != nil {
+		return nil, err
+	}
+	var meta stats.Meta
+	if err := json.Unmarshal(res, &meta); err != nil {
+		return nil, fmt.Errorf("failed to decode metadata(%s): %w", string(res), err)
+	}
+	return &meta, nil
+}
+
+func (c *client) stats() (*stats.Stats, error) {
+	res, err := c.request(stats.SignalStats, nil)
+	if err != nil {
+		return nil, err
+	}
+	s, err := stats.DecodeStats(c.encoding, res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode stats: %w", err)
+	}
+	return s, nil
+}
+
+// metrics fetches the runtime metrics with the given names, or all metrics if no name given.
+func (c *client) metrics(names ...string) (stats.Metrics, error) {
+	if names == nil {
+		names = []string{}
+	}
+	req, err := json.Marshal(names)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.request(stats.SignalMetrics, req)
+	if err != nil {
+		return nil, err
+	}
+	var ms stats.Metrics
+	if err := json.Unmarshal(res, &ms); err != nil {
+		return nil, fmt.Errorf("failed to decode metrics: %w", err)
+	}
+	return ms, nil
+}
+
+// profile makes the agent capture the requested profile, and gives back it in the pprof format.
+func (c *client) profile(req *stats.ProfileRequest) ([]byte, error) {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	return c.request(stats.SignalProfile, b)
+}
+
+// goroutines fetches the stacks of all goroutines grouped by stack.
+func (c *client) goroutines() ([]*stats.GoroutineGroup, error) {
+	res, err := c.request(stats.SignalGoroutines, nil)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := stats.ParseGoroutineDump(res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse goroutine dump: %w", err)
+	}
+	return groups, nil
+}
+
+// trace makes the agent capture an execution trace for the given duration.
+func (c *client) trace(d time.Duration) (*stats.TraceReply, error) {
+	req, err := json.Marshal(&stats.TraceRequest{Duration: d})
+	if err != nil {
+		return nil, err
+	}
+	if !c.supports(stats.SignalTrace) {
+		return nil, fmt.Errorf("the agent doesn't support signal %b", stats.SignalTrace)
+	}
+	if err := stats.WriteFrame(c.conn, stats.SignalTrace, req); err != nil {
+		return nil, err
+	}
+	// The trace comes in chunks ahead of the reply.
+	var trace []byte
+	for {
+		got, payload, err := stats.ReadFrame(c.reader)
+		if err != nil {
+			return nil, err
+		}
+		if got == stats.FrameTraceData {
+			trace = append(trace, payload...)
+			continue
+		}
+		res, err := replyPayload(stats.SignalTrace, got, payload)
+		if err != nil {
+			return nil, err
+		}
+		reply := stats.TraceReply{Trace: trace}
+		if err := json.Unmarshal(res, &reply); err != nil {
+			return nil, fmt.Errorf("failed to decode trace: %w", err)
+		}
+		return &reply, nil
+	}
+}
+
+// history fetches the samples the agent kept before attaching, from the oldest.
+func (c *client) history() ([]*stats.Record, error) {
+	res, err := c.request(stats.SignalHistory, nil)
+	if err != nil {
+		return nil, err
+	}
+	records, err := stats.DecodeTimedBatch(c.encoding, res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode history: %w", err)
+	}
+	return records, nil
+}
+
+// subscribe makes the agent push the stats at the given interval.
+// Once subscribed, receive must be used to read the stats.
+func (c *client) subscribe(interval time.Duration) error {
+	if !c.supports(stats.SignalSubscribe) {
+		return fmt.Errorf("the agent doesn't support streaming")
+	}
+	req, err := json.Marshal(&stats.Subscription{Interval: interval})
+	if err != nil {
+		return err
+	}
+	c.receiveTimeout = missedPushes * interval
+	if c.receiveTimeout < minReceiveTimeout {
+		c.receiveTimeout = minReceiveTimeout
+	}
+	return stats.WriteFrame(c.conn, stats.SignalSubscribe, req)
+}
+
+// receive blocks until the next batch of stats is pushed by the agent, and gives
+// back the records of them from the oldest. It fails if nothing is pushed for
+// a few intervals, which means that the connection is broken even if not closed.
+// The agents predating protocol version 2 don't send when the samples were
+// taken, in which case all of them are regarded as taken on arrival.
+func (c *client) receive() ([]*stats.Record, error) {
+	c.conn.SetReadDeadline(time.Now().Add(c.receiveTimeout))
+	res, err := c.readFrame(stats.SignalSubscribe)
+	if err != nil {
+		return nil, err
+	}
+	if c.version >= 2 {
+		records, err := stats.DecodeTimedBatch(c.encoding, res)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode stats: %w", err)
+		}
+		return records, nil
+	}
+	batch, err := stats.DecodeBatch(c.encoding, res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode stats: %w", err)
+	}
+	now := time.Now()
+	records := make([]*stats.Record, 0, len(batch))
+	for _, s := range batch {
+		records = append(records, &stats.Record{Time: now, Stats: s})
+	}
+	return records, nil
+}
+
+// request sends the given signal along with the request payload if any,
+// and then gives back the response payload.
+func (c *client) request(sig byte, req []byte) ([]byte, error) {
+	if !c.supports(sig) {
+		return nil, fmt.Errorf("the agent doesn't support signal %b", sig)
+	}
+	if c.legacy {
+		b := []byte{sig}
+		if req != nil {
+			b = append(append(b, req...), stats.Delimiter)
+		}
+		if _, err := c.conn.Write(b); err != nil {
+			return nil, err
+		}
+		return c.reader.ReadBytes(stats.Delimiter)
+	}
+	if err := stats.WriteFrame(c.conn, sig, req); err != nil {
+		return nil, err
+	}
+	return c.readFrame(sig)
+}
+
+// readFrame reads a frame of the given type, and gives back its payload.
+// An *stats.ErrorReply is given back if the agent replied with an error.
+func (c *client) readFrame(typ byte) ([]byte, error) {
+	got, payload, err := stats.ReadFrame(c.reader)
+	if err != nil {
+		return nil, err
+	}
+	return replyPayload(typ, got, payload)
+}
+
+// replyPayload gives back the payload of the frame read as the reply to typ.
+// An *stats.ErrorReply is given back if the agent replied with an error.
+func replyPayload(typ, got byte, payload []byte) ([]byte, error) {
+	switch got {
+	case typ:
+		return payload, nil
+	case stats.FrameError:
+		var reply stats.ErrorReply
+		if err := json.Unmarshal(payload, &reply); err != nil {
+			return nil, fmt.Errorf("failed to decode error reply: %w", err)
+		}
+		return nil, &reply
+	default:
+		return nil, fmt.Errorf("unexpected frame type %b received", got)
+	}
+}
@@ -0,0 +1,351 @@
+package diagnoser
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/nakabonne/gosivy/agent"
+	"github.com/nakabonne/gosivy/process"
+	"github.com/nakabonne/gosivy/stats"
+)
+
+func TestDialLegacyAgent(t *testing.T) {
+	addr := startServer()
+	c, err := dial(addr, DialOptions{})
+	assert.Nil(t, err)
+	defer c.close()
+
+	assert.True(t, c.legacy)
+	assert.False(t, c.supports(stats.SignalMetrics))
+	_, err = c.meta()
+	assert.Nil(t, err)
+}
+
+func TestDialFramedAgent(t *testing.T) {
+	addr := startAgent(t)
+	defer agent.Close()
+
+	c, err := dial(addr, DialOptions{})
+	assert.Nil(t, err)
+	defer c.close()
+
+	assert.False(t, c.legacy)
+	assert.Equal(t, stats.ProtocolVersion, c.version)
+	assert.Equal(t, stats.EncodingBinary, c.encoding)
+	_, err = c.meta()
+	assert.Nil(t, err)
+	s, err := c.stats()
+	assert.Nil(t, err)
+	assert.NotZero(t, s.Goroutines)
+	ms, err := c.metrics("/gc/heap/goal:bytes")
+	assert.Nil(t, err)
+	assert.Equal(t, stats.MetricKindUint64, ms["/gc/heap/goal:bytes"].Kind)
+}
+
+func TestSubscribe(t *testing.T) {
+	addr := startAgent(t)
+	defer agent.Close()
+
+	c, err := dial(addr, DialOptions{})
+	assert.Nil(t, err)
+	defer c.close()
+
+	assert.Nil(t, c.subscribe(100*time.Millisecond))
+	records, err := c.receive()
+	assert.Nil(t, err)
+	assert.NotEmpty(t, records)
+	assert.NotZero(t, records[0].Stats.Goroutines)
+	assert.False(t, records[0].Time.IsZero())
+}
+
+func TestReceiveFromSilentAgent(t *testing.T) {
+	// The agent accepts the subscription but never pushes, as if the link went half-open.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		if _, _, err := stats.ReadFrame(reader); err != nil {
+			return
+		}
+		b, _ := json.Marshal(&stats.Hello{Version: stats.ProtocolVersion, Signals: []byte{stats.SignalSubscribe}})
+		stats.WriteFrame(conn, stats.SignalHandshake, b)
+		io.Copy(ioutil.Discard, reader)
+	}()
+
+	c, err := dial(ln.Addr(), DialOptions{})
+	assert.Nil(t, err)
+	defer c.close()
+	assert.Nil(t, c.subscribe(100*time.Millisecond))
+	c.receiveTimeout = 100 * time.Millisecond
+	_, err = c.receive()
+	var netErr net.Error
+	assert.True(t, errors.As(err, &netErr) && netErr.Timeout())
+}
+
+func TestHistory(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    agent.Options
+		wantLen int
+	}{
+		{
+			name:    "kept",
+			opts:    agent.Options{Addr: "127.0.0.1:0", HistorySize: 3, HistoryInterval: 10 * time.Millisecond},
+			wantLen: 3,
+		},
+		{
+			name:    "not kept",
+			opts:    agent.Options{Addr: "127.0.0.1:0"},
+			wantLen: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr := startAgentWithOptions(t, tt.opts)
+			defer agent.Close()
+			time.Sleep(100 * time.Millisecond)
+
+			c, err := dial(addr, DialOptions{})
+			assert.Nil(t, err)
+			defer c.close()
+
+			records, err := c.history()
+			assert.Nil(t, err)
+			assert.Len(t, records, tt.wantLen)
+			for i, rec := range records {
+				assert.NotZero(t, rec.Stats.Goroutines)
+				if i > 0 {
+					assert.True(t, rec.Time.After(records[i-1].Time))
+				}
+			}
+		})
+	}
+}
+
+func TestDialTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey := writeCert(t, dir, "ca", nil, nil)
+	writeCert(t, dir, "server", ca, caKey)
+	writeCert(t, dir, "client", ca, caKey)
+	addr := startAgentWithOptions(t, agent.Options{
+		Addr:            "127.0.0.1:0",
+		TLSCertFile:     filepath.Join(dir, "server.pem"),
+		TLSKeyFile:      filepath.Join(dir, "server-key.pem"),
+		TLSClientCAFile: filepath.Join(dir, "ca.pem"),
+	})
+	defer agent.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	clientCert, err := tls.LoadX509KeyPair(filepath.Join(dir, "client.pem"), filepath.Join(dir, "client-key.pem"))
+	assert.Nil(t, err)
+
+	tests := []struct {
+		name    string
+		opts    DialOptions
+		wantErr bool
+	}{
+		{
+			name: "mutual TLS",
+			opts: DialOptions{TLSConfig: &tls.Config{RootCAs: pool, Certificates: []tls.Certificate{clientCert}}},
+		},
+		{
+			name:    "plain TCP",
+			opts:    DialOptions{},
+			wantErr: true,
+		},
+		{
+			name:    "unknown authority",
+			opts:    DialOptions{TLSConfig: &tls.Config{Certificates: []tls.Certificate{clientCert}}},
+			wantErr: true,
+		},
+		{
+			name:    "no client certificate",
+			opts:    DialOptions{TLSConfig: &tls.Config{RootCAs: pool}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := dial(addr, tt.opts)
+			if err == nil {
+				defer c.close()
+				_, err = c.meta()
+			}
+			assert.Equal(t, tt.wantErr, err != nil)
+		})
+	}
+}
+
+func TestDialTLSWithHostName(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey := writeCert(t, dir, "ca", nil, nil)
+	writeCert(t, dir, "server", ca, caKey, "localhost")
+	addr := startAgentWithOptions(t, agent.Options{
+		Addr:        "127.0.0.1:0",
+		TLSCertFile: filepath.Join(dir, "server.pem"),
+		TLSKeyFile:  filepath.Join(dir, "server-key.pem"),
+	})
+	defer agent.Close()
+	port := addr.(*net.TCPAddr).Port
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	tests := []struct {
+		name    string
+		addr    net.Addr
+		wantErr bool
+	}{
+		{
+			name: "host name in the certificate",
+			addr: HostAddr(fmt.Sprintf("localhost:%d", port)),
+		},
+		{
+			name:    "IP address not in the certificate",
+			addr:    addr,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := dial(tt.addr, DialOptions{TLSConfig: &tls.Config{RootCAs: pool}})
+			if err == nil {
+				defer c.close()
+				_, err = c.meta()
+			}
+			assert.Equal(t, tt.wantErr, err != nil)
+		})
+	}
+}
+
+func TestDialWithToken(t *testing.T) {
+	addr := startAgentWithOptions(t, agent.Options{Addr: "127.0.0.1:0", Token: "secret"})
+	defer agent.Close()
+
+	tests := []struct {
+		name     string
+		token    string
+		wantCode stats.ErrorCode
+	}{
+		{
+			name:  "right token",
+			token: "secret",
+		},
+		{
+			name:     "wrong token",
+			token:    "wrong",
+			wantCode: stats.ErrorCodeUnauthorized,
+		},
+		{
+			name:     "no token",
+			wantCode: stats.ErrorCodeUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := dial(addr, DialOptions{Token: tt.token})
+			if tt.wantCode == 0 {
+				assert.Nil(t, err)
+				defer c.close()
+				_, err = c.meta()
+				assert.Nil(t, err)
+				return
+			}
+			var reply *stats.ErrorReply
+			assert.True(t, errors.As(err, &reply))
+			assert.Equal(t, tt.wantCode, reply.Code)
+		})
+	}
+}
+
+// writeCert generates a certificate for the given host names, or 127.0.0.1 if not given,
+// and its key, and then writes them as <name>.pem and <name>-key.pem under dir.
+// A self-signed CA certificate is generated if parent is nil.
+func writeCert(t *testing.T, dir, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, hosts ...string) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	if len(hosts) > 0 {
+		tmpl.DNSNames = hosts
+	} else {
+		tmpl.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+	}
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage |= x509.KeyUsageCertSign
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	assert.Nil(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+	err = ioutil.WriteFile(filepath.Join(dir, name+".pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	assert.Nil(t, err)
+	err = ioutil.WriteFile(filepath.Join(dir, name+"-key.pem"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	assert.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+	return cert, key
+}
+
+func TestDialUnixSocket(t *testing.T) {
+	addr := startAgentWithOptions(t, agent.Options{UnixSocket: true})
+	defer agent.Close()
+	assert.Equal(t, "unix", addr.Network())
+
+	c, err := dial(addr, DialOptions{})
+	assert.Nil(t, err)
+	defer c.close()
+	assert.False(t, c.legacy)
+	s, err := c.stats()
+	assert.Nil(t, err)
+	assert.NotZero(t, s.Goroutines)
+}
+
+// startAgent launches the agent in the current process.
+func startAgent(t *testing.T) net.Addr {
+	return startAgentWithOptions(t, agent.Options{Addr: "127.0.0.1:0"})
+}
+
+func startAgentWithOptions(t *testing.T, opts agent.Options) net.Addr {
+	os.Setenv(process.ConfigDirEnvKey, t.TempDir())
+	t.Cleanup(func() { os.Unsetenv(process.ConfigDirEnvKey) })
+	err := agent.Listen(opts)
+	assert.Nil(t, err)
+	addr, err := process.GetAddr(os.Getpid())
+	assert.Nil(t, err)
+	return addr
+}
@@ -3,11 +3,13 @@
 package diagnoser
 
 import (
-	"bufio"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -24,17 +26,65 @@ type Diagnoser interface {
 	Run() error
 }
 
+// Target is the process to be diagnosed.
+type Target struct {
+	// The address the agent listens on.
+	Addr net.Addr
+	// Resolve gives back the current address of the agent, which is called
+	// before reconnecting so that the restarted process can be followed.
+	// If nil, Addr is always used.
+	Resolve func() (net.Addr, error)
+}
+
+// CaptureOptions is the settings of the profiles and the traces captured from the GUI.
+type CaptureOptions struct {
+	// How long to profile the CPU for. The default is used if zero.
+	ProfileDuration time.Duration
+	// How long to capture an execution trace for. The default is used if zero.
+	TraceDuration time.Duration
+}
+
 type diagnoser struct {
-	addr           *net.TCPAddr
+	targets        []Target
 	scrapeInterval time.Duration
 	gui            GUI
+	// Builds the GUI for the targets attached to, used if gui is nil.
+	newGUI   func(cancel context.CancelFunc, targets []*tui.Target) GUI
+	dialOpts DialOptions
 }
 
-func NewDiagnoser(addr *net.TCPAddr, scrapeInterval time.Duration, gui GUI) Diagnoser {
+// NewDiagnoser gives back a diagnoser for the given targets,
+// each of which is drawn on its own tab.
+func NewDiagnoser(targets []Target, scrapeInterval time.Duration, gui GUI, dialOpts DialOptions, captureOpts CaptureOptions) Diagnoser {
 	return &diagnoser{
-		addr:           addr,
+		targets:        targets,
 		scrapeInterval: scrapeInterval,
 		gui:            gui,
+		newGUI: func(cancel context.CancelFunc, targets []*tui.Target) GUI {
+			g := tui.NewTUI(scrapeInterval, cancel, targets)
+			if captureOpts.ProfileDuration > 0 {
+				g.ProfileDuration = captureOpts.ProfileDuration
+			}
+			if captureOpts.TraceDuration > 0 {
+				g.TraceDuration = captureOpts.TraceDuration
+			}
+			return g
+		},
+		dialOpts: dialOpts,
+	}
+}
+
+// NewRecorder gives back a diagnoser which writes the samples scraped from the given targets
+// to w instead of drawing them, until interrupted. Changes of the connection state are
+// reported to logWriter. See stats.Record for the format.
+func NewRecorder(targets []Target, scrapeInterval time.Duration, w, logWriter io.Writer, dialOpts DialOptions) Diagnoser {
+	return &diagnoser{
+		targets:        targets,
+		scrapeInterval: scrapeInterval,
+		newGUI: func(_ context.CancelFunc, targets []*tui.Target) GUI {
+			return newRecorder(targets, w, logWriter)
+		},
+		dialOpts: dialOpts,
 	}
 }
 
@@ -44,76 +94,286 @@ func (d *diagnoser) Run() error {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	statsCh := make(chan *stats.Stats)
-	meta, err := d.startScraping(ctx, statsCh)
-	if err != nil {
-		return err
+	targets := make([]*tui.Target, 0, len(d.targets))
+	for _, target := range d.targets {
+		statsCh := make(chan *stats.Record)
+		metaCh := make(chan *stats.Meta)
+		statusCh := make(chan tui.Status)
+		meta, history, err := d.startScraping(ctx, target, &sink{statsCh: statsCh, metaCh: metaCh, statusCh: statusCh})
+		if err != nil {
+			return fmt.Errorf("failed to attach to %s: %w", target.Addr, err)
+		}
+		addr := target.Addr
+		targets = append(targets, &tui.Target{
+			Name:     targetName(addr, meta),
+			StatsCh:  statsCh,
+			Metadata: *meta,
+			History:  history,
+			MetaCh:   metaCh,
+			Rename: func(meta *stats.Meta) string {
+				return targetName(addr, meta)
+			},
+			StatusCh: statusCh,
+			Profiler: &profiler{target: target, dialOpts: d.dialOpts},
+		})
 	}
 	if d.gui == nil {
-		d.gui = tui.NewTUI(d.scrapeInterval, cancel, statsCh, meta)
+		d.gui = d.newGUI(cancel, targets)
 	}
 	return d.gui.Run(ctx)
 }
 
-func (d *diagnoser) startScraping(ctx context.Context, statsCh chan<- *stats.Stats) (*stats.Meta, error) {
-	conn, err := net.DialTCP("tcp", nil, d.addr)
-	if err != nil {
-		return nil, fmt.Errorf("failed to dial TCP: %w", err)
+// sink delivers what's scraped from a target to the GUI.
+// Nil channels are skipped.
+type sink struct {
+	statsCh  chan<- *stats.Record
+	metaCh   chan<- *stats.Meta
+	statusCh chan<- tui.Status
+	// The latest health of the connection.
+	status tui.Status
+}
+
+// sendStats sends the given stats taken at the given time, or nil if the sample
+// was missed, along with the status updated accordingly.
+func (s *sink) sendStats(ctx context.Context, at time.Time, st *stats.Stats) error {
+	if st != nil {
+		s.status.State = tui.ConnStateConnected
+		s.status.LastScrape = time.Now()
+		// Scraped fine again.
+		s.status.Err = nil
+	}
+	if s.statsCh != nil {
+		select {
+		case s.statsCh <- &stats.Record{Time: at, Stats: st}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
 	}
+	return s.sendStatus(ctx)
+}
 
-	// First up, fetch meta data of process,
-	if _, err := conn.Write([]byte{stats.SignalMeta}); err != nil {
-		return nil, err
+func (s *sink) sendMeta(ctx context.Context, m *stats.Meta) error {
+	if s.metaCh == nil {
+		return nil
+	}
+	select {
+	case s.metaCh <- m:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *sink) sendStatus(ctx context.Context) error {
+	if s.statusCh == nil {
+		return nil
+	}
+	select {
+	case s.statusCh <- s.status:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// fail records the given error. The connection is regarded as broken unless
+// it's an error replied by the agent.
+func (s *sink) fail(err error) {
+	s.status.Err = err
+	var reply *stats.ErrorReply
+	if !errors.As(err, &reply) {
+		s.status.State = tui.ConnStateReconnecting
 	}
-	reader := bufio.NewReader(conn)
-	res, err := reader.ReadBytes(stats.Delimiter)
+}
+
+// startScraping starts scraping from the target in the background, and gives back
+// the metadata of the process along with the samples the agent kept before attaching.
+// The metadata is sent to the sink every time it turns out that the process
+// restarted while reconnecting.
+func (d *diagnoser) startScraping(ctx context.Context, target Target, sink *sink) (*stats.Meta, []*stats.Record, error) {
+	addr := target.Addr
+	c, err := dial(addr, d.dialOpts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read metadata: %w", err)
+		return nil, nil, err
 	}
-	var meta stats.Meta
-	if err := json.Unmarshal(res, &meta); err != nil {
-		return nil, fmt.Errorf("failed to decode metadata(%s): %w", string(res), err)
+	// First up, fetch meta data of process,
+	start := time.Now()
+	meta, err := c.meta()
+	if err != nil {
+		c.close()
+		return nil, nil, fmt.Errorf("failed to read metadata: %w", err)
+	}
+	var history []*stats.Record
+	if c.supports(stats.SignalHistory) {
+		history, err = c.history()
+		if err != nil {
+			c.close()
+			return nil, nil, fmt.Errorf("failed to read history: %w", err)
+		}
 	}
+	sink.status = tui.Status{State: tui.ConnStateConnected, Latency: time.Since(start)}
 
-	go func(ctx context.Context, ch chan<- *stats.Stats) {
-		defer conn.Close()
-		tick := time.NewTicker(d.scrapeInterval)
-		defer tick.Stop()
+	go func(ctx context.Context) {
+		if err := sink.sendStatus(ctx); err != nil {
+			c.close()
+			return
+		}
+		cur := meta
 		for {
+			if c != nil {
+				var err error
+				if c.supports(stats.SignalSubscribe) {
+					err = d.stream(ctx, c, sink)
+				} else {
+					err = d.poll(ctx, c, sink)
+				}
+				c.close()
+				if ctx.Err() != nil {
+					return
+				}
+				logrus.Errorf("failed to scrape stats: %v", err)
+				sink.fail(fmt.Errorf("failed to scrape stats: %w", err))
+			}
+			// Leave a gap for the sample missed while reconnecting.
+			if err := sink.sendStats(ctx, time.Now(), nil); err != nil {
+				return
+			}
+			// Wait a bit before reconnecting.
 			select {
 			case <-ctx.Done():
 				return
-			case <-tick.C:
-				if conn == nil {
-					conn, err = net.DialTCP("tcp", nil, d.addr)
-					if err != nil {
-						logrus.Errorf("failed to dial: %v", err)
-						continue
-					}
+			case <-time.After(d.scrapeInterval):
+			}
+			if target.Resolve != nil {
+				if a, err := target.Resolve(); err != nil {
+					logrus.Errorf("failed to resolve %s: %v", target.Addr, err)
+					sink.fail(fmt.Errorf("failed to resolve: %w", err))
+				} else {
+					addr = a
 				}
+			}
+			c, err = dial(addr, d.dialOpts)
+			if err != nil {
+				logrus.Errorf("failed to dial: %v", err)
+				sink.fail(fmt.Errorf("failed to dial: %w", err))
+				c = nil
+				continue
+			}
+			start := time.Now()
+			m, err := c.meta()
+			if err != nil {
+				logrus.Errorf("failed to read metadata: %v", err)
+				sink.fail(fmt.Errorf("failed to read metadata: %w", err))
+				c.close()
+				c = nil
+				continue
+			}
+			sink.status.State = tui.ConnStateConnected
+			sink.status.Latency = time.Since(start)
+			if err := sink.sendStatus(ctx); err != nil {
+				c.close()
+				return
+			}
+			if !isRestarted(cur, m) {
+				continue
+			}
+			logrus.Infof("process %d restarted as %d", cur.PID, m.PID)
+			cur = m
+			if err := sink.sendMeta(ctx, m); err != nil {
+				c.close()
+				return
+			}
+		}
+	}(ctx)
+	return meta, history, nil
+}
 
-				if _, err := conn.Write([]byte{stats.SignalStats}); err != nil {
-					logrus.Errorf("failed to write into connection: %v", err)
-					conn = nil
-					continue
-				}
-				reader.Reset(conn)
-				res, err := reader.ReadBytes(stats.Delimiter)
-				if err != nil {
-					logrus.Errorf("failed to read the response: %v", err)
-					conn = nil
-					continue
-				}
+// isRestarted checks if the given metadata belong to the different processes.
+func isRestarted(prev, cur *stats.Meta) bool {
+	return prev.PID != cur.PID || prev.CreateTime != cur.CreateTime
+}
 
-				var stats stats.Stats
-				if err := json.Unmarshal(res, &stats); err != nil {
-					logrus.Errorf("failed to decode stats: %v", err)
-					continue
+// targetName gives back the name to tell the process apart from the others,
+// which is composed of the executable and either the PID for local processes
+// or the address for remote ones.
+func targetName(addr net.Addr, meta *stats.Meta) string {
+	exec := "?"
+	if fields := strings.Fields(meta.Command); len(fields) > 0 {
+		exec = filepath.Base(fields[0])
+	}
+	remote := false
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		remote = !a.IP.IsLoopback()
+	case HostAddr:
+		host, _, err := net.SplitHostPort(string(a))
+		remote = err != nil || host != "localhost"
+	}
+	if remote {
+		return exec + "@" + addr.String()
+	}
+	return fmt.Sprintf("%s(%d)", exec, meta.PID)
+}
+
+// poll periodically requests the stats until the connection gets unavailable.
+func (d *diagnoser) poll(ctx context.Context, c *client, sink *sink) error {
+	tick := time.NewTicker(d.scrapeInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-tick.C:
+			start := time.Now()
+			s, err := c.stats()
+			var reply *stats.ErrorReply
+			if errors.As(err, &reply) {
+				// The connection is still available.
+				logrus.Errorf("failed to scrape stats: %v", err)
+				sink.fail(fmt.Errorf("failed to scrape stats: %w", err))
+				if err := sink.sendStats(ctx, time.Now(), nil); err != nil {
+					return err
 				}
-				ch <- &stats
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			sink.status.Latency = time.Since(start)
+			if err := sink.sendStats(ctx, time.Now(), s); err != nil {
+				return err
 			}
 		}
-	}(ctx, statsCh)
+	}
+}
 
-	return &meta, nil
+// stream subscribes to the stats pushed by the agent,
+// and then keeps receiving until the connection gets unavailable.
+func (d *diagnoser) stream(ctx context.Context, c *client, sink *sink) error {
+	if err := c.subscribe(d.scrapeInterval); err != nil {
+		return err
+	}
+	// No round trip is made while streamed.
+	sink.status.Latency = 0
+	// Unblock the receiving on cancellation.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.close()
+		case <-done:
+		}
+	}()
+	for {
+		records, err := c.receive()
+		if err != nil {
+			return err
+		}
+		for _, rec := range records {
+			if err := sink.sendStats(ctx, rec.Time, rec.Stats); err != nil {
+				return err
+			}
+		}
+	}
 }
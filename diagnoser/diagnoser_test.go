@@ -1,7 +1,9 @@
 package diagnoser
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net"
 	"testing"
 	"time"
@@ -9,6 +11,8 @@ import (
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 
+	"github.com/nakabonne/gosivy/agent"
+	"github.com/nakabonne/gosivy/diagnoser/tui"
 	"github.com/nakabonne/gosivy/stats"
 )
 
@@ -16,17 +20,53 @@ func TestRun(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
-	addr := startServer()
+	targets := []Target{{Addr: startServer()}, {Addr: startServer()}}
 	m := NewMockGUI(ctrl)
 	m.EXPECT().Run(gomock.Any())
-	d := NewDiagnoser(addr, time.Microsecond, m)
+	d := NewDiagnoser(targets, time.Microsecond, m, DialOptions{}, CaptureOptions{})
 	err := d.Run()
 
 	time.Sleep(100 * time.Millisecond)
 	assert.Nil(t, err)
 }
 
+func TestNewDiagnoserCaptureOptions(t *testing.T) {
+	tests := []struct {
+		name            string
+		opts            CaptureOptions
+		wantProfileTime time.Duration
+		wantTraceTime   time.Duration
+	}{
+		{
+			name:            "default",
+			wantProfileTime: tui.DefaultProfileDuration,
+			wantTraceTime:   tui.DefaultTraceDuration,
+		},
+		{
+			name:            "given",
+			opts:            CaptureOptions{ProfileDuration: 30 * time.Second, TraceDuration: time.Second},
+			wantProfileTime: 30 * time.Second,
+			wantTraceTime:   time.Second,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDiagnoser(nil, time.Second, nil, DialOptions{}, tt.opts).(*diagnoser)
+			g := d.newGUI(func() {}, nil).(*tui.TUI)
+			assert.Equal(t, tt.wantProfileTime, g.ProfileDuration)
+			assert.Equal(t, tt.wantTraceTime, g.TraceDuration)
+		})
+	}
+}
+
+// startServer launches a fake agent speaking the legacy protocol.
 func startServer() *net.TCPAddr {
+	return startLegacyServer(&stats.Meta{}, false)
+}
+
+// startLegacyServer launches a fake agent speaking the legacy protocol with the given metadata.
+// If oneShot is true, every connection is closed after a single request.
+func startLegacyServer(meta *stats.Meta, oneShot bool) *net.TCPAddr {
 	ln, err := net.Listen("tcp", "127.0.0.1:0")
 	if err != nil {
 		panic(err)
@@ -34,19 +74,236 @@ func startServer() *net.TCPAddr {
 	go func() {
 		defer ln.Close()
 		for {
-			conn, _ := ln.Accept()
-			sig := make([]byte, 1)
-			_, _ = conn.Read(sig)
-			switch sig[0] {
-			case stats.SignalMeta:
-				b, _ := json.Marshal(&stats.Meta{})
-				_, _ = conn.Write(append(b, stats.Delimiter))
-			case stats.SignalStats:
-				b, _ := json.Marshal(&stats.Stats{})
-				_, _ = conn.Write(append(b, stats.Delimiter))
+			conn, err := ln.Accept()
+			if err != nil {
+				return
 			}
-			conn.Close()
+			go func() {
+				defer conn.Close()
+				sig := make([]byte, 1)
+				for {
+					if _, err := conn.Read(sig); err != nil {
+						return
+					}
+					var b []byte
+					switch sig[0] {
+					case stats.SignalMeta:
+						b, _ = json.Marshal(meta)
+					case stats.SignalStats:
+						b, _ = json.Marshal(&stats.Stats{})
+					default:
+						// Unknown signals such as the handshake.
+						return
+					}
+					if _, err := conn.Write(append(b, stats.Delimiter)); err != nil || oneShot {
+						return
+					}
+				}
+			}()
 		}
 	}()
 	return ln.Addr().(*net.TCPAddr)
 }
+
+func TestStartScraping(t *testing.T) {
+	tests := []struct {
+		name  string
+		addr  func(t *testing.T) net.Addr
+		close func()
+	}{
+		{
+			name:  "poll legacy agent",
+			addr:  func(*testing.T) net.Addr { return startServer() },
+			close: func() {},
+		},
+		{
+			name:  "stream from agent",
+			addr:  startAgent,
+			close: agent.Close,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer tt.close()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			d := &diagnoser{scrapeInterval: 100 * time.Millisecond}
+			ch := make(chan *stats.Record)
+			_, _, err := d.startScraping(ctx, Target{Addr: tt.addr(t)}, &sink{statsCh: ch, metaCh: make(chan *stats.Meta)})
+			assert.Nil(t, err)
+			select {
+			case s := <-ch:
+				assert.NotNil(t, s.Stats)
+			case <-time.After(5 * time.Second):
+				t.Fatal("no stats scraped")
+			}
+		})
+	}
+}
+
+func TestStartScrapingFollowsRestart(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// The old agent goes away right after giving the metadata.
+	oldAddr := startLegacyServer(&stats.Meta{PID: 1}, true)
+	newAddr := startLegacyServer(&stats.Meta{PID: 2}, false)
+	target := Target{
+		Addr:    oldAddr,
+		Resolve: func() (net.Addr, error) { return newAddr, nil },
+	}
+	d := &diagnoser{scrapeInterval: 100 * time.Millisecond}
+	statsCh := make(chan *stats.Record)
+	metaCh := make(chan *stats.Meta)
+	meta, _, err := d.startScraping(ctx, target, &sink{statsCh: statsCh, metaCh: metaCh})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, meta.PID)
+
+	timeout := time.After(5 * time.Second)
+	for restarted := false; !restarted; {
+		select {
+		case m := <-metaCh:
+			assert.Equal(t, 2, m.PID)
+			restarted = true
+		case s := <-statsCh:
+			// Gaps are left while reconnecting.
+			assert.Nil(t, s.Stats)
+		case <-timeout:
+			t.Fatal("restart not detected")
+		}
+	}
+	select {
+	case s := <-statsCh:
+		assert.NotNil(t, s.Stats)
+	case <-timeout:
+		t.Fatal("no stats scraped from the new process")
+	}
+}
+
+func TestStartScrapingReportsStatus(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// The agent goes away right after giving the metadata.
+	addr := startLegacyServer(&stats.Meta{PID: 1}, true)
+	d := &diagnoser{scrapeInterval: 100 * time.Millisecond}
+	statsCh := make(chan *stats.Record)
+	statusCh := make(chan tui.Status)
+	_, _, err := d.startScraping(ctx, Target{Addr: addr}, &sink{statsCh: statsCh, statusCh: statusCh})
+	assert.Nil(t, err)
+
+	st := <-statusCh
+	assert.Equal(t, tui.ConnStateConnected, st.State)
+	assert.Nil(t, st.Err)
+
+	// The scrape fails since the connection is closed.
+	s := <-statsCh
+	assert.Nil(t, s.Stats)
+	st = <-statusCh
+	assert.Equal(t, tui.ConnStateReconnecting, st.State)
+	assert.NotNil(t, st.Err)
+	assert.True(t, st.LastScrape.IsZero())
+}
+
+func TestSinkSendStatsClearsError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	statusCh := make(chan tui.Status, 3)
+	s := &sink{statusCh: statusCh}
+	s.fail(errors.New("connection reset"))
+
+	// The error is kept while the samples are missed.
+	assert.Nil(t, s.sendStats(ctx, time.Now(), nil))
+	st := <-statusCh
+	assert.Equal(t, tui.ConnStateReconnecting, st.State)
+	assert.NotNil(t, st.Err)
+
+	assert.Nil(t, s.sendStats(ctx, time.Now(), &stats.Stats{}))
+	st = <-statusCh
+	assert.Equal(t, tui.ConnStateConnected, st.State)
+	assert.Nil(t, st.Err)
+}
+
+func TestIsRestarted(t *testing.T) {
+	tests := []struct {
+		name string
+		prev *stats.Meta
+		cur  *stats.Meta
+		want bool
+	}{
+		{
+			name: "same process",
+			prev: &stats.Meta{PID: 1, CreateTime: 100},
+			cur:  &stats.Meta{PID: 1, CreateTime: 100},
+			want: false,
+		},
+		{
+			name: "different PID",
+			prev: &stats.Meta{PID: 1, CreateTime: 100},
+			cur:  &stats.Meta{PID: 2, CreateTime: 200},
+			want: true,
+		},
+		{
+			name: "PID reused",
+			prev: &stats.Meta{PID: 1, CreateTime: 100},
+			cur:  &stats.Meta{PID: 1, CreateTime: 200},
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := isRestarted(tt.prev, tt.cur)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestTargetName(t *testing.T) {
+	tests := []struct {
+		name string
+		addr net.Addr
+		meta *stats.Meta
+		want string
+	}{
+		{
+			name: "local process",
+			addr: &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 8080},
+			meta: &stats.Meta{PID: 15788, Command: "/path/to/foo --bar"},
+			want: "foo(15788)",
+		},
+		{
+			name: "unix domain socket",
+			addr: &net.UnixAddr{Name: "/path/to/15788.sock", Net: "unix"},
+			meta: &stats.Meta{PID: 15788, Command: "foo"},
+			want: "foo(15788)",
+		},
+		{
+			name: "remote process",
+			addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 9090},
+			meta: &stats.Meta{PID: 1, Command: "/foo"},
+			want: "foo@10.0.0.1:9090",
+		},
+		{
+			name: "remote host name",
+			addr: HostAddr("host.xz:9090"),
+			meta: &stats.Meta{PID: 1, Command: "/foo"},
+			want: "foo@host.xz:9090",
+		},
+		{
+			name: "localhost",
+			addr: HostAddr("localhost:9090"),
+			meta: &stats.Meta{PID: 15788, Command: "/foo"},
+			want: "foo(15788)",
+		},
+		{
+			name: "unknown command",
+			addr: &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 8080},
+			meta: &stats.Meta{PID: 15788},
+			want: "?(15788)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := targetName(tt.addr, tt.meta)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package diagnoser
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nakabonne/gosivy/stats"
+)
+
+// profiler captures profiles from the target over a connection of its own,
+// so that the scraping isn't held up while the CPU is profiled.
+// It implements tui.Profiler.
+type profiler struct {
+	target   Target
+	dialOpts DialOptions
+}
+
+// Profile implements tui.Profiler.
+func (p *profiler) Profile(ctx context.Context, req stats.ProfileRequest) ([]byte, error) {
+	var b []byte
+	err := p.withClient(ctx, stats.SignalProfile, func(c *client) (err error) {
+		b, err = c.profile(&req)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to capture %s profile: %w", req.Name, err)
+	}
+	return b, nil
+}
+
+// Goroutines implements tui.Profiler.
+func (p *profiler) Goroutines(ctx context.Context) ([]*stats.GoroutineGroup, error) {
+	var groups []*stats.GoroutineGroup
+	err := p.withClient(ctx, stats.SignalGoroutines, func(c *client) (err error) {
+		groups, err = c.goroutines()
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to dump goroutines: %w", err)
+	}
+	return groups, nil
+}
+
+// Trace implements tui.Profiler.
+func (p *profiler) Trace(ctx context.Context, d time.Duration) (*stats.TraceReply, error) {
+	var reply *stats.TraceReply
+	err := p.withClient(ctx, stats.SignalTrace, func(c *client) (err error) {
+		reply, err = c.trace(d)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to capture trace: %w", err)
+	}
+	return reply, nil
+}
+
+// withClient connects to the agent supporting the given signal, and then calls f.
+// The connection is closed once the context is done, which unblocks f.
+func (p *profiler) withClient(ctx context.Context, sig byte, f func(c *client) error) error {
+	addr := p.target.Addr
+	if p.target.Resolve != nil {
+		a, err := p.target.Resolve()
+		if err != nil {
+			return fmt.Errorf("failed to resolve: %w", err)
+		}
+		addr = a
+	}
+	c, err := dial(addr, p.dialOpts)
+	if err != nil {
+		return err
+	}
+	defer c.close()
+	if !c.supports(sig) {
+		return fmt.Errorf("the agent doesn't support signal %b", sig)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.close()
+		case <-done:
+		}
+	}()
+	err = f(c)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
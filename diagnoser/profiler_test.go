@@ -0,0 +1,85 @@
+package diagnoser
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/nakabonne/gosivy/agent"
+	"github.com/nakabonne/gosivy/stats"
+)
+
+func TestProfile(t *testing.T) {
+	addr := startAgent(t)
+	defer agent.Close()
+
+	tests := []struct {
+		name    string
+		target  Target
+		req     stats.ProfileRequest
+		wantErr bool
+	}{
+		{
+			name:   "cpu",
+			target: Target{Addr: addr},
+			req:    stats.ProfileRequest{Name: stats.ProfileCPU, Duration: 10 * time.Millisecond},
+		},
+		{
+			name:   "heap from the resolved address",
+			target: Target{Resolve: func() (net.Addr, error) { return addr, nil }},
+			req:    stats.ProfileRequest{Name: stats.ProfileHeap},
+		},
+		{
+			name:    "unknown profile",
+			target:  Target{Addr: addr},
+			req:     stats.ProfileRequest{Name: "unknown"},
+			wantErr: true,
+		},
+		{
+			name:    "legacy agent",
+			target:  Target{Addr: startServer()},
+			req:     stats.ProfileRequest{Name: stats.ProfileHeap},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &profiler{target: tt.target}
+			b, err := p.Profile(context.Background(), tt.req)
+			assert.Equal(t, tt.wantErr, err != nil)
+			if !tt.wantErr {
+				assert.NotEmpty(t, b)
+			}
+		})
+	}
+}
+
+func TestGoroutines(t *testing.T) {
+	addr := startAgent(t)
+	defer agent.Close()
+
+	p := &profiler{target: Target{Addr: addr}}
+	groups, err := p.Goroutines(context.Background())
+	assert.Nil(t, err)
+	assert.NotEmpty(t, groups)
+
+	p = &profiler{target: Target{Addr: startServer()}}
+	_, err = p.Goroutines(context.Background())
+	assert.NotNil(t, err)
+}
+
+func TestTrace(t *testing.T) {
+	addr := startAgent(t)
+	defer agent.Close()
+
+	p := &profiler{target: Target{Addr: addr}}
+	reply, err := p.Trace(context.Background(), 50*time.Millisecond)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, reply.Trace)
+
+	_, err = p.Trace(context.Background(), 0)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,111 @@
+package diagnoser
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/nakabonne/gosivy/diagnoser/tui"
+	"github.com/nakabonne/gosivy/stats"
+)
+
+// recorder is a GUI which writes what's scraped to a file instead of drawing it.
+type recorder struct {
+	targets   []*tui.Target
+	w         *stats.RecordWriter
+	logWriter io.Writer
+}
+
+func newRecorder(targets []*tui.Target, w, logWriter io.Writer) *recorder {
+	return &recorder{
+		targets:   targets,
+		w:         stats.NewRecordWriter(w),
+		logWriter: logWriter,
+	}
+}
+
+// Run keeps recording until the context is done or the process gets interrupted.
+func (r *recorder) Run(ctx context.Context) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := r.writeHistory(); err != nil {
+		return err
+	}
+	errCh := make(chan error, len(r.targets))
+	for _, target := range r.targets {
+		go func(target *tui.Target) {
+			errCh <- r.record(ctx, target)
+		}(target)
+	}
+	select {
+	case <-ctx.Done():
+		return nil
+	case err := <-errCh:
+		return err
+	}
+}
+
+// writeHistory writes the metadata of the targets along with the samples kept before
+// attaching, in order of time. The metadata is dated back to the oldest sample so that
+// it comes before the samples of the target.
+func (r *recorder) writeHistory() error {
+	now := time.Now()
+	var records []*stats.Record
+	for _, target := range r.targets {
+		meta := target.Metadata
+		at := now
+		if len(target.History) > 0 && target.History[0].Time.Before(at) {
+			at = target.History[0].Time
+		}
+		records = append(records, &stats.Record{Time: at, Target: target.Name, Meta: &meta})
+		for _, rec := range target.History {
+			records = append(records, &stats.Record{Time: rec.Time, Target: target.Name, Stats: rec.Stats})
+		}
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Time.Before(records[j].Time)
+	})
+	for _, rec := range records {
+		if err := r.w.Write(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// record writes what's received from the given target until the context is done.
+func (r *recorder) record(ctx context.Context, target *tui.Target) error {
+	state := tui.ConnStateConnected
+	for {
+		var rec *stats.Record
+		select {
+		case <-ctx.Done():
+			return nil
+		case s := <-target.StatsCh:
+			rec = &stats.Record{Time: s.Time, Target: target.Name, Stats: s.Stats}
+		case m := <-target.MetaCh:
+			fmt.Fprintf(r.logWriter, "%s: process restarted as %d\n", target.Name, m.PID)
+			rec = &stats.Record{Time: time.Now(), Target: target.Name, Meta: m}
+		case status := <-target.StatusCh:
+			if status.State == state {
+				continue
+			}
+			state = status.State
+			if status.Err != nil && state != tui.ConnStateConnected {
+				fmt.Fprintf(r.logWriter, "%s: %v: %v\n", target.Name, state, status.Err)
+			} else {
+				fmt.Fprintf(r.logWriter, "%s: %v\n", target.Name, state)
+			}
+			continue
+		}
+		if err := r.w.Write(rec); err != nil {
+			return err
+		}
+	}
+}
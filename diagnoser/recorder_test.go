@@ -0,0 +1,126 @@
+package diagnoser
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/nakabonne/gosivy/diagnoser/tui"
+	"github.com/nakabonne/gosivy/stats"
+)
+
+func TestRecorder(t *testing.T) {
+	statsCh := make(chan *stats.Record)
+	metaCh := make(chan *stats.Meta)
+	statusCh := make(chan tui.Status)
+	target := &tui.Target{
+		Name:     "foo(1)",
+		StatsCh:  statsCh,
+		Metadata: stats.Meta{PID: 1},
+		MetaCh:   metaCh,
+		StatusCh: statusCh,
+	}
+	var out, log bytes.Buffer
+	r := newRecorder([]*tui.Target{target}, &out, &log)
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error)
+	go func() {
+		errCh <- r.Run(ctx)
+	}()
+
+	statsCh <- &stats.Record{Time: time.Now(), Stats: &stats.Stats{Goroutines: 1}}
+	statusCh <- tui.Status{State: tui.ConnStateReconnecting, Err: errors.New("failed to dial")}
+	statsCh <- &stats.Record{Time: time.Now()}
+	metaCh <- &stats.Meta{PID: 2}
+	statusCh <- tui.Status{State: tui.ConnStateConnected}
+	statsCh <- &stats.Record{Time: time.Now(), Stats: &stats.Stats{Goroutines: 2}}
+	// Wait for the last sample to be written.
+	statusCh <- tui.Status{State: tui.ConnStateConnected}
+	cancel()
+	assert.Nil(t, <-errCh)
+
+	reader := stats.NewRecordReader(&out)
+	var records []*stats.Record
+	for {
+		rec, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		assert.Nil(t, err)
+		assert.Equal(t, "foo(1)", rec.Target)
+		records = append(records, rec)
+	}
+	assert.Len(t, records, 5)
+	assert.Equal(t, 1, records[0].Meta.PID)
+	assert.Equal(t, 1, records[1].Stats.Goroutines)
+	// The missed sample.
+	assert.Nil(t, records[2].Meta)
+	assert.Nil(t, records[2].Stats)
+	assert.Equal(t, 2, records[3].Meta.PID)
+	assert.Equal(t, 2, records[4].Stats.Goroutines)
+
+	assert.Equal(t, "foo(1): Reconnecting: failed to dial\nfoo(1): process restarted as 2\nfoo(1): Connected\n", log.String())
+}
+
+func TestRecorderWritesHistory(t *testing.T) {
+	out := recordHistory(t)
+
+	reader := stats.NewRecordReader(out)
+	var records []*stats.Record
+	for {
+		rec, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		assert.Nil(t, err)
+		records = append(records, rec)
+	}
+	assert.Len(t, records, 5)
+	for i, rec := range records {
+		if i > 0 {
+			assert.False(t, rec.Time.Before(records[i-1].Time))
+		}
+	}
+	// The metadata comes before the samples of each target.
+	assert.Equal(t, "foo(1)", records[0].Target)
+	assert.Equal(t, 1, records[0].Meta.PID)
+	assert.Equal(t, 1, records[1].Stats.Goroutines)
+	assert.Equal(t, "bar(2)", records[2].Target)
+	assert.Equal(t, 2, records[2].Meta.PID)
+	assert.Equal(t, 2, records[3].Stats.Goroutines)
+	assert.Equal(t, 3, records[4].Stats.Goroutines)
+}
+
+// recordHistory gives back the recording of two targets with the samples kept before
+// attaching, which are taken every second from 15:04:06 in turn.
+func recordHistory(t *testing.T) *bytes.Buffer {
+	start := time.Date(2021, 1, 2, 15, 4, 5, 0, time.Local)
+	targets := []*tui.Target{
+		{
+			Name:     "foo(1)",
+			StatsCh:  make(chan *stats.Record),
+			Metadata: stats.Meta{PID: 1},
+			History: []*stats.Record{
+				{Time: start.Add(time.Second), Stats: &stats.Stats{Goroutines: 1}},
+				{Time: start.Add(3 * time.Second), Stats: &stats.Stats{Goroutines: 3}},
+			},
+		},
+		{
+			Name:     "bar(2)",
+			StatsCh:  make(chan *stats.Record),
+			Metadata: stats.Meta{PID: 2},
+			History:  []*stats.Record{{Time: start.Add(2 * time.Second), Stats: &stats.Stats{Goroutines: 2}}},
+		},
+	}
+	var out, log bytes.Buffer
+	r := newRecorder(targets, &out, &log)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Nil(t, r.Run(ctx))
+	return &out
+}
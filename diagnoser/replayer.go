@@ -0,0 +1,332 @@
+package diagnoser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nakabonne/gosivy/diagnoser/tui"
+	"github.com/nakabonne/gosivy/stats"
+)
+
+const (
+	// The longest time to wait between samples, so that the playback doesn't stall
+	// at the gap between recording sessions appended to the same file.
+	maxReplayGap = 5 * time.Second
+	minSpeed     = 1.0 / 16
+	maxSpeed     = 64.0
+)
+
+// replayer feeds the recorded samples to the GUI as if they were scraped.
+// It implements tui.Player.
+type replayer struct {
+	targets []*tui.Target
+	// Channels to feed each target, keyed by the name.
+	channels map[string]*replayChannels
+	// The records to be fed, without the first metadata of each target.
+	records []*stats.Record
+	// How often the samples were scraped.
+	interval time.Duration
+	gui      GUI
+
+	mu sync.Mutex
+	// The number of records fed so far.
+	pos int
+	// The number of records to be fed, which differs from pos only while moving.
+	dest int
+	// Counts the moves requested, to tell if dest was changed while feeding.
+	moves  int
+	paused bool
+	speed  float64
+	// Wakes the playback up on every control.
+	wake chan struct{}
+}
+
+type replayChannels struct {
+	statsCh chan *stats.Record
+	metaCh  chan *stats.Meta
+	resetCh chan struct{}
+}
+
+// NewReplayer gives back a diagnoser which replays the recording read from r.
+// See stats.Record for the format.
+func NewReplayer(r io.Reader, gui GUI) (Diagnoser, error) {
+	rp := &replayer{
+		channels: make(map[string]*replayChannels),
+		gui:      gui,
+		speed:    1,
+		wake:     make(chan struct{}, 1),
+	}
+	reader := stats.NewRecordReader(r)
+	for {
+		rec, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := rp.channels[rec.Target]; ok {
+			rp.records = append(rp.records, rec)
+			continue
+		}
+		if rec.Meta == nil {
+			return nil, fmt.Errorf("no metadata recorded before the samples of %q", rec.Target)
+		}
+		ch := &replayChannels{
+			statsCh: make(chan *stats.Record),
+			metaCh:  make(chan *stats.Meta),
+			resetCh: make(chan struct{}),
+		}
+		rp.channels[rec.Target] = ch
+		rp.targets = append(rp.targets, &tui.Target{
+			Name:     rec.Target,
+			StatsCh:  ch.statsCh,
+			Metadata: *rec.Meta,
+			MetaCh:   ch.metaCh,
+			ResetCh:  ch.resetCh,
+		})
+	}
+	if len(rp.targets) == 0 {
+		return nil, fmt.Errorf("nothing recorded")
+	}
+	// The samples pushed in a batch are recorded after the newer ones of the
+	// other targets, whereas seeking requires them to be sorted by time.
+	sort.SliceStable(rp.records, func(i, j int) bool {
+		return rp.records[i].Time.Before(rp.records[j].Time)
+	})
+	rp.interval = recordedInterval(rp.records)
+	return rp, nil
+}
+
+// Run starts the playback, and then draws the charts.
+func (r *replayer) Run() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if r.gui == nil {
+		g := tui.NewTUI(r.interval, cancel, r.targets)
+		g.Player = r
+		r.gui = g
+	}
+	go r.play(ctx)
+	return r.gui.Run(ctx)
+}
+
+// play keeps feeding the records at the recorded pace until the context is done.
+func (r *replayer) play(ctx context.Context) {
+	for {
+		r.mu.Lock()
+		pos, dest, moves, paused, speed := r.pos, r.dest, r.moves, r.paused, r.speed
+		r.mu.Unlock()
+
+		switch {
+		case dest < pos:
+			// The charts can't go back, hence redraw them from the beginning.
+			for _, ch := range r.channels {
+				select {
+				case ch.resetCh <- struct{}{}:
+				case <-ctx.Done():
+					return
+				}
+			}
+			r.mu.Lock()
+			r.pos = 0
+			r.mu.Unlock()
+			continue
+		case dest > pos:
+			// Move without waiting.
+		case paused || pos >= len(r.records):
+			select {
+			case <-ctx.Done():
+				return
+			case <-r.wake:
+			}
+			continue
+		default:
+			var wait time.Duration
+			if pos > 0 {
+				wait = r.records[pos].Time.Sub(r.records[pos-1].Time)
+				if wait > maxReplayGap {
+					wait = maxReplayGap
+				}
+				wait = time.Duration(float64(wait) / speed)
+			}
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-r.wake:
+				// Start over in case the playback was controlled.
+				timer.Stop()
+				continue
+			case <-timer.C:
+			}
+		}
+
+		if err := r.feed(ctx, r.records[pos]); err != nil {
+			return
+		}
+		r.mu.Lock()
+		r.pos = pos + 1
+		if r.moves == moves && r.dest == pos {
+			// Keep playing.
+			r.dest = pos + 1
+		}
+		r.mu.Unlock()
+	}
+}
+
+// feed sends the given record to its target.
+func (r *replayer) feed(ctx context.Context, rec *stats.Record) error {
+	ch := r.channels[rec.Target]
+	if rec.Meta != nil {
+		select {
+		case ch.metaCh <- rec.Meta:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	select {
+	case ch.statsCh <- rec:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// moveTo changes the destination of the playback. The caller must hold mu.
+func (r *replayer) moveTo(dest int) {
+	if dest < 0 {
+		dest = 0
+	}
+	if dest > len(r.records) {
+		dest = len(r.records)
+	}
+	r.dest = dest
+	r.moves++
+	r.notify()
+}
+
+// notify wakes the playback up without blocking.
+func (r *replayer) notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// TogglePause implements tui.Player.
+func (r *replayer) TogglePause() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.paused = !r.paused
+	r.notify()
+}
+
+// Step implements tui.Player.
+func (r *replayer) Step(n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.paused = true
+	r.moveTo(r.dest + n)
+}
+
+// Rewind implements tui.Player.
+func (r *replayer) Rewind() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.moveTo(0)
+}
+
+// Seek implements tui.Player. The time of day is regarded as the one in the local time zone
+// on the day the recording started, or the next day if it's earlier than the start.
+func (r *replayer) Seek(clock time.Duration) error {
+	if len(r.records) == 0 {
+		return fmt.Errorf("no sample recorded")
+	}
+	start := r.records[0].Time.Local()
+	t := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.Local).Add(clock)
+	if t.Before(start) {
+		t = t.AddDate(0, 0, 1)
+	}
+	i := sort.Search(len(r.records), func(i int) bool {
+		return !r.records[i].Time.Before(t)
+	})
+	if i == len(r.records) {
+		return fmt.Errorf("no sample recorded at or after %s", t.Format("15:04:05"))
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.moveTo(i + 1)
+	return nil
+}
+
+// Faster implements tui.Player.
+func (r *replayer) Faster() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.speed < maxSpeed {
+		r.speed *= 2
+	}
+	r.notify()
+}
+
+// Slower implements tui.Player.
+func (r *replayer) Slower() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.speed > minSpeed {
+		r.speed /= 2
+	}
+	r.notify()
+}
+
+// State implements tui.Player.
+func (r *replayer) State() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	state := "▶ Playing"
+	switch {
+	case r.paused:
+		state = "❚❚ Paused"
+	case r.pos >= len(r.records):
+		state = "■ Finished"
+	}
+	at := "-"
+	if r.pos > 0 {
+		at = r.records[r.pos-1].Time.Local().Format("2006-01-02 15:04:05")
+	}
+	return fmt.Sprintf("%s %gx | %s | %d/%d", state, r.speed, at, r.pos, len(r.records))
+}
+
+// recordedInterval estimates how often the samples were scraped,
+// which is the median of the intervals between the records of the same target.
+func recordedInterval(records []*stats.Record) time.Duration {
+	const defaultInterval = time.Second
+	prev := make(map[string]time.Time)
+	intervals := make([]time.Duration, 0, len(records))
+	for _, rec := range records {
+		if rec.Meta != nil {
+			continue
+		}
+		if t, ok := prev[rec.Target]; ok {
+			intervals = append(intervals, rec.Time.Sub(t))
+		}
+		prev[rec.Target] = rec.Time
+	}
+	if len(intervals) == 0 {
+		return defaultInterval
+	}
+	sort.Slice(intervals, func(i, j int) bool { return intervals[i] < intervals[j] })
+	if d := intervals[len(intervals)/2]; d > 0 {
+		return d
+	}
+	return defaultInterval
+}
@@ -0,0 +1,169 @@
+package diagnoser
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/nakabonne/gosivy/stats"
+)
+
+// recording gives back a recording of a process taken every second from 15:04:05.
+func recording(t *testing.T, samples ...*stats.Stats) *bytes.Buffer {
+	start := time.Date(2021, 1, 2, 15, 4, 5, 0, time.Local)
+	var buf bytes.Buffer
+	w := stats.NewRecordWriter(&buf)
+	assert.Nil(t, w.Write(&stats.Record{Time: start, Target: "foo(1)", Meta: &stats.Meta{PID: 1}}))
+	for i, s := range samples {
+		assert.Nil(t, w.Write(&stats.Record{Time: start.Add(time.Duration(i+1) * time.Second), Target: "foo(1)", Stats: s}))
+	}
+	return &buf
+}
+
+func TestNewReplayer(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		wantErr bool
+	}{
+		{
+			name:    "nothing recorded",
+			in:      "",
+			wantErr: true,
+		},
+		{
+			name:    "samples without metadata",
+			in:      `{"Time":"2021-01-02T15:04:05Z","Target":"foo(1)","Stats":{}}`,
+			wantErr: true,
+		},
+		{
+			name:    "malformed",
+			in:      `{"Time":`,
+			wantErr: true,
+		},
+		{
+			name:    "metadata only",
+			in:      `{"Time":"2021-01-02T15:04:05Z","Target":"foo(1)","Meta":{"PID":1}}`,
+			wantErr: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewReplayer(strings.NewReader(tt.in), nil)
+			assert.Equal(t, tt.wantErr, err != nil)
+		})
+	}
+}
+
+func TestReplayerRun(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	m := NewMockGUI(ctrl)
+	m.EXPECT().Run(gomock.Any())
+	d, err := NewReplayer(recording(t, &stats.Stats{}), m)
+	assert.Nil(t, err)
+	assert.Nil(t, d.Run())
+}
+
+func TestReplayerControl(t *testing.T) {
+	d, err := NewReplayer(recording(t,
+		&stats.Stats{Goroutines: 1},
+		nil,
+		&stats.Stats{Goroutines: 3},
+	), nil)
+	assert.Nil(t, err)
+	r := d.(*replayer)
+	assert.Len(t, r.targets, 1)
+	assert.Equal(t, 1, r.targets[0].Metadata.PID)
+	assert.Equal(t, time.Second, r.interval)
+	ch := r.channels["foo(1)"]
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r.TogglePause()
+	go r.play(ctx)
+
+	r.Step(2)
+	assert.Equal(t, 1, (<-ch.statsCh).Stats.Goroutines)
+	assert.Nil(t, (<-ch.statsCh).Stats)
+
+	// Going back starts over from the beginning.
+	r.Step(-1)
+	<-ch.resetCh
+	assert.Equal(t, 1, (<-ch.statsCh).Stats.Goroutines)
+
+	assert.Nil(t, r.Seek(15*time.Hour+4*time.Minute+8*time.Second))
+	assert.Nil(t, (<-ch.statsCh).Stats)
+	assert.Equal(t, 3, (<-ch.statsCh).Stats.Goroutines)
+	assert.NotNil(t, r.Seek(15*time.Hour+4*time.Minute+9*time.Second))
+
+	r.Faster()
+	assert.Eventually(t, func() bool {
+		return r.State() == "❚❚ Paused 2x | 2021-01-02 15:04:08 | 3/3"
+	}, time.Second, 10*time.Millisecond)
+
+	// Plays from the beginning after rewinding.
+	r.Rewind()
+	r.TogglePause()
+	<-ch.resetCh
+	assert.Equal(t, 1, (<-ch.statsCh).Stats.Goroutines)
+}
+
+func TestReplayerSeekHistory(t *testing.T) {
+	d, err := NewReplayer(recordHistory(t), nil)
+	assert.Nil(t, err)
+	r := d.(*replayer)
+	assert.Len(t, r.targets, 2)
+	foo, bar := r.channels["foo(1)"], r.channels["bar(2)"]
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r.TogglePause()
+	go r.play(ctx)
+
+	assert.Nil(t, r.Seek(15*time.Hour+4*time.Minute+7*time.Second))
+	assert.Equal(t, 1, (<-foo.statsCh).Stats.Goroutines)
+	assert.Equal(t, 2, (<-bar.statsCh).Stats.Goroutines)
+	assert.Eventually(t, func() bool {
+		return r.State() == "❚❚ Paused 1x | 2021-01-02 15:04:07 | 2/3"
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestRecordedInterval(t *testing.T) {
+	start := time.Date(2021, 1, 2, 15, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name    string
+		records []*stats.Record
+		want    time.Duration
+	}{
+		{
+			name: "no samples",
+			want: time.Second,
+		},
+		{
+			name: "interleaved targets",
+			records: []*stats.Record{
+				{Time: start, Target: "a"},
+				{Time: start.Add(100 * time.Millisecond), Target: "b"},
+				{Time: start.Add(500 * time.Millisecond), Target: "a"},
+				{Time: start.Add(600 * time.Millisecond), Target: "b"},
+				{Time: start.Add(time.Second), Target: "a"},
+				// Appended by another recording session.
+				{Time: start.Add(time.Hour), Target: "a"},
+			},
+			want: 500 * time.Millisecond,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := recordedInterval(tt.records)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package tui
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/nakabonne/gosivy/stats"
+)
+
+// exportTimeout is how long to wait for the series to be handed over.
+const exportTimeout = time.Second
+
+// sessionExport is the series drawn so far, dumped by the export keybind.
+type sessionExport struct {
+	// The metadata of the latest process.
+	Meta stats.Meta
+	// When each sample was taken.
+	Times []time.Time
+	// The series keyed by the name, whose values correspond to Times.
+	// Missed values are null.
+	Series map[string]nullableFloats
+}
+
+// newSessionExport copies the given series so that they can be
+// read while the originals keep growing.
+func newSessionExport(meta *stats.Meta, times []time.Time, series map[string][]float64) *sessionExport {
+	e := &sessionExport{
+		Meta:   *meta,
+		Times:  append([]time.Time{}, times...),
+		Series: make(map[string]nullableFloats, len(series)),
+	}
+	for name, vs := range series {
+		e.Series[name] = append(nullableFloats{}, vs...)
+	}
+	return e
+}
+
+// nullableFloats is encoded into JSON with NaN as null, which JSON can't represent.
+type nullableFloats []float64
+
+func (fs nullableFloats) MarshalJSON() ([]byte, error) {
+	b := make([]byte, 0, len(fs)*8)
+	b = append(b, '[')
+	for i, f := range fs {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			b = append(b, "null"...)
+			continue
+		}
+		b = strconv.AppendFloat(b, f, 'g', -1, 64)
+	}
+	return append(b, ']'), nil
+}
+
+// export dumps the series of the target currently shown into a JSON file
+// in the working directory, and gives back the path.
+func (g *TUI) export() (string, error) {
+	g.mu.Lock()
+	target := g.Targets[g.current]
+	g.mu.Unlock()
+
+	resCh := make(chan *sessionExport, 1)
+	select {
+	case target.exportCh <- resCh:
+	case <-time.After(exportTimeout):
+		return "", fmt.Errorf("timed out to collect the series")
+	}
+	e := <-resCh
+	b, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode the series: %w", err)
+	}
+	path := fmt.Sprintf("gosivy-%d-%s.json", e.Meta.PID, time.Now().Format("20060102-150405"))
+	if err := ioutil.WriteFile(path, b, 0644); err != nil {
+		return "", fmt.Errorf("failed to write the series: %w", err)
+	}
+	return path, nil
+}
+
+// exportAndNotify exports the series, and then shows the result in the title.
+func (g *TUI) exportAndNotify() {
+	path, err := g.export()
+	if err != nil {
+		g.setNotice(err.Error())
+		return
+	}
+	g.setNotice("Exported to " + path)
+}
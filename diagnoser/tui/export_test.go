@@ -0,0 +1,82 @@
+package tui
+
+import (
+	"context"
+	"encoding/json"
+	"image"
+	"io/ioutil"
+	"math"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mum4k/termdash"
+	"github.com/mum4k/termdash/container"
+	"github.com/mum4k/termdash/private/faketerm"
+	"github.com/mum4k/termdash/terminal/terminalapi"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/nakabonne/gosivy/stats"
+)
+
+func TestExport(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	assert.Nil(t, err)
+	assert.Nil(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	statsCh := make(chan *stats.Record)
+	meta := stats.Meta{
+		PID:           15788,
+		CustomMetrics: []stats.CustomMetric{{Name: "queue-depth", Kind: stats.CustomMetricGauge}},
+	}
+	g := NewTUI(0, cancel, []*Target{{Name: "a", StatsCh: statsCh, Metadata: meta}})
+	term, err := faketerm.New(image.Point{X: 200, Y: 100})
+	assert.Nil(t, err)
+	err = g.run(ctx, term, func(context.Context, terminalapi.Terminal, *container.Container, ...termdash.Option) error {
+		return nil
+	})
+	assert.Nil(t, err)
+
+	// The samples pushed in a batch arrive at once.
+	start := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	statsCh <- &stats.Record{Time: start, Stats: &stats.Stats{CPUUsage: 10, CustomMetrics: map[string]float64{"queue-depth": 3}}}
+	statsCh <- &stats.Record{Time: start.Add(time.Second)}
+	statsCh <- &stats.Record{Time: start.Add(2 * time.Second), Stats: &stats.Stats{CPUUsage: 20, CustomMetrics: map[string]float64{"queue-depth": 4}}}
+
+	path, err := g.export()
+	assert.Nil(t, err)
+	b, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	var got struct {
+		Meta   stats.Meta
+		Times  []time.Time
+		Series map[string][]*float64
+	}
+	assert.Nil(t, json.Unmarshal(b, &got))
+	assert.Equal(t, 15788, got.Meta.PID)
+	assert.Equal(t, []time.Time{start, start.Add(time.Second), start.Add(2 * time.Second)}, got.Times)
+	for name, vs := range got.Series {
+		assert.Len(t, vs, 3, name)
+		// The missed sample.
+		assert.Nil(t, vs[1], name)
+	}
+	cpu := got.Series["cpu-usage-percent"]
+	assert.Equal(t, 10.0, *cpu[0])
+	assert.Equal(t, 20.0, *cpu[2])
+	assert.Equal(t, 4.0, *got.Series["custom:queue-depth"][2])
+	// No GC cycle to compare with.
+	assert.Nil(t, got.Series["gc-pause-ms"][0])
+
+	g.exportAndNotify()
+	assert.Contains(t, g.notice, "Exported to gosivy-15788-")
+}
+
+func TestNullableFloatsMarshalJSON(t *testing.T) {
+	b, err := json.Marshal(nullableFloats{1, math.NaN(), 2.5, math.Inf(1)})
+	assert.Nil(t, err)
+	assert.Equal(t, "[1,null,2.5,null]", string(b))
+}
@@ -0,0 +1,323 @@
+package tui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mum4k/termdash/cell"
+	"github.com/mum4k/termdash/keyboard"
+	"github.com/mum4k/termdash/private/canvas"
+	"github.com/mum4k/termdash/private/draw"
+	"github.com/mum4k/termdash/terminal/terminalapi"
+	"github.com/mum4k/termdash/widgetapi"
+
+	"github.com/nakabonne/gosivy/stats"
+)
+
+const goroutinesTitle = "Goroutines (D: dump, ↑↓: move, Enter: expand, Esc: close)"
+
+// goroutineEntry is a group of goroutines listed along with the change since the previous dump.
+type goroutineEntry struct {
+	key   string
+	group *stats.GoroutineGroup
+	// How many goroutines the group gained since the previous dump.
+	delta int
+}
+
+// goroutineList lists the goroutines grouped by stack in descending order of the count.
+// It implements GoroutineList.
+type goroutineList struct {
+	mu      sync.Mutex
+	entries []*goroutineEntry
+	// The groups of the last dump keyed by the stack, nil until the first dump.
+	prev map[string]*stats.GoroutineGroup
+	// Whether the last dump was compared with the previous one.
+	compared bool
+	// When the last dump was taken.
+	at     time.Time
+	cursor int
+	// The stacks expanded to show all frames.
+	expanded map[string]bool
+}
+
+func newGoroutineList() *goroutineList {
+	return &goroutineList{
+		expanded: make(map[string]bool),
+	}
+}
+
+// SetDump replaces the list with the given dump while keeping the cursor on the same stack.
+// The groups which have gone since the previous dump are listed with the count 0.
+func (l *goroutineList) SetDump(groups []*stats.GoroutineGroup, at time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Merge the groups whose stacks are the same except for the addresses.
+	cur := make(map[string]*stats.GoroutineGroup, len(groups))
+	for _, g := range groups {
+		key := g.Key()
+		if c, ok := cur[key]; ok {
+			c.Count += g.Count
+			continue
+		}
+		cur[key] = &stats.GoroutineGroup{Count: g.Count, Frames: g.Frames}
+	}
+
+	entries := make([]*goroutineEntry, 0, len(cur))
+	for key, g := range cur {
+		e := &goroutineEntry{key: key, group: g}
+		if l.prev != nil {
+			e.delta = g.Count
+			if p, ok := l.prev[key]; ok {
+				e.delta -= p.Count
+			}
+		}
+		entries = append(entries, e)
+	}
+	for key, p := range l.prev {
+		if _, ok := cur[key]; !ok {
+			entries = append(entries, &goroutineEntry{key: key, group: &stats.GoroutineGroup{Frames: p.Frames}, delta: -p.Count})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.group.Count != b.group.Count {
+			return a.group.Count > b.group.Count
+		}
+		if abs(a.delta) != abs(b.delta) {
+			return abs(a.delta) > abs(b.delta)
+		}
+		return a.key < b.key
+	})
+
+	var current string
+	if l.cursor < len(l.entries) {
+		current = l.entries[l.cursor].key
+	}
+	l.cursor = 0
+	for i, e := range entries {
+		if e.key == current {
+			l.cursor = i
+			break
+		}
+	}
+	l.entries = entries
+	l.compared = l.prev != nil
+	l.prev = cur
+	l.at = at
+}
+
+// Up moves the cursor to the previous stack.
+func (l *goroutineList) Up() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.cursor > 0 {
+		l.cursor--
+	}
+}
+
+// Down moves the cursor to the next stack.
+func (l *goroutineList) Down() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.cursor < len(l.entries)-1 {
+		l.cursor++
+	}
+}
+
+// Toggle expands the stack under the cursor, or collapses it if already expanded.
+func (l *goroutineList) Toggle() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.cursor >= len(l.entries) {
+		return
+	}
+	key := l.entries[l.cursor].key
+	l.expanded[key] = !l.expanded[key]
+}
+
+// goroutineLine is a line drawn on the list.
+type goroutineLine struct {
+	text string
+	opts []cell.Option
+}
+
+// lines gives back the lines of the list, along with the index of the line under the cursor.
+// The caller must hold mu.
+func (l *goroutineList) lines() ([]goroutineLine, int) {
+	if l.prev == nil {
+		return []goroutineLine{{text: "Press D to dump the goroutines"}}, 0
+	}
+	var total, totalDelta int
+	for _, e := range l.entries {
+		total += e.group.Count
+		totalDelta += e.delta
+	}
+	header := fmt.Sprintf("Total: %d | Dumped at %s", total, l.at.Format("15:04:05"))
+	if l.compared {
+		header = fmt.Sprintf("Total: %d (%s) | Dumped at %s", total, formatDelta(totalDelta), l.at.Format("15:04:05"))
+	}
+	lines := []goroutineLine{{text: header}}
+	cursorLine := 0
+	for i, e := range l.entries {
+		marker := "▸"
+		if l.expanded[e.key] {
+			marker = "▾"
+		}
+		top := "(no frame)"
+		if len(e.group.Frames) > 0 {
+			f := e.group.Frames[0]
+			top = fmt.Sprintf("%s (%s:%d)", f.Func, f.File, f.Line)
+		}
+		var opts []cell.Option
+		switch {
+		case e.delta > 0:
+			opts = append(opts, cell.FgColor(cell.ColorRed))
+		case e.delta < 0:
+			opts = append(opts, cell.FgColor(cell.ColorGreen))
+		}
+		if i == l.cursor {
+			opts = append(opts, cell.BgColor(cell.ColorNumber(238)))
+			cursorLine = len(lines)
+		}
+		delta := ""
+		if l.compared {
+			delta = formatDelta(e.delta)
+		}
+		lines = append(lines, goroutineLine{text: fmt.Sprintf("%s %7d %7s  %s", marker, e.group.Count, delta, top), opts: opts})
+		if !l.expanded[e.key] {
+			continue
+		}
+		for _, f := range e.group.Frames {
+			lines = append(lines,
+				goroutineLine{text: "      " + f.Func},
+				goroutineLine{text: fmt.Sprintf("          %s:%d", f.File, f.Line)},
+			)
+		}
+	}
+	return lines, cursorLine
+}
+
+// Draw implements widgetapi.Widget.Draw.
+func (l *goroutineList) Draw(cvs *canvas.Canvas, _ *widgetapi.Meta) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ar := cvs.Area()
+	if ar.Dy() == 0 {
+		return nil
+	}
+	lines, cursorLine := l.lines()
+	// Scroll so that the cursor is always visible, while the first line stays as the header.
+	start := 1
+	if cursorLine >= ar.Dy() {
+		start = cursorLine - ar.Dy() + 2
+	}
+	visible := append(lines[:1:1], lines[min(start, len(lines)):]...)
+	for i, line := range visible {
+		if i >= ar.Dy() {
+			break
+		}
+		p := image.Point{X: ar.Min.X, Y: ar.Min.Y + i}
+		if err := draw.Text(cvs, line.text, p, draw.TextCellOpts(line.opts...), draw.TextMaxX(ar.Max.X), draw.TextOverrunMode(draw.OverrunModeThreeDot)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Keyboard implements widgetapi.Widget.Keyboard.
+func (l *goroutineList) Keyboard(_ *terminalapi.Keyboard) error {
+	return errors.New("the goroutine list is operated via the global keybinds")
+}
+
+// Mouse implements widgetapi.Widget.Mouse.
+func (l *goroutineList) Mouse(_ *terminalapi.Mouse) error {
+	return errors.New("the goroutine list doesn't support mouse events")
+}
+
+// Options implements widgetapi.Widget.Options.
+func (l *goroutineList) Options() widgetapi.Options {
+	return widgetapi.Options{
+		MinimumSize: image.Point{X: 1, Y: 1},
+	}
+}
+
+func formatDelta(d int) string {
+	if d == 0 {
+		return "±0"
+	}
+	return fmt.Sprintf("%+d", d)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// goroutineKeybind opens the goroutine pane and operates it, and tells if the key was consumed.
+func (g *TUI) goroutineKeybind(ctx context.Context, k *terminalapi.Keyboard) bool {
+	g.mu.Lock()
+	shown := g.pane == paneGoroutines
+	g.mu.Unlock()
+	if !shown {
+		if k.Key != 'd' {
+			return false
+		}
+		g.showPane(paneGoroutines)
+		go g.dumpGoroutines(ctx)
+		return true
+	}
+	switch k.Key {
+	case 'd':
+		go g.dumpGoroutines(ctx)
+	case keyboard.KeyArrowUp, 'k':
+		g.currentWidgets().Goroutines.Up()
+	case keyboard.KeyArrowDown, 'j':
+		g.currentWidgets().Goroutines.Down()
+	case keyboard.KeyEnter, keyboard.KeySpace:
+		g.currentWidgets().Goroutines.Toggle()
+	case keyboard.KeyEsc:
+		g.showPane(paneCharts)
+	default:
+		return false
+	}
+	return true
+}
+
+// dumpGoroutines shows the goroutines of the target currently shown.
+func (g *TUI) dumpGoroutines(ctx context.Context) {
+	g.mu.Lock()
+	target := g.Targets[g.current]
+	g.mu.Unlock()
+	if target.Profiler == nil {
+		g.setNotice("Goroutine dump is unavailable")
+		return
+	}
+	groups, err := target.Profiler.Goroutines(ctx)
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		g.setNotice(err.Error())
+		return
+	}
+	g.mu.Lock()
+	w := target.widgets
+	g.mu.Unlock()
+	w.Goroutines.SetDump(groups, time.Now())
+}
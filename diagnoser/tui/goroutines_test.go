@@ -0,0 +1,120 @@
+package tui
+
+import (
+	"context"
+	"image"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mum4k/termdash"
+	"github.com/mum4k/termdash/container"
+	"github.com/mum4k/termdash/keyboard"
+	"github.com/mum4k/termdash/private/canvas"
+	"github.com/mum4k/termdash/private/faketerm"
+	"github.com/mum4k/termdash/terminal/terminalapi"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/nakabonne/gosivy/stats"
+)
+
+func goroutineGroup(count int, funcs ...string) *stats.GoroutineGroup {
+	g := &stats.GoroutineGroup{Count: count}
+	for i, f := range funcs {
+		g.Frames = append(g.Frames, stats.Frame{Func: f, File: "main.go", Line: i + 1})
+	}
+	return g
+}
+
+func TestGoroutineList(t *testing.T) {
+	l := newGoroutineList()
+	lines, _ := l.lines()
+	assert.Equal(t, "Press D to dump the goroutines", lines[0].text)
+
+	at := time.Date(2021, 1, 2, 15, 4, 5, 0, time.Local)
+	l.SetDump([]*stats.GoroutineGroup{
+		goroutineGroup(1, "main.main"),
+		goroutineGroup(3, "main.worker"),
+		goroutineGroup(2, "main.idle"),
+	}, at)
+	lines, cursorLine := l.lines()
+	texts := make([]string, 0, len(lines))
+	for _, line := range lines {
+		texts = append(texts, line.text)
+	}
+	assert.Equal(t, []string{
+		"Total: 6 | Dumped at 15:04:05",
+		"▸       3          main.worker (main.go:1)",
+		"▸       2          main.idle (main.go:1)",
+		"▸       1          main.main (main.go:1)",
+	}, texts)
+	assert.Equal(t, 1, cursorLine)
+
+	// Move to "main.idle", and then expand it.
+	l.Down()
+	l.Toggle()
+	lines, cursorLine = l.lines()
+	assert.Equal(t, 2, cursorLine)
+	assert.Equal(t, "▾       2          main.idle (main.go:1)", lines[2].text)
+	assert.Equal(t, "      main.idle", lines[3].text)
+	assert.Equal(t, "          main.go:1", lines[4].text)
+
+	// The groups are compared with the previous dump, and the same stacks are merged.
+	l.SetDump([]*stats.GoroutineGroup{
+		goroutineGroup(1, "main.main"),
+		goroutineGroup(4, "main.worker"),
+		goroutineGroup(4, "main.worker"),
+		goroutineGroup(1, "main.leak"),
+	}, at)
+	assert.Len(t, l.entries, 4)
+	got := make(map[string]int, len(l.entries))
+	for _, e := range l.entries {
+		got[e.group.Frames[0].Func] = e.delta
+	}
+	assert.Equal(t, map[string]int{"main.worker": 5, "main.idle": -2, "main.main": 0, "main.leak": 1}, got)
+	assert.Equal(t, "main.worker", l.entries[0].group.Frames[0].Func)
+	// The group gone is listed at the bottom.
+	assert.Equal(t, "main.idle", l.entries[3].group.Frames[0].Func)
+	assert.Equal(t, 0, l.entries[3].group.Count)
+	// The cursor follows the stack.
+	assert.Equal(t, 3, l.cursor)
+	lines, _ = l.lines()
+	assert.Equal(t, "Total: 10 (+4) | Dumped at 15:04:05", lines[0].text)
+	assert.Equal(t, "▸       8      +5  main.worker (main.go:1)", lines[1].text)
+
+	cvs, err := canvas.New(image.Rect(0, 0, 60, 3))
+	assert.Nil(t, err)
+	assert.Nil(t, l.Draw(cvs, nil))
+}
+
+func TestGoroutineKeybind(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := &fakeProfiler{groups: []*stats.GoroutineGroup{goroutineGroup(3, "main.worker")}}
+	g := NewTUI(time.Hour, cancel, []*Target{{Name: "a", Profiler: p}})
+	term, err := faketerm.New(image.Point{X: 200, Y: 100})
+	assert.Nil(t, err)
+	err = g.run(ctx, term, func(context.Context, terminalapi.Terminal, *container.Container, ...termdash.Option) error {
+		return nil
+	})
+	assert.Nil(t, err)
+	k := g.keybinds(ctx)
+	list := g.Targets[0].widgets.Goroutines.(*goroutineList)
+
+	k(&terminalapi.Keyboard{Key: 'd'})
+	assert.Equal(t, paneGoroutines, g.pane)
+	assert.Eventually(t, func() bool {
+		list.mu.Lock()
+		defer list.mu.Unlock()
+		return len(list.entries) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	k(&terminalapi.Keyboard{Key: keyboard.KeyEnter})
+	list.mu.Lock()
+	lines, _ := list.lines()
+	list.mu.Unlock()
+	assert.True(t, strings.HasPrefix(lines[1].text, "▾"))
+
+	k(&terminalapi.Keyboard{Key: keyboard.KeyEsc})
+	assert.Equal(t, paneCharts, g.pane)
+}
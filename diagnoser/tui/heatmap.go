@@ -0,0 +1,184 @@
+package tui
+
+import (
+	"errors"
+	"image"
+	"sync"
+
+	"github.com/mum4k/termdash/cell"
+	"github.com/mum4k/termdash/private/canvas"
+	"github.com/mum4k/termdash/private/draw"
+	"github.com/mum4k/termdash/terminal/terminalapi"
+	"github.com/mum4k/termdash/widgetapi"
+)
+
+// heatmapColors is the scale of colors from the coldest to the hottest.
+var heatmapColors = []cell.Color{
+	cell.ColorNumber(17),
+	cell.ColorNumber(19),
+	cell.ColorNumber(27),
+	cell.ColorNumber(37),
+	cell.ColorNumber(41),
+	cell.ColorNumber(148),
+	cell.ColorNumber(220),
+	cell.ColorNumber(208),
+	cell.ColorNumber(196),
+}
+
+// heatmap draws distributions over time, where the X axis is time
+// and the Y axis is buckets. The color of a cell indicates
+// the share of the bucket in the distribution at that time.
+// It implements Heatmap.
+type heatmap struct {
+	mu sync.Mutex
+	// columns[x][y] is the count of the y-th bucket at the x-th time.
+	columns [][]uint64
+	// Labels for the buckets from the bottom.
+	yLabels []string
+	// Indices of the columns to be marked.
+	marks []int
+}
+
+func newHeatmap() *heatmap {
+	return &heatmap{}
+}
+
+// Values sets the distributions to be drawn. The latest columns are drawn
+// as many as the canvas can hold.
+func (h *heatmap) Values(columns [][]uint64, yLabels []string) error {
+	for _, c := range columns {
+		if len(c) != len(yLabels) {
+			return errors.New("the number of buckets must be equal to the number of labels")
+		}
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.columns = columns
+	h.yLabels = yLabels
+	return nil
+}
+
+// Mark marks the given column with a vertical line.
+func (h *heatmap) Mark(x int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.marks = append(h.marks, x)
+}
+
+// Draw implements widgetapi.Widget.Draw.
+func (h *heatmap) Draw(cvs *canvas.Canvas, _ *widgetapi.Meta) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ar := cvs.Area()
+	if len(h.yLabels) == 0 || ar.Dy() == 0 {
+		return nil
+	}
+	rows := mergeBuckets(len(h.yLabels), ar.Dy())
+
+	labelWidth := 0
+	for _, r := range rows {
+		if w := len(h.yLabels[r.from]); w > labelWidth {
+			labelWidth = w
+		}
+	}
+	for i, r := range rows {
+		y := ar.Max.Y - 1 - i
+		if err := draw.Text(cvs, h.yLabels[r.from], image.Point{X: ar.Min.X, Y: y}, draw.TextMaxX(ar.Min.X+labelWidth)); err != nil {
+			return err
+		}
+	}
+
+	width := ar.Dx() - labelWidth - 1
+	if width <= 0 {
+		return nil
+	}
+	columns := h.columns
+	offset := 0
+	if len(columns) > width {
+		offset = len(columns) - width
+		columns = columns[offset:]
+	}
+	// Right-align the columns so that the latest one always appears at the edge.
+	startX := ar.Max.X - len(columns)
+	for x, col := range columns {
+		var total uint64
+		for _, c := range col {
+			total += c
+		}
+		if total == 0 {
+			continue
+		}
+		for i, r := range rows {
+			var count uint64
+			for _, c := range col[r.from:r.to] {
+				count += c
+			}
+			if count == 0 {
+				continue
+			}
+			share := float64(count) / float64(total)
+			color := heatmapColors[int(share*float64(len(heatmapColors)-1))]
+			p := image.Point{X: startX + x, Y: ar.Max.Y - 1 - i}
+			if _, err := cvs.SetCell(p, ' ', cell.BgColor(color)); err != nil {
+				return err
+			}
+		}
+	}
+	for _, m := range h.marks {
+		if m < offset || m >= offset+len(columns) {
+			continue
+		}
+		for i := range rows {
+			p := image.Point{X: startX + m - offset, Y: ar.Max.Y - 1 - i}
+			cl, err := cvs.Cell(p)
+			if err != nil {
+				return err
+			}
+			// Keep the background so that the distribution is still visible.
+			if _, err := cvs.SetCell(p, markRune, cell.FgColor(markColor), cell.BgColor(cl.Opts.BgColor)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Keyboard implements widgetapi.Widget.Keyboard.
+func (h *heatmap) Keyboard(_ *terminalapi.Keyboard) error {
+	return errors.New("the heatmap doesn't support keyboard events")
+}
+
+// Mouse implements widgetapi.Widget.Mouse.
+func (h *heatmap) Mouse(_ *terminalapi.Mouse) error {
+	return errors.New("the heatmap doesn't support mouse events")
+}
+
+// Options implements widgetapi.Widget.Options.
+func (h *heatmap) Options() widgetapi.Options {
+	return widgetapi.Options{
+		MinimumSize: image.Point{X: 1, Y: 1},
+	}
+}
+
+// bucketRange is the range of buckets [from, to) drawn in a single row.
+type bucketRange struct {
+	from, to int
+}
+
+// mergeBuckets splits the given number of buckets into the rows
+// as evenly as possible so that all buckets fit in the height.
+func mergeBuckets(buckets, height int) []bucketRange {
+	rows := buckets
+	if rows > height {
+		rows = height
+	}
+	ranges := make([]bucketRange, 0, rows)
+	for i := 0; i < rows; i++ {
+		ranges = append(ranges, bucketRange{
+			from: i * buckets / rows,
+			to:   (i + 1) * buckets / rows,
+		})
+	}
+	return ranges
+}
@@ -0,0 +1,101 @@
+package tui
+
+import (
+	"image"
+	"testing"
+
+	"github.com/mum4k/termdash/private/canvas"
+	"github.com/mum4k/termdash/widgetapi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeBuckets(t *testing.T) {
+	tests := []struct {
+		name    string
+		buckets int
+		height  int
+		want    []bucketRange
+	}{
+		{
+			name:    "enough height",
+			buckets: 3,
+			height:  5,
+			want:    []bucketRange{{0, 1}, {1, 2}, {2, 3}},
+		},
+		{
+			name:    "insufficient height",
+			buckets: 5,
+			height:  2,
+			want:    []bucketRange{{0, 2}, {2, 5}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mergeBuckets(tt.buckets, tt.height)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestHeatmapValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		columns [][]uint64
+		yLabels []string
+		wantErr bool
+	}{
+		{
+			name:    "matched number of buckets",
+			columns: [][]uint64{{1, 2}, {3, 4}},
+			yLabels: []string{"0s", "1µs"},
+			wantErr: false,
+		},
+		{
+			name:    "mismatched number of buckets",
+			columns: [][]uint64{{1, 2, 3}},
+			yLabels: []string{"0s", "1µs"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHeatmap()
+			err := h.Values(tt.columns, tt.yLabels)
+			assert.Equal(t, tt.wantErr, err != nil)
+		})
+	}
+}
+
+func TestHeatmapDraw(t *testing.T) {
+	h := newHeatmap()
+	err := h.Values([][]uint64{{0, 0}, {1, 3}, {4, 0}}, []string{"0s", "1µs"})
+	assert.Nil(t, err)
+	cvs, err := canvas.New(image.Rect(0, 0, 10, 2))
+	assert.Nil(t, err)
+	assert.Nil(t, h.Draw(cvs, &widgetapi.Meta{}))
+
+	// The hottest bucket of the latest column is drawn at the right edge.
+	c, err := cvs.Cell(image.Point{X: 9, Y: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, heatmapColors[len(heatmapColors)-1], c.Opts.BgColor)
+	// The empty column is left blank.
+	c, err = cvs.Cell(image.Point{X: 7, Y: 1})
+	assert.Nil(t, err)
+	assert.NotContains(t, heatmapColors, c.Opts.BgColor)
+}
+
+func TestHeatmapMark(t *testing.T) {
+	h := newHeatmap()
+	err := h.Values([][]uint64{{0, 0}, {1, 3}, {4, 0}}, []string{"0s", "1µs"})
+	assert.Nil(t, err)
+	h.Mark(1)
+	cvs, err := canvas.New(image.Rect(0, 0, 10, 2))
+	assert.Nil(t, err)
+	assert.Nil(t, h.Draw(cvs, &widgetapi.Meta{}))
+
+	c, err := cvs.Cell(image.Point{X: 8, Y: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, markRune, c.Rune)
+	// The distribution stays visible behind the mark.
+	assert.Contains(t, heatmapColors, c.Opts.BgColor)
+}
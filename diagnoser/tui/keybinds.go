@@ -7,11 +7,55 @@ import (
 	"github.com/mum4k/termdash/terminal/terminalapi"
 )
 
-func keybinds(cancel context.CancelFunc) func(*terminalapi.Keyboard) {
+func (g *TUI) keybinds(ctx context.Context) func(*terminalapi.Keyboard) {
 	return func(k *terminalapi.Keyboard) {
+		if g.captureKeybind(ctx, k) || g.goroutineKeybind(ctx, k) || g.traceKeybind(ctx, k) {
+			return
+		}
+		if g.Player != nil && g.playerKeybind(k) {
+			return
+		}
 		switch k.Key {
 		case keyboard.KeyCtrlC, 'q': // Quit
+			g.Cancel()
+		case keyboard.KeyTab, keyboard.KeyArrowRight, 'l': // Switch to the next process
+			g.switchTab(1)
+		case keyboard.KeyArrowLeft, 'h': // Switch to the previous process
+			g.switchTab(-1)
+		case '1', '2', '3', '4', '5', '6', '7', '8', '9': // Jump to the process
+			g.showTab(int(k.Key - '1'))
+		case keyboard.KeyArrowUp, 'k': // Move the cursor of the expvar selector
+			g.currentWidgets().ExpvarSelector.Up()
+		case keyboard.KeyArrowDown, 'j':
+			g.currentWidgets().ExpvarSelector.Down()
+		case keyboard.KeySpace: // Select the expvar to draw
+			g.currentWidgets().ExpvarSelector.Toggle()
+		case 'e': // Export the series into a file
+			g.exportAndNotify()
+		}
+	}
+}
+
+// pickerKeybinds lets the user type the filter, so only non-printable keys are bound.
+func pickerKeybinds(cancel context.CancelFunc, p *picker) func(*terminalapi.Keyboard) {
+	return func(k *terminalapi.Keyboard) {
+		switch k.Key {
+		case keyboard.KeyCtrlC, keyboard.KeyEsc: // Quit without picking
 			cancel()
+		case keyboard.KeyEnter: // Pick the process under the cursor
+			if p.Pick() {
+				cancel()
+			}
+		case keyboard.KeyArrowUp, keyboard.KeyCtrlP:
+			p.Up()
+		case keyboard.KeyArrowDown, keyboard.KeyCtrlN:
+			p.Down()
+		case keyboard.KeyBackspace, keyboard.KeyBackspace2:
+			p.Backspace()
+		default:
+			if isPrintable(rune(k.Key)) {
+				p.Input(rune(k.Key))
+			}
 		}
 	}
 }
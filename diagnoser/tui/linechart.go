@@ -0,0 +1,173 @@
+package tui
+
+import (
+	"image"
+	"math"
+	"sync"
+
+	"github.com/mum4k/termdash/cell"
+	"github.com/mum4k/termdash/private/canvas"
+	"github.com/mum4k/termdash/widgetapi"
+	"github.com/mum4k/termdash/widgets/linechart"
+
+	"github.com/nakabonne/gosivy/stats"
+)
+
+const (
+	// The rune drawn as the vertical line of marks.
+	markRune = '│'
+	// The rune termdash draws at the origin of the line chart axes.
+	originRune = '└'
+	// The number of braille pixels in a cell horizontally,
+	// which is the resolution the line chart scales the X axis in.
+	brailleColMult = 2
+)
+
+var markColor = cell.ColorMagenta
+
+// markableLineChart is a line chart which can mark positions of the X axis
+// with vertical lines. It implements LineChart.
+type markableLineChart struct {
+	*linechart.LineChart
+
+	mu sync.Mutex
+	// The number of values of each series keyed by the label.
+	lengths map[string]int
+	marks   []int
+}
+
+func newMarkableLineChart(opts ...linechart.Option) (*markableLineChart, error) {
+	lc, err := linechart.New(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &markableLineChart{
+		LineChart: lc,
+		lengths:   make(map[string]int),
+	}, nil
+}
+
+// Series implements LineChart.Series.
+func (c *markableLineChart) Series(label string, values []float64, opts ...linechart.SeriesOption) error {
+	if err := c.LineChart.Series(label, values, opts...); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lengths[label] = len(values)
+	return nil
+}
+
+// Mark marks the given position of the X axis with a vertical line.
+func (c *markableLineChart) Mark(x int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.marks = append(c.marks, x)
+}
+
+// Draw implements widgetapi.Widget.Draw.
+// It draws the marks over the blank cells of the graph so that they don't hide the lines.
+func (c *markableLineChart) Draw(cvs *canvas.Canvas, meta *widgetapi.Meta) error {
+	if err := c.LineChart.Draw(cvs, meta); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var n int
+	for _, l := range c.lengths {
+		if l > n {
+			n = l
+		}
+	}
+	if len(c.marks) == 0 || n < 2 {
+		return nil
+	}
+	origin, ok := findRune(cvs, originRune)
+	if !ok {
+		// The chart isn't drawn, e.g. too small.
+		return nil
+	}
+	// Scale the same way as the line chart does, where one pixel is reserved for zero.
+	width := cvs.Area().Max.X - origin.X - 1
+	step := float64(n-1) / float64(width*brailleColMult-1)
+	for _, m := range c.marks {
+		if m >= n {
+			continue
+		}
+		x := origin.X + 1 + int(math.Round(float64(m)/step))/brailleColMult
+		for y := cvs.Area().Min.Y; y < origin.Y; y++ {
+			p := image.Point{X: x, Y: y}
+			cl, err := cvs.Cell(p)
+			if err != nil {
+				return err
+			}
+			if cl.Rune != 0 && cl.Rune != ' ' {
+				continue
+			}
+			if _, err := cvs.SetCell(p, markRune, cell.FgColor(markColor)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// findRune gives back the position of the given rune searching from the bottom left.
+func findRune(cvs *canvas.Canvas, r rune) (image.Point, bool) {
+	ar := cvs.Area()
+	for y := ar.Max.Y - 1; y >= ar.Min.Y; y-- {
+		for x := ar.Min.X; x < ar.Max.X; x++ {
+			p := image.Point{X: x, Y: y}
+			if cl, err := cvs.Cell(p); err == nil && cl.Rune == r {
+				return p, true
+			}
+		}
+	}
+	return image.Point{}, false
+}
+
+// bandPrefix is prepended to the names of the band series, so that they are
+// sorted before the others and the lines are drawn over them.
+const bandPrefix = "_"
+
+// band is the range of a gauge drawn as the lines of its lower and upper bounds.
+type band struct {
+	// The name of the gauge in stats.Stats.Ranges.
+	gauge string
+	unit  float64
+	mins  []float64
+	maxs  []float64
+	// Whether any range has been appended, in order not to draw the agents not reporting them.
+	seen bool
+}
+
+func newBand(gauge string, unit float64) *band {
+	return &band{gauge: gauge, unit: unit, mins: make([]float64, 0), maxs: make([]float64, 0)}
+}
+
+// append appends the range of the gauge divided by the unit, or a gap if it isn't reported.
+// The bounds are truncated to integers the same as the lines in MB.
+func (b *band) append(ranges map[string]stats.Range) {
+	r, ok := ranges[b.gauge]
+	if !ok {
+		b.mins = append(b.mins, math.NaN())
+		b.maxs = append(b.maxs, math.NaN())
+		return
+	}
+	b.seen = true
+	b.mins = append(b.mins, math.Floor(r.Min/b.unit))
+	b.maxs = append(b.maxs, math.Floor(r.Max/b.unit))
+}
+
+// draw draws the band around the series with the given name.
+func (b *band) draw(chart LineChart, name string) error {
+	if !b.seen {
+		return nil
+	}
+	opts := linechart.SeriesCellOpts(cell.FgColor(cell.ColorNumber(240)))
+	if err := chart.Series(bandPrefix+name+"-min", b.mins, opts); err != nil {
+		return err
+	}
+	return chart.Series(bandPrefix+name+"-max", b.maxs, opts)
+}
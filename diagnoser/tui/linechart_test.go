@@ -0,0 +1,132 @@
+package tui
+
+import (
+	"image"
+	"math"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/mum4k/termdash/private/canvas"
+	"github.com/mum4k/termdash/widgetapi"
+	"github.com/mum4k/termdash/widgets/linechart"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/nakabonne/gosivy/stats"
+)
+
+func TestMarkableLineChartDraw(t *testing.T) {
+	tests := []struct {
+		name     string
+		marks    []int
+		wantMark bool
+	}{
+		{
+			name:     "no mark",
+			wantMark: false,
+		},
+		{
+			name:     "marked in the middle",
+			marks:    []int{5},
+			wantMark: true,
+		},
+		{
+			name:     "mark beyond the series",
+			marks:    []int{20},
+			wantMark: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := newMarkableLineChart()
+			assert.Nil(t, err)
+			values := make([]float64, 10)
+			for i := range values {
+				values[i] = 1
+			}
+			assert.Nil(t, c.Series("foo", values))
+			for _, m := range tt.marks {
+				c.Mark(m)
+			}
+			cvs, err := canvas.New(image.Rect(0, 0, 30, 10))
+			assert.Nil(t, err)
+			assert.Nil(t, c.Draw(cvs, &widgetapi.Meta{}))
+
+			// The Y axis is drawn with the same rune, hence look at the color.
+			var found bool
+			ar := cvs.Area()
+			for y := ar.Min.Y; y < ar.Max.Y; y++ {
+				for x := ar.Min.X; x < ar.Max.X; x++ {
+					cl, err := cvs.Cell(image.Point{X: x, Y: y})
+					assert.Nil(t, err)
+					if cl.Rune == markRune && cl.Opts.FgColor == markColor {
+						found = true
+					}
+				}
+			}
+			assert.Equal(t, tt.wantMark, found)
+		})
+	}
+}
+
+func TestBandDraw(t *testing.T) {
+	tests := []struct {
+		name    string
+		ranges  []map[string]stats.Range
+		wantMin []float64
+		wantMax []float64
+	}{
+		{
+			name:   "not reported",
+			ranges: []map[string]stats.Range{nil, nil},
+		},
+		{
+			name: "reported after a gap",
+			ranges: []map[string]stats.Range{
+				nil,
+				{stats.GaugeHeapAlloc: {Min: 1.5 * 1024, Max: 3 * 1024}},
+			},
+			wantMin: []float64{math.NaN(), 1},
+			wantMax: []float64{math.NaN(), 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			chart := NewMockLineChart(ctrl)
+			got := make(map[string][]float64)
+			chart.EXPECT().Series(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+				func(name string, values []float64, _ ...linechart.SeriesOption) error {
+					got[name] = values
+					return nil
+				},
+			).AnyTimes()
+
+			b := newBand(stats.GaugeHeapAlloc, 1024)
+			for _, r := range tt.ranges {
+				b.append(r)
+			}
+			b.draw(chart, "alloc")
+			if tt.wantMin == nil {
+				assert.Empty(t, got)
+				return
+			}
+			assert.Len(t, got, 2)
+			assertFloats(t, tt.wantMin, got["_alloc-min"])
+			assertFloats(t, tt.wantMax, got["_alloc-max"])
+		})
+	}
+}
+
+// assertFloats asserts the values are equal, regarding NaNs as equal.
+func assertFloats(t *testing.T, want, got []float64) {
+	t.Helper()
+	assert.Len(t, got, len(want))
+	for i := range want {
+		if math.IsNaN(want[i]) {
+			assert.True(t, math.IsNaN(got[i]))
+			continue
+		}
+		assert.Equal(t, want[i], got[i])
+	}
+}
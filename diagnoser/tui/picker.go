@@ -0,0 +1,287 @@
+package tui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/mum4k/termdash"
+	"github.com/mum4k/termdash/cell"
+	"github.com/mum4k/termdash/container"
+	"github.com/mum4k/termdash/linestyle"
+	"github.com/mum4k/termdash/private/canvas"
+	"github.com/mum4k/termdash/private/draw"
+	"github.com/mum4k/termdash/terminal/terminalapi"
+	"github.com/mum4k/termdash/widgetapi"
+
+	"github.com/nakabonne/gosivy/process"
+)
+
+// PickProcess lets the user pick one of the given processes interactively.
+// It gives back nil if the user quit without picking.
+func PickProcess(ps process.Processes) (*process.Process, error) {
+	t, err := newTerminal()
+	if err != nil {
+		return nil, err
+	}
+	defer t.Close()
+	return pickProcess(context.Background(), t, termdash.Run, ps)
+}
+
+func pickProcess(ctx context.Context, t terminalapi.Terminal, r runner, ps process.Processes) (*process.Process, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	p := newPicker(ps)
+	c, err := container.New(t,
+		container.ID(rootID),
+		container.Border(linestyle.Light),
+		container.BorderTitle("Select a process (Type to filter, ↑↓ Enter, Esc to quit)"),
+		container.PlaceWidget(p),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate container: %w", err)
+	}
+	k := pickerKeybinds(cancel, p)
+	if err := r(ctx, t, c, termdash.KeyboardSubscriber(k), termdash.RedrawInterval(100*time.Millisecond)); err != nil {
+		return nil, err
+	}
+	return p.Picked(), nil
+}
+
+// picker lists the processes filtered by fuzzy matching,
+// and lets the user pick one of them.
+type picker struct {
+	mu        sync.Mutex
+	processes process.Processes
+	filter    []rune
+	// Indices of the processes matching the filter in the order of relevance.
+	matches []int
+	cursor  int
+	picked  *process.Process
+}
+
+func newPicker(ps process.Processes) *picker {
+	p := &picker{processes: ps}
+	p.refilter()
+	return p
+}
+
+// Input appends the given character to the filter.
+func (p *picker) Input(r rune) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.filter = append(p.filter, r)
+	p.refilter()
+}
+
+// Backspace deletes the last character of the filter.
+func (p *picker) Backspace() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.filter) == 0 {
+		return
+	}
+	p.filter = p.filter[:len(p.filter)-1]
+	p.refilter()
+}
+
+// Up moves the cursor to the previous process.
+func (p *picker) Up() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cursor > 0 {
+		p.cursor--
+	}
+}
+
+// Down moves the cursor to the next process.
+func (p *picker) Down() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cursor < len(p.matches)-1 {
+		p.cursor++
+	}
+}
+
+// Pick picks the process under the cursor, and reports whether there is one.
+func (p *picker) Pick() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cursor >= len(p.matches) {
+		return false
+	}
+	p.picked = &p.processes[p.matches[p.cursor]]
+	return true
+}
+
+// Picked gives back the picked process, or nil if not picked yet.
+func (p *picker) Picked() *process.Process {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.picked
+}
+
+// refilter must be called with mu held.
+func (p *picker) refilter() {
+	type match struct {
+		index int
+		score int
+	}
+	matches := make([]match, 0, len(p.processes))
+	for i := range p.processes {
+		if score, ok := fuzzyMatch(string(p.filter), processLine(&p.processes[i])); ok {
+			matches = append(matches, match{i, score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score < matches[j].score
+	})
+	p.matches = make([]int, 0, len(matches))
+	for _, m := range matches {
+		p.matches = append(p.matches, m.index)
+	}
+	p.cursor = 0
+}
+
+// processLine gives back the text to be matched against the filter.
+func processLine(p *process.Process) string {
+	return fmt.Sprintf("%d %s %s %s", p.PID, p.Executable, p.Username, p.Path)
+}
+
+// fuzzyMatch reports whether all characters of the pattern appear in s in order,
+// ignoring case. The score is the length of the shortest span of s containing
+// them, thus the smaller the better.
+func fuzzyMatch(pattern, s string) (int, bool) {
+	pr := []rune(strings.ToLower(pattern))
+	if len(pr) == 0 {
+		return 0, true
+	}
+	sr := []rune(strings.ToLower(s))
+	best := -1
+	for start := range sr {
+		if sr[start] != pr[0] {
+			continue
+		}
+		j := 1
+		end := start
+		for i := start + 1; i < len(sr) && j < len(pr); i++ {
+			if sr[i] == pr[j] {
+				j++
+				end = i
+			}
+		}
+		if j < len(pr) {
+			// No more match from the later starts.
+			break
+		}
+		if span := end - start + 1; best < 0 || span < best {
+			best = span
+		}
+	}
+	return best, best >= 0
+}
+
+// Draw implements widgetapi.Widget.Draw.
+func (p *picker) Draw(cvs *canvas.Canvas, _ *widgetapi.Meta) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ar := cvs.Area()
+	lines := []string{"> " + string(p.filter)}
+	rows := [][]string{{"PID", "Exec", "User", "Uptime", "Path"}}
+	for _, i := range p.matches {
+		proc := &p.processes[i]
+		uptime := "-"
+		if d := proc.Uptime(); d > 0 {
+			uptime = d.Truncate(time.Second).String()
+		}
+		rows = append(rows, []string{strconv.Itoa(proc.PID), proc.Executable, proc.Username, uptime, proc.Path})
+	}
+	lines = append(lines, alignColumns(rows)...)
+
+	// Scroll so that the cursor is always visible. The filter and the header are always shown.
+	const fixed = 2
+	start := 0
+	if visible := ar.Dy() - fixed; visible > 0 && p.cursor >= visible {
+		start = p.cursor - visible + 1
+	}
+	for y := 0; y < ar.Dy(); y++ {
+		i := y
+		if y >= fixed {
+			i = y + start
+		}
+		if i >= len(lines) {
+			break
+		}
+		opts := []cell.Option{}
+		switch {
+		case y == 1:
+			opts = append(opts, cell.FgColor(cell.ColorNumber(87)))
+		case i-fixed == p.cursor:
+			opts = append(opts, cell.BgColor(cell.ColorNumber(238)))
+		}
+		pt := image.Point{X: ar.Min.X, Y: ar.Min.Y + y}
+		if err := draw.Text(cvs, lines[i], pt, draw.TextCellOpts(opts...), draw.TextMaxX(ar.Max.X), draw.TextOverrunMode(draw.OverrunModeThreeDot)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// alignColumns pads each column to the widest cell in it.
+func alignColumns(rows [][]string) []string {
+	var widths []int
+	for _, row := range rows {
+		for i, c := range row {
+			if i >= len(widths) {
+				widths = append(widths, 0)
+			}
+			if n := len([]rune(c)); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+	lines := make([]string, 0, len(rows))
+	for _, row := range rows {
+		var b strings.Builder
+		for i, c := range row {
+			if i == len(row)-1 {
+				b.WriteString(c)
+				break
+			}
+			fmt.Fprintf(&b, "%-*s ", widths[i], c)
+		}
+		lines = append(lines, b.String())
+	}
+	return lines
+}
+
+// Keyboard implements widgetapi.Widget.Keyboard.
+func (p *picker) Keyboard(_ *terminalapi.Keyboard) error {
+	return errors.New("the picker is operated via the global keybinds")
+}
+
+// Mouse implements widgetapi.Widget.Mouse.
+func (p *picker) Mouse(_ *terminalapi.Mouse) error {
+	return errors.New("the picker doesn't support mouse events")
+}
+
+// Options implements widgetapi.Widget.Options.
+func (p *picker) Options() widgetapi.Options {
+	return widgetapi.Options{
+		MinimumSize: image.Point{X: 1, Y: 1},
+	}
+}
+
+// isPrintable checks if the given key can be typed into the filter.
+func isPrintable(r rune) bool {
+	return r >= 0 && unicode.IsPrint(r)
+}
@@ -0,0 +1,125 @@
+package tui
+
+import (
+	"context"
+	"image"
+	"testing"
+	"time"
+
+	"github.com/mum4k/termdash"
+	"github.com/mum4k/termdash/container"
+	"github.com/mum4k/termdash/private/canvas"
+	"github.com/mum4k/termdash/private/faketerm"
+	"github.com/mum4k/termdash/terminal/terminalapi"
+	"github.com/mum4k/termdash/widgetapi"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/nakabonne/gosivy/process"
+)
+
+var testProcesses = process.Processes{
+	{PID: 15788, Executable: "foo", Path: "/path/to/foo", Username: "alice", CreateTime: time.Now().Add(-time.Hour)},
+	{PID: 14054, Executable: "main", Path: "/tmp/go-build/exe/main", Username: "bob"},
+	{PID: 20001, Executable: "foobar", Path: "/path/to/foobar", Username: "alice"},
+}
+
+func TestPicker(t *testing.T) {
+	p := newPicker(testProcesses)
+	assert.Equal(t, []int{0, 1, 2}, p.matches)
+
+	// The tighter match comes first.
+	for _, r := range "fbr" {
+		p.Input(r)
+	}
+	assert.Equal(t, []int{2}, p.matches)
+	p.Backspace()
+	p.Backspace()
+	assert.Equal(t, []int{0, 2}, p.matches)
+
+	p.Down()
+	p.Down()
+	assert.Equal(t, 1, p.cursor)
+	assert.Nil(t, p.Picked())
+	assert.True(t, p.Pick())
+	assert.Equal(t, 20001, p.Picked().PID)
+
+	// Nothing to pick if no process matches.
+	p.Input('z')
+	assert.Empty(t, p.matches)
+	assert.False(t, p.Pick())
+}
+
+func TestPickerDraw(t *testing.T) {
+	p := newPicker(testProcesses)
+	p.Input('o')
+	cvs, err := canvas.New(image.Rect(0, 0, 60, 3))
+	assert.Nil(t, err)
+	assert.Nil(t, p.Draw(cvs, &widgetapi.Meta{}))
+}
+
+func TestFuzzyMatch(t *testing.T) {
+	tests := []struct {
+		name      string
+		pattern   string
+		s         string
+		wantScore int
+		wantOK    bool
+	}{
+		{
+			name:    "empty pattern",
+			pattern: "",
+			s:       "foo",
+			wantOK:  true,
+		},
+		{
+			name:      "substring",
+			pattern:   "foo",
+			s:         "1 foo /path/to/foo",
+			wantScore: 3,
+			wantOK:    true,
+		},
+		{
+			name:      "subsequence ignoring case",
+			pattern:   "PTF",
+			s:         "/path/to/foo",
+			wantScore: 9,
+			wantOK:    true,
+		},
+		{
+			name:    "not in order",
+			pattern: "of",
+			s:       "foo",
+			wantOK:  false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score, ok := fuzzyMatch(tt.pattern, tt.s)
+			assert.Equal(t, tt.wantOK, ok)
+			if ok {
+				assert.Equal(t, tt.wantScore, score)
+			}
+		})
+	}
+}
+
+func TestAlignColumns(t *testing.T) {
+	got := alignColumns([][]string{
+		{"PID", "Exec", "Path"},
+		{"15788", "foo", "/path/to/foo"},
+	})
+	assert.Equal(t, []string{
+		"PID   Exec Path",
+		"15788 foo  /path/to/foo",
+	}, got)
+}
+
+func TestPickProcess(t *testing.T) {
+	term, err := faketerm.New(image.Point{X: 100, Y: 20})
+	assert.Nil(t, err)
+	got, err := pickProcess(context.Background(), term, func(context.Context, terminalapi.Terminal, *container.Container, ...termdash.Option) error {
+		return nil
+	}, testProcesses)
+	assert.Nil(t, err)
+	assert.Nil(t, got)
+}
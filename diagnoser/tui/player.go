@@ -0,0 +1,139 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mum4k/termdash/keyboard"
+	"github.com/mum4k/termdash/terminal/terminalapi"
+	"github.com/mum4k/termdash/widgets/text"
+)
+
+// Player controls the playback of a recording.
+type Player interface {
+	// TogglePause pauses or resumes the playback.
+	TogglePause()
+	// Step moves by the given number of samples, which can be negative, and then pauses.
+	Step(n int)
+	// Rewind moves back to the beginning.
+	Rewind()
+	// Seek moves to the first sample taken at or after the given time of day.
+	Seek(clock time.Duration) error
+	// Faster doubles the speed.
+	Faster()
+	// Slower halves the speed.
+	Slower()
+	// State describes the position and the speed of the playback.
+	State() string
+}
+
+const (
+	playerTitle = "Replay (P: pause, ,/.: step, R: rewind, G: jump, +/-: speed)"
+	seekPrompt  = "Jump to (hh:mm:ss): "
+)
+
+// playerKeybind controls the player with the given key, and tells if the key was consumed.
+// While the user types the time to jump to, every key is consumed.
+func (g *TUI) playerKeybind(k *terminalapi.Keyboard) bool {
+	g.mu.Lock()
+	seeking := g.seeking
+	g.mu.Unlock()
+	if seeking {
+		g.seekKeybind(k)
+		g.writePlayerState()
+		return true
+	}
+	switch k.Key {
+	case 'p':
+		g.Player.TogglePause()
+	case '.':
+		g.Player.Step(1)
+	case ',':
+		g.Player.Step(-1)
+	case 'r':
+		g.Player.Rewind()
+	case '+', '=':
+		g.Player.Faster()
+	case '-':
+		g.Player.Slower()
+	case 'g':
+		g.mu.Lock()
+		g.seeking = true
+		g.seekInput = ""
+		g.mu.Unlock()
+	default:
+		return false
+	}
+	g.writePlayerState()
+	return true
+}
+
+// seekKeybind lets the user type the time to jump to.
+func (g *TUI) seekKeybind(k *terminalapi.Keyboard) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	switch k.Key {
+	case keyboard.KeyCtrlC:
+		g.Cancel()
+	case keyboard.KeyEsc:
+		g.seeking = false
+	case keyboard.KeyEnter:
+		g.seeking = false
+		clock, err := parseClock(g.seekInput)
+		if err != nil {
+			g.seekErr = err
+			return
+		}
+		g.seekErr = g.Player.Seek(clock)
+	case keyboard.KeyBackspace, keyboard.KeyBackspace2:
+		if n := len(g.seekInput); n > 0 {
+			g.seekInput = g.seekInput[:n-1]
+		}
+	default:
+		if r := rune(k.Key); r == ':' || r >= '0' && r <= '9' {
+			g.seekInput += string(r)
+		}
+	}
+}
+
+// parseClock parses the time of day formatted in hh:mm:ss.
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04:05", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second, nil
+}
+
+// refreshPlayerState keeps showing the state of the player until the context is done.
+func (g *TUI) refreshPlayerState(ctx context.Context) {
+	tick := time.NewTicker(g.RedrawInterval)
+	defer tick.Stop()
+	for {
+		g.writePlayerState()
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+	}
+}
+
+// writePlayerState shows the state of the player, or the prompt while seeking, on every tab.
+func (g *TUI) writePlayerState() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	s := g.Player.State()
+	switch {
+	case g.seeking:
+		s = seekPrompt + g.seekInput
+	case g.seekErr != nil:
+		s += " | " + g.seekErr.Error()
+	}
+	for _, target := range g.Targets {
+		if target.widgets != nil {
+			target.widgets.Status.Write(s, text.WriteReplace())
+		}
+	}
+}
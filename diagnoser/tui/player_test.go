@@ -0,0 +1,93 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"testing"
+	"time"
+
+	"github.com/mum4k/termdash"
+	"github.com/mum4k/termdash/container"
+	"github.com/mum4k/termdash/keyboard"
+	"github.com/mum4k/termdash/private/faketerm"
+	"github.com/mum4k/termdash/terminal/terminalapi"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakePlayer records the operations performed.
+type fakePlayer struct {
+	ops []string
+}
+
+func (p *fakePlayer) TogglePause() { p.ops = append(p.ops, "pause") }
+func (p *fakePlayer) Step(n int)   { p.ops = append(p.ops, fmt.Sprintf("step %d", n)) }
+func (p *fakePlayer) Rewind()      { p.ops = append(p.ops, "rewind") }
+func (p *fakePlayer) Seek(clock time.Duration) error {
+	p.ops = append(p.ops, fmt.Sprintf("seek %v", clock))
+	return nil
+}
+func (p *fakePlayer) Faster()       { p.ops = append(p.ops, "faster") }
+func (p *fakePlayer) Slower()       { p.ops = append(p.ops, "slower") }
+func (p *fakePlayer) State() string { return "state" }
+
+func TestPlayerKeybind(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := &fakePlayer{}
+	g := NewTUI(time.Hour, cancel, []*Target{{Name: "a"}})
+	g.Player = p
+	term, err := faketerm.New(image.Point{X: 200, Y: 100})
+	assert.Nil(t, err)
+	err = g.run(ctx, term, func(context.Context, terminalapi.Terminal, *container.Container, ...termdash.Option) error {
+		return nil
+	})
+	assert.Nil(t, err)
+
+	k := g.keybinds(ctx)
+	for _, key := range []keyboard.Key{'p', '.', ',', 'r', '+', '-', 'g', '1', '5', ':', '0', '4', ':', '0', '7', keyboard.KeyBackspace2, '8', keyboard.KeyEnter, 'g', 'x', keyboard.KeyEsc} {
+		k(&terminalapi.Keyboard{Key: key})
+	}
+	assert.Equal(t, []string{"pause", "step 1", "step -1", "rewind", "faster", "slower", "seek 15h4m8s"}, p.ops)
+	assert.False(t, g.seeking)
+	assert.Nil(t, g.seekErr)
+
+	// An invalid time isn't passed to the player.
+	for _, key := range []keyboard.Key{'g', '9', '9', keyboard.KeyEnter} {
+		k(&terminalapi.Keyboard{Key: key})
+	}
+	assert.Len(t, p.ops, 7)
+	assert.NotNil(t, g.seekErr)
+}
+
+func TestParseClock(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    time.Duration
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			s:    "15:04:05",
+			want: 15*time.Hour + 4*time.Minute + 5*time.Second,
+		},
+		{
+			name:    "missing seconds",
+			s:       "15:04",
+			wantErr: true,
+		},
+		{
+			name:    "out of range",
+			s:       "25:00:00",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseClock(tt.s)
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
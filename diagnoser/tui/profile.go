@@ -0,0 +1,111 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/mum4k/termdash/keyboard"
+	"github.com/mum4k/termdash/terminal/terminalapi"
+
+	"github.com/nakabonne/gosivy/stats"
+)
+
+// Profiler captures profiles from the process.
+type Profiler interface {
+	// Profile captures the requested profile, and gives back it in the pprof format.
+	Profile(ctx context.Context, req stats.ProfileRequest) ([]byte, error)
+	// Goroutines gives back the stacks of all goroutines grouped by stack.
+	Goroutines(ctx context.Context) ([]*stats.GoroutineGroup, error)
+	// Trace captures an execution trace for the given duration.
+	Trace(ctx context.Context, d time.Duration) (*stats.TraceReply, error)
+}
+
+const (
+	// DefaultProfileDuration is how long to profile the CPU for by default.
+	DefaultProfileDuration = 10 * time.Second
+	capturePrompt          = "Capture: C)PU H)eap A)llocs M)utex B)lock G)oroutine, Esc to cancel"
+)
+
+// profileKeys maps the keys typed at the capture prompt to the profiles.
+var profileKeys = map[keyboard.Key]string{
+	'c': stats.ProfileCPU,
+	'h': stats.ProfileHeap,
+	'a': stats.ProfileAllocs,
+	'm': stats.ProfileMutex,
+	'b': stats.ProfileBlock,
+	'g': stats.ProfileGoroutine,
+}
+
+// captureKeybind shows the capture prompt, and then captures the profile picked there.
+// It tells if the key was consumed. While the prompt is shown, every key is consumed.
+func (g *TUI) captureKeybind(ctx context.Context, k *terminalapi.Keyboard) bool {
+	g.mu.Lock()
+	capturing := g.capturing
+	g.capturing = !capturing && k.Key == 'c'
+	g.mu.Unlock()
+	if !capturing {
+		if k.Key != 'c' {
+			return false
+		}
+		g.setNotice(capturePrompt)
+		return true
+	}
+	if k.Key == keyboard.KeyCtrlC {
+		g.Cancel()
+		return true
+	}
+	name, ok := profileKeys[k.Key]
+	if !ok {
+		g.setNotice("")
+		return true
+	}
+	go g.captureAndNotify(ctx, name)
+	return true
+}
+
+// captureAndNotify captures the profile of the target currently shown,
+// and then shows the progress and the result in the title.
+func (g *TUI) captureAndNotify(ctx context.Context, name string) {
+	g.mu.Lock()
+	target := g.Targets[g.current]
+	// The metadata gets replaced when the process restarts.
+	pid := target.Metadata.PID
+	g.mu.Unlock()
+	if target.Profiler == nil {
+		g.setNotice("Profiling is unavailable")
+		return
+	}
+
+	req := stats.ProfileRequest{Name: name}
+	notice := fmt.Sprintf("Capturing %s profile...", name)
+	if name == stats.ProfileCPU {
+		req.Duration = g.ProfileDuration
+		notice = fmt.Sprintf("Capturing %s profile for %v...", name, req.Duration)
+	}
+	g.setNotice(notice)
+	path, err := capture(ctx, target.Profiler, pid, req)
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		g.setNotice(err.Error())
+		return
+	}
+	g.setNotice("Saved to " + path)
+}
+
+// capture saves the profile captured from the process with the given PID into a file
+// in the working directory, and gives back the path.
+func capture(ctx context.Context, p Profiler, pid int, req stats.ProfileRequest) (string, error) {
+	b, err := p.Profile(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	path := fmt.Sprintf("gosivy-%d-%s-%s.pb.gz", pid, req.Name, time.Now().Format("20060102-150405"))
+	if err := ioutil.WriteFile(path, b, 0644); err != nil {
+		return "", fmt.Errorf("failed to write the profile: %w", err)
+	}
+	return path, nil
+}
@@ -0,0 +1,126 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mum4k/termdash"
+	"github.com/mum4k/termdash/container"
+	"github.com/mum4k/termdash/keyboard"
+	"github.com/mum4k/termdash/private/faketerm"
+	"github.com/mum4k/termdash/terminal/terminalapi"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/nakabonne/gosivy/stats"
+)
+
+// fakeProfiler gives back the name of the profile as its content.
+type fakeProfiler struct {
+	mu     sync.Mutex
+	reqs   []stats.ProfileRequest
+	groups []*stats.GoroutineGroup
+}
+
+func (p *fakeProfiler) Profile(_ context.Context, req stats.ProfileRequest) ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.reqs = append(p.reqs, req)
+	if req.Name == stats.ProfileMutex {
+		return nil, fmt.Errorf("failed")
+	}
+	return []byte(req.Name), nil
+}
+
+func (p *fakeProfiler) Goroutines(_ context.Context) ([]*stats.GoroutineGroup, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.groups, nil
+}
+
+func (p *fakeProfiler) Trace(_ context.Context, d time.Duration) (*stats.TraceReply, error) {
+	return &stats.TraceReply{Summary: stats.TraceSummary{Duration: d, GCCycles: 2}, Trace: []byte("trace")}, nil
+}
+
+func TestCaptureKeybind(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	assert.Nil(t, err)
+	assert.Nil(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := &fakeProfiler{}
+	g := NewTUI(time.Hour, cancel, []*Target{{Name: "a", Metadata: stats.Meta{PID: 15788}, Profiler: p}})
+	g.ProfileDuration = 3 * time.Second
+	term, err := faketerm.New(image.Point{X: 200, Y: 100})
+	assert.Nil(t, err)
+	err = g.run(ctx, term, func(context.Context, terminalapi.Terminal, *container.Container, ...termdash.Option) error {
+		return nil
+	})
+	assert.Nil(t, err)
+	k := g.keybinds(ctx)
+
+	tests := []struct {
+		name       string
+		keys       []keyboard.Key
+		wantReq    *stats.ProfileRequest
+		wantNotice string
+	}{
+		{
+			name:       "cpu",
+			keys:       []keyboard.Key{'c', 'c'},
+			wantReq:    &stats.ProfileRequest{Name: stats.ProfileCPU, Duration: 3 * time.Second},
+			wantNotice: "Saved to gosivy-15788-cpu-",
+		},
+		{
+			name:       "heap",
+			keys:       []keyboard.Key{'c', 'h'},
+			wantReq:    &stats.ProfileRequest{Name: stats.ProfileHeap},
+			wantNotice: "Saved to gosivy-15788-heap-",
+		},
+		{
+			name:       "failed",
+			keys:       []keyboard.Key{'c', 'm'},
+			wantReq:    &stats.ProfileRequest{Name: stats.ProfileMutex},
+			wantNotice: "failed",
+		},
+		{
+			name: "canceled",
+			keys: []keyboard.Key{'c', keyboard.KeyEsc},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p.mu.Lock()
+			p.reqs = nil
+			p.mu.Unlock()
+			k(&terminalapi.Keyboard{Key: tt.keys[0]})
+			assert.Equal(t, capturePrompt, g.notice)
+			k(&terminalapi.Keyboard{Key: tt.keys[1]})
+			assert.False(t, g.capturing)
+			if tt.wantReq == nil {
+				assert.Empty(t, g.notice)
+				return
+			}
+			assert.Eventually(t, func() bool {
+				g.mu.Lock()
+				defer g.mu.Unlock()
+				return len(g.notice) >= len(tt.wantNotice) && g.notice[:len(tt.wantNotice)] == tt.wantNotice
+			}, time.Second, 10*time.Millisecond)
+			p.mu.Lock()
+			assert.Equal(t, []stats.ProfileRequest{*tt.wantReq}, p.reqs)
+			p.mu.Unlock()
+		})
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Len(t, files, 2)
+}
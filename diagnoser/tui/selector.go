@@ -0,0 +1,162 @@
+package tui
+
+import (
+	"errors"
+	"image"
+	"sort"
+	"sync"
+
+	"github.com/mum4k/termdash/cell"
+	"github.com/mum4k/termdash/private/canvas"
+	"github.com/mum4k/termdash/private/draw"
+	"github.com/mum4k/termdash/terminal/terminalapi"
+	"github.com/mum4k/termdash/widgetapi"
+)
+
+// selectorColors are assigned to the selected items in turn,
+// so that they can be used as a legend of the chart.
+var selectorColors = []cell.Color{
+	cell.ColorNumber(87),
+	cell.ColorYellow,
+	cell.ColorGreen,
+	cell.ColorMagenta,
+	cell.ColorNumber(208),
+	cell.ColorBlue,
+	cell.ColorRed,
+	cell.ColorWhite,
+}
+
+// selector is a list of items that can be selected with the cursor.
+// It implements Selector.
+type selector struct {
+	mu sync.Mutex
+	// Sorted items.
+	items  []string
+	cursor int
+	// Colors of the selected items keyed by the item.
+	selected map[string]cell.Color
+	// The index of the color to be assigned next.
+	nextColor int
+}
+
+func newSelector() *selector {
+	return &selector{
+		selected: make(map[string]cell.Color),
+	}
+}
+
+// SetItems replaces the items with the given ones while keeping
+// the cursor on the same item as much as possible.
+func (s *selector) SetItems(items []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var current string
+	if s.cursor < len(s.items) {
+		current = s.items[s.cursor]
+	}
+	s.items = append(s.items[:0:0], items...)
+	sort.Strings(s.items)
+	s.cursor = 0
+	for i, item := range s.items {
+		if item == current {
+			s.cursor = i
+			break
+		}
+	}
+}
+
+// Up moves the cursor to the previous item.
+func (s *selector) Up() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cursor > 0 {
+		s.cursor--
+	}
+}
+
+// Down moves the cursor to the next item.
+func (s *selector) Down() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cursor < len(s.items)-1 {
+		s.cursor++
+	}
+}
+
+// Toggle selects the item under the cursor, or deselects it if already selected.
+func (s *selector) Toggle() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cursor >= len(s.items) {
+		return
+	}
+	item := s.items[s.cursor]
+	if _, ok := s.selected[item]; ok {
+		delete(s.selected, item)
+		return
+	}
+	s.selected[item] = selectorColors[s.nextColor%len(selectorColors)]
+	s.nextColor++
+}
+
+// Selected gives back the colors of the selected items keyed by the item.
+func (s *selector) Selected() map[string]cell.Color {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	selected := make(map[string]cell.Color, len(s.selected))
+	for item, color := range s.selected {
+		selected[item] = color
+	}
+	return selected
+}
+
+// Draw implements widgetapi.Widget.Draw.
+func (s *selector) Draw(cvs *canvas.Canvas, _ *widgetapi.Meta) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ar := cvs.Area()
+	if ar.Dy() == 0 {
+		return nil
+	}
+	// Scroll so that the cursor is always visible.
+	start := 0
+	if s.cursor >= ar.Dy() {
+		start = s.cursor - ar.Dy() + 1
+	}
+	for i := start; i < len(s.items) && i-start < ar.Dy(); i++ {
+		item := s.items[i]
+		line := "[ ] " + item
+		opts := []cell.Option{}
+		if color, ok := s.selected[item]; ok {
+			line = "[x] " + item
+			opts = append(opts, cell.FgColor(color))
+		}
+		if i == s.cursor {
+			opts = append(opts, cell.BgColor(cell.ColorNumber(238)))
+		}
+		p := image.Point{X: ar.Min.X, Y: ar.Min.Y + i - start}
+		if err := draw.Text(cvs, line, p, draw.TextCellOpts(opts...), draw.TextMaxX(ar.Max.X), draw.TextOverrunMode(draw.OverrunModeThreeDot)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Keyboard implements widgetapi.Widget.Keyboard.
+func (s *selector) Keyboard(_ *terminalapi.Keyboard) error {
+	return errors.New("the selector is operated via the global keybinds")
+}
+
+// Mouse implements widgetapi.Widget.Mouse.
+func (s *selector) Mouse(_ *terminalapi.Mouse) error {
+	return errors.New("the selector doesn't support mouse events")
+}
+
+// Options implements widgetapi.Widget.Options.
+func (s *selector) Options() widgetapi.Options {
+	return widgetapi.Options{
+		MinimumSize: image.Point{X: 1, Y: 1},
+	}
+}
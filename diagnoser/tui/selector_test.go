@@ -0,0 +1,39 @@
+package tui
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelector(t *testing.T) {
+	s := newSelector()
+	s.SetItems([]string{"c", "a", "b"})
+	assert.Equal(t, []string{"a", "b", "c"}, s.items)
+
+	// Toggling at the top selects "a".
+	s.Toggle()
+	s.Down()
+	s.Down()
+	s.Down()
+	// Toggling at the bottom selects "c".
+	s.Toggle()
+	selected := s.Selected()
+	assert.Len(t, selected, 2)
+	assert.Contains(t, selected, "a")
+	assert.Contains(t, selected, "c")
+	assert.NotEqual(t, selected["a"], selected["c"])
+
+	// The cursor follows the item even if new items are inserted before it.
+	s.SetItems([]string{"0", "a", "b", "c"})
+	assert.Equal(t, 3, s.cursor)
+
+	// Toggling again deselects it.
+	s.Toggle()
+	s.Up()
+	s.Up()
+	s.Up()
+	s.Up()
+	assert.Equal(t, 0, s.cursor)
+	assert.Len(t, s.Selected(), 1)
+}
@@ -0,0 +1,72 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mum4k/termdash/cell"
+	"github.com/mum4k/termdash/widgets/text"
+)
+
+// ConnState is the state of the connection to the agent.
+type ConnState int
+
+const (
+	ConnStateConnected ConnState = iota
+	ConnStateReconnecting
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case ConnStateConnected:
+		return "Connected"
+	case ConnStateReconnecting:
+		return "Reconnecting"
+	default:
+		return "Unknown"
+	}
+}
+
+// Status is the health of the connection to the agent.
+type Status struct {
+	State ConnState
+	// The last error occurred while scraping, nil if the stats have been scraped since then.
+	Err error
+	// When the stats were scraped successfully for the last time.
+	LastScrape time.Time
+	// The round-trip time of the last request to the agent,
+	// zero if not measured, e.g. while the stats are streamed.
+	Latency time.Duration
+}
+
+// writeStatus replaces the content of the given text with the status,
+// whose state is colored so that the broken connection stands out.
+func writeStatus(t Text, s Status) error {
+	color := cell.ColorGreen
+	if s.State != ConnStateConnected {
+		color = cell.ColorYellow
+	}
+	if err := t.Write("● "+s.State.String(), text.WriteReplace(), text.WriteCellOpts(cell.FgColor(color))); err != nil {
+		return err
+	}
+	return t.Write(statusText(s))
+}
+
+// statusText formats the details of the given status following the state.
+func statusText(s Status) string {
+	var b strings.Builder
+	lastScrape := "-"
+	if !s.LastScrape.IsZero() {
+		lastScrape = s.LastScrape.Format("15:04:05")
+	}
+	latency := "-"
+	if s.Latency > 0 {
+		latency = s.Latency.Round(time.Microsecond).String()
+	}
+	fmt.Fprintf(&b, " | Last scrape: %s | Latency: %s", lastScrape, latency)
+	if s.Err != nil {
+		fmt.Fprintf(&b, " | Last error: %v", s.Err)
+	}
+	return b.String()
+}
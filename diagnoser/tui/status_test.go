@@ -0,0 +1,56 @@
+package tui
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatusText(t *testing.T) {
+	lastScrape := time.Date(2021, 1, 2, 15, 4, 5, 0, time.Local)
+	tests := []struct {
+		name   string
+		status Status
+		want   string
+	}{
+		{
+			name:   "not scraped yet",
+			status: Status{State: ConnStateConnected, Latency: 1500 * time.Nanosecond},
+			want:   " | Last scrape: - | Latency: 2µs",
+		},
+		{
+			name:   "connected",
+			status: Status{State: ConnStateConnected, LastScrape: lastScrape, Latency: 12 * time.Millisecond},
+			want:   " | Last scrape: 15:04:05 | Latency: 12ms",
+		},
+		{
+			name:   "streamed",
+			status: Status{State: ConnStateConnected, LastScrape: lastScrape},
+			want:   " | Last scrape: 15:04:05 | Latency: -",
+		},
+		{
+			name: "reconnecting",
+			status: Status{
+				State:      ConnStateReconnecting,
+				Err:        errors.New("failed to dial: connection refused"),
+				LastScrape: lastScrape,
+				Latency:    12 * time.Millisecond,
+			},
+			want: " | Last scrape: 15:04:05 | Latency: 12ms | Last error: failed to dial: connection refused",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := statusText(tt.status)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestConnStateString(t *testing.T) {
+	assert.Equal(t, "Connected", ConnStateConnected.String())
+	assert.Equal(t, "Reconnecting", ConnStateReconnecting.String())
+	assert.Equal(t, "Unknown", ConnState(-1).String())
+}
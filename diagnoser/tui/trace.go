@@ -0,0 +1,123 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/mum4k/termdash/keyboard"
+	"github.com/mum4k/termdash/terminal/terminalapi"
+	"github.com/mum4k/termdash/widgets/text"
+
+	"github.com/nakabonne/gosivy/stats"
+)
+
+const (
+	// DefaultTraceDuration is how long to capture an execution trace for by default.
+	DefaultTraceDuration = 5 * time.Second
+	traceTitle           = "Trace (T: trace again, Esc: close)"
+)
+
+// traceKeybind captures an execution trace and shows its summary in place of the charts,
+// and tells if the key was consumed.
+func (g *TUI) traceKeybind(ctx context.Context, k *terminalapi.Keyboard) bool {
+	g.mu.Lock()
+	shown := g.pane == paneTrace
+	g.mu.Unlock()
+	switch {
+	case k.Key == 't':
+		g.showPane(paneTrace)
+		go g.traceAndShow(ctx)
+	case shown && k.Key == keyboard.KeyEsc:
+		g.showPane(paneCharts)
+	default:
+		return false
+	}
+	return true
+}
+
+// traceAndShow captures an execution trace of the target currently shown,
+// and then shows the progress and the summary.
+func (g *TUI) traceAndShow(ctx context.Context) {
+	g.mu.Lock()
+	target := g.Targets[g.current]
+	w := target.widgets
+	// The metadata gets replaced when the process restarts.
+	pid := target.Metadata.PID
+	d := g.TraceDuration
+	g.mu.Unlock()
+	if target.Profiler == nil {
+		w.TraceSummary.Write("Tracing is unavailable", text.WriteReplace())
+		return
+	}
+	w.TraceSummary.Write(fmt.Sprintf("Tracing for %v...", d), text.WriteReplace())
+	path, summary, err := captureTrace(ctx, target.Profiler, pid, d)
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		w.TraceSummary.Write(err.Error(), text.WriteReplace())
+		return
+	}
+	w.TraceSummary.Write(traceSummaryText(summary)+fmt.Sprintf("\nSaved to %s, run \"go tool trace %s\" for the details.", path, path), text.WriteReplace())
+}
+
+// captureTrace saves the execution trace captured from the process with the given PID
+// into a file in the working directory, and gives back the path along with the summary.
+func captureTrace(ctx context.Context, p Profiler, pid int, d time.Duration) (string, *stats.TraceSummary, error) {
+	reply, err := p.Trace(ctx, d)
+	if err != nil {
+		return "", nil, err
+	}
+	path := fmt.Sprintf("gosivy-%d-trace-%s.out", pid, time.Now().Format("20060102-150405"))
+	if err := ioutil.WriteFile(path, reply.Trace, 0644); err != nil {
+		return "", nil, fmt.Errorf("failed to write the trace: %w", err)
+	}
+	return path, &reply.Summary, nil
+}
+
+// traceSummaryText formats the given summary, which is labeled as derived from the runtime
+// metrics rather than the trace. The values not supported by the agent are told unavailable.
+func traceSummaryText(s *stats.TraceSummary) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Traced for:          %v\n", s.Duration.Round(time.Millisecond))
+	b.WriteString("Runtime metrics sampled while tracing, not parsed from the trace:\n")
+	fmt.Fprintf(&b, "GC cycles:           %d\n", s.GCCycles)
+	fmt.Fprintf(&b, "STW pauses:          %d (total ~%v, max <%v)\n", s.STWPauses, s.STWPauseTotal.Round(time.Microsecond), s.STWPauseMax.Round(time.Microsecond))
+	if s.GoroutinesCreated >= 0 {
+		fmt.Fprintf(&b, "Goroutines created:  %d\n", s.GoroutinesCreated)
+	} else {
+		b.WriteString("Goroutines created:  unavailable on this Go version\n")
+	}
+	if s.Running < 0 || s.Runnable < 0 || s.Blocked < 0 || s.Syscall < 0 {
+		b.WriteString("Goroutine time:      breakdown unavailable on this Go version\n")
+		return b.String()
+	}
+	b.WriteString("Goroutine time:      ")
+	states := []struct {
+		name string
+		d    time.Duration
+	}{
+		{"running", s.Running},
+		{"runnable", s.Runnable},
+		{"blocked", s.Blocked},
+		{"syscall", s.Syscall},
+	}
+	var total time.Duration
+	for _, st := range states {
+		total += st.d
+	}
+	parts := make([]string, 0, len(states))
+	for _, st := range states {
+		share := 0.0
+		if total > 0 {
+			share = float64(st.d) / float64(total) * 100
+		}
+		parts = append(parts, fmt.Sprintf("%s %v (%.1f%%)", st.name, st.d.Round(time.Millisecond), share))
+	}
+	b.WriteString(strings.Join(parts, " | "))
+	b.WriteString("\n")
+	return b.String()
+}
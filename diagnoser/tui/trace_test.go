@@ -0,0 +1,128 @@
+package tui
+
+import (
+	"context"
+	"image"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mum4k/termdash"
+	"github.com/mum4k/termdash/container"
+	"github.com/mum4k/termdash/keyboard"
+	"github.com/mum4k/termdash/private/faketerm"
+	"github.com/mum4k/termdash/terminal/terminalapi"
+	"github.com/mum4k/termdash/widgets/text"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/nakabonne/gosivy/stats"
+)
+
+// fakeText keeps the text written last.
+type fakeText struct {
+	Text
+	mu      sync.Mutex
+	content string
+}
+
+func (t *fakeText) Write(s string, _ ...text.WriteOption) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.content = s
+	return nil
+}
+
+func (t *fakeText) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.content
+}
+
+func TestTraceKeybind(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	assert.Nil(t, err)
+	assert.Nil(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	g := NewTUI(time.Hour, cancel, []*Target{{Name: "a", Metadata: stats.Meta{PID: 15788}, Profiler: &fakeProfiler{}}})
+	term, err := faketerm.New(image.Point{X: 200, Y: 100})
+	assert.Nil(t, err)
+	err = g.run(ctx, term, func(context.Context, terminalapi.Terminal, *container.Container, ...termdash.Option) error {
+		return nil
+	})
+	assert.Nil(t, err)
+	summary := &fakeText{}
+	g.Targets[0].widgets.TraceSummary = summary
+	k := g.keybinds(ctx)
+
+	k(&terminalapi.Keyboard{Key: 't'})
+	assert.Equal(t, paneTrace, g.pane)
+	assert.Eventually(t, func() bool {
+		return strings.Contains(summary.String(), "Saved to gosivy-15788-trace-")
+	}, time.Second, 10*time.Millisecond)
+	assert.Contains(t, summary.String(), "GC cycles:           2\n")
+	files, err := ioutil.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Len(t, files, 1)
+
+	k(&terminalapi.Keyboard{Key: keyboard.KeyEsc})
+	assert.Equal(t, paneCharts, g.pane)
+}
+
+func TestTraceSummaryText(t *testing.T) {
+	tests := []struct {
+		name    string
+		summary stats.TraceSummary
+		want    string
+	}{
+		{
+			name: "all supported",
+			summary: stats.TraceSummary{
+				Duration:          5 * time.Second,
+				GCCycles:          3,
+				STWPauses:         6,
+				STWPauseTotal:     1200 * time.Microsecond,
+				STWPauseMax:       512 * time.Microsecond,
+				GoroutinesCreated: 120,
+				Running:           time.Second,
+				Runnable:          0,
+				Blocked:           2 * time.Second,
+				Syscall:           time.Second,
+			},
+			want: "Traced for:          5s\n" +
+				"Runtime metrics sampled while tracing, not parsed from the trace:\n" +
+				"GC cycles:           3\n" +
+				"STW pauses:          6 (total ~1.2ms, max <512µs)\n" +
+				"Goroutines created:  120\n" +
+				"Goroutine time:      running 1s (25.0%) | runnable 0s (0.0%) | blocked 2s (50.0%) | syscall 1s (25.0%)\n",
+		},
+		{
+			name: "unsupported",
+			summary: stats.TraceSummary{
+				Duration:          5 * time.Second,
+				GoroutinesCreated: -1,
+				Running:           -1,
+				Runnable:          -1,
+				Blocked:           -1,
+				Syscall:           -1,
+			},
+			want: "Traced for:          5s\n" +
+				"Runtime metrics sampled while tracing, not parsed from the trace:\n" +
+				"GC cycles:           0\n" +
+				"STW pauses:          0 (total ~0s, max <0s)\n" +
+				"Goroutines created:  unavailable on this Go version\n" +
+				"Goroutine time:      breakdown unavailable on this Go version\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, traceSummaryText(&tt.summary))
+		})
+	}
+}
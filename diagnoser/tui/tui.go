@@ -4,7 +4,10 @@ package tui
 import (
 	"context"
 	"fmt"
+	"math"
 	"runtime"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/mum4k/termdash"
@@ -15,7 +18,9 @@ import (
 	"github.com/mum4k/termdash/terminal/tcell"
 	"github.com/mum4k/termdash/terminal/termbox"
 	"github.com/mum4k/termdash/terminal/terminalapi"
+	"github.com/mum4k/termdash/widgetapi"
 	"github.com/mum4k/termdash/widgets/linechart"
+	"github.com/mum4k/termdash/widgets/text"
 
 	"github.com/nakabonne/gosivy/stats"
 )
@@ -30,31 +35,102 @@ type TUI struct {
 	RedrawInterval time.Duration
 	// The function to quit the application.
 	Cancel context.CancelFunc
-	// A channel for receiving data sources to draw on the chart.
-	StatsCh <-chan *stats.Stats
+	// Processes to be diagnosed, each of which is drawn on its own tab.
+	Targets []*Target
+	// Controls the replay of a recording. It is nil while diagnosing live.
+	Player Player
+	// How long to profile the CPU for.
+	ProfileDuration time.Duration
+	// How long to capture an execution trace for.
+	TraceDuration time.Duration
+
+	container *container.Container
+	mu        sync.Mutex
+	// The index of the target currently shown.
+	current int
+	// Whether the user is typing the time to jump to, and what is typed.
+	seeking   bool
+	seekInput string
+	// The error occurred at the last jump.
+	seekErr error
+	// The message shown in the title, e.g. the result of the export.
+	notice string
+	// Whether the prompt to pick the profile to be captured is shown.
+	capturing bool
+	// What is shown below the metadata.
+	pane pane
+}
+
+// pane is what is shown below the metadata.
+type pane int
+
+const (
+	paneCharts pane = iota
+	paneGoroutines
+	paneTrace
+)
+
+// Target is a process to be diagnosed.
+type Target struct {
+	// The name shown on the tab.
+	Name string
+	// A channel for receiving data sources to draw on the chart along with
+	// when they were taken. A record without stats is sent for every sample
+	// missed, which is drawn as a gap.
+	StatsCh <-chan *stats.Record
 	// Metadata of the process where the agent runs on.
 	Metadata stats.Meta
+	// Samples taken by the agent before attaching, from the oldest,
+	// which are drawn before the ones received from StatsCh. It can be nil.
+	History []*stats.Record
+	// A channel for receiving the metadata of the process which restarted,
+	// sent before its first stats. It can be nil.
+	MetaCh <-chan *stats.Meta
+	// Gives back the name of the restarted process. The name is kept if nil.
+	Rename func(meta *stats.Meta) string
+	// A channel for receiving the health of the connection. It can be nil.
+	StatusCh <-chan Status
+	// A channel for receiving the signal to clear the charts, e.g. on rewinding
+	// the replay. It can be nil.
+	ResetCh <-chan struct{}
+	// Captures profiles from the process. It can be nil.
+	Profiler Profiler
 
 	widgets *widgets
+	// A channel for requesting the series drawn so far.
+	exportCh chan chan<- *sessionExport
 }
 
-func NewTUI(redrawInterval time.Duration, cancel context.CancelFunc, statsCh <-chan *stats.Stats, metadata *stats.Meta) *TUI {
+func NewTUI(redrawInterval time.Duration, cancel context.CancelFunc, targets []*Target) *TUI {
 	if redrawInterval == 0 {
 		redrawInterval = defaultRedrawInterval
 	}
-	if statsCh == nil {
-		statsCh = make(<-chan *stats.Stats)
+	for _, target := range targets {
+		if target.StatsCh == nil {
+			target.StatsCh = make(<-chan *stats.Record)
+		}
+		target.exportCh = make(chan chan<- *sessionExport)
 	}
 	return &TUI{
-		RedrawInterval: redrawInterval,
-		Cancel:         cancel,
-		StatsCh:        statsCh,
-		Metadata:       *metadata,
+		RedrawInterval:  redrawInterval,
+		Cancel:          cancel,
+		Targets:         targets,
+		ProfileDuration: DefaultProfileDuration,
+		TraceDuration:   DefaultTraceDuration,
 	}
 }
 
 // Run starts drawing charts, and blocks until the quit operation is performed.
 func (g *TUI) Run(ctx context.Context) error {
+	t, err := newTerminal()
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+	return g.run(ctx, t, termdash.Run)
+}
+
+func newTerminal() (terminalapi.Terminal, error) {
 	var (
 		t   terminalapi.Terminal
 		err error
@@ -65,10 +141,9 @@ func (g *TUI) Run(ctx context.Context) error {
 		t, err = termbox.New(termbox.ColorMode(terminalapi.ColorMode256))
 	}
 	if err != nil {
-		return fmt.Errorf("failed to generate terminal interface: %w", err)
+		return nil, fmt.Errorf("failed to generate terminal interface: %w", err)
 	}
-	defer t.Close()
-	return g.run(ctx, t, termdash.Run)
+	return t, nil
 }
 
 type runner func(ctx context.Context, t terminalapi.Terminal, c *container.Container, opts ...termdash.Option) error
@@ -79,25 +154,140 @@ func (g *TUI) run(ctx context.Context, t terminalapi.Terminal, r runner) error {
 		return fmt.Errorf("failed to generate container: %w", err)
 	}
 
-	g.widgets, err = newWidgets(&g.Metadata)
-	if err != nil {
-		return fmt.Errorf("failed to generate widgets: %w", err)
+	if len(g.Targets) == 0 {
+		return fmt.Errorf("no target given")
+	}
+	for _, target := range g.Targets {
+		target.widgets, err = newWidgets(&target.Metadata)
+		if err != nil {
+			return fmt.Errorf("failed to generate widgets: %w", err)
+		}
+	}
+
+	g.container = c
+	if err := g.showTab(0); err != nil {
+		return err
+	}
+
+	for _, target := range g.Targets {
+		go g.appendStats(ctx, target)
+	}
+	if g.Player != nil {
+		go g.refreshPlayerState(ctx)
+	}
+
+	k := g.keybinds(ctx)
+
+	return r(ctx, t, c, termdash.KeyboardSubscriber(k), termdash.RedrawInterval(g.RedrawInterval))
+}
+
+// showTab switches the dashboard to the target at the given index.
+func (g *TUI) showTab(i int) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if i < 0 || i >= len(g.Targets) {
+		return fmt.Errorf("no tab at %d", i)
+	}
+	if err := g.layout(i); err != nil {
+		return err
 	}
+	g.current = i
+	return nil
+}
 
-	opts, err := gridLayout(g.widgets)
+// layout lays out the widgets of the target at the given index. The caller must hold mu.
+func (g *TUI) layout(i int) error {
+	target := g.Targets[i]
+	statusTitle := "Connection"
+	if g.Player != nil {
+		statusTitle = playerTitle
+	}
+	title := tabTitle(g.Targets, i)
+	if g.notice != "" {
+		title += " | " + g.notice
+	}
+	var (
+		opts []container.Option
+		err  error
+	)
+	switch g.pane {
+	case paneGoroutines:
+		opts, err = paneLayout(target.widgets, target.widgets.Goroutines, goroutinesTitle, title, statusTitle)
+	case paneTrace:
+		opts, err = paneLayout(target.widgets, target.widgets.TraceSummary, traceTitle, title, statusTitle)
+	default:
+		opts, err = gridLayout(target.widgets, &target.Metadata, title, statusTitle)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to build grid layout: %w", err)
 	}
-
-	if err := c.Update(rootID, opts...); err != nil {
+	if err := g.container.Update(rootID, opts...); err != nil {
 		return fmt.Errorf("failed to update container: %w", err)
 	}
+	return nil
+}
 
-	go g.appendStats(ctx)
+// showPane switches what is shown below the metadata.
+func (g *TUI) showPane(p pane) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.pane = p
+	g.layout(g.current)
+}
 
-	k := keybinds(g.Cancel)
+// setNotice shows the given message in the title. An empty message clears it.
+func (g *TUI) setNotice(notice string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.notice = notice
+	g.layout(g.current)
+}
 
-	return r(ctx, t, c, termdash.KeyboardSubscriber(k), termdash.RedrawInterval(g.RedrawInterval))
+// resetWidgets replaces the widgets of the given target with the blank ones.
+func (g *TUI) resetWidgets(target *Target) error {
+	w, err := newWidgets(&target.Metadata)
+	if err != nil {
+		return fmt.Errorf("failed to generate widgets: %w", err)
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	target.widgets = w
+	if g.container == nil || g.Targets[g.current] != target {
+		return nil
+	}
+	return g.layout(g.current)
+}
+
+// switchTab moves the given number of tabs from the current one, wrapping around the ends.
+func (g *TUI) switchTab(delta int) error {
+	g.mu.Lock()
+	n := len(g.Targets)
+	i := ((g.current+delta)%n + n) % n
+	g.mu.Unlock()
+	return g.showTab(i)
+}
+
+// currentWidgets gives back the widgets of the target currently shown.
+func (g *TUI) currentWidgets() *widgets {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.Targets[g.current].widgets
+}
+
+// tabTitle lists the targets with the current one bracketed, along with the usage.
+func tabTitle(targets []*Target, current int) string {
+	if len(targets) == 1 {
+		return "Press Q to quit"
+	}
+	names := make([]string, 0, len(targets))
+	for i, target := range targets {
+		name := fmt.Sprintf("%d:%s", i+1, target.Name)
+		if i == current {
+			name = "[" + name + "]"
+		}
+		names = append(names, name)
+	}
+	return strings.Join(names, " ") + " | Press Tab to switch, Q to quit"
 }
 
 // gridLayout gives back options for grid layout, which is composed by rows that inside of the rows
@@ -110,32 +300,103 @@ func (g *TUI) run(ctx context.Context, t terminalapi.Terminal, r runner) error {
 // ----------------------------------------------------
 // [-element-]       [----element----]        [element]
 // ----------------------------------------------------
-func gridLayout(w *widgets) ([]container.Option, error) {
-	raw1 := grid.RowHeightPerc(7,
-		grid.Widget(w.Metadata, container.Border(linestyle.Light), container.BorderTitle("Press Q to quit")),
-	)
-	raw2 := grid.RowHeightPerc(45,
-		grid.ColWidthPerc(50, grid.Widget(w.CPUChart, container.Border(linestyle.Light), container.BorderTitle("CPU Usage (%)"))),
-		grid.ColWidthPerc(50, grid.Widget(w.GoroutineChart, container.Border(linestyle.Light), container.BorderTitle("Goroutines"))),
-	)
-	raw3 := grid.RowHeightPercWithOpts(45,
-		[]container.Option{container.Border(linestyle.Light), container.BorderTitle("Heap (MB)")},
-		grid.RowHeightPerc(97, grid.ColWidthPerc(99, grid.Widget(w.HeapChart))),
-		grid.RowHeightPercWithOpts(3,
-			[]container.Option{container.MarginLeftPercent(w.HeapChart.Options().MinimumSize.X)},
-			textsInColumn(w.HeapIdelLegend.text, w.HeapInuseLegend.text, w.HeapAllocLegend.text)...,
+func gridLayout(w *widgets, meta *stats.Meta, title, statusTitle string) ([]container.Option, error) {
+	const metadataHeight = 7
+	rows := []func(height int) grid.Element{
+		func(height int) grid.Element {
+			return grid.RowHeightPerc(height,
+				grid.ColWidthPerc(33, grid.Widget(w.CPUChart, container.Border(linestyle.Light), container.BorderTitle("CPU Usage (%)"))),
+				grid.ColWidthPerc(33, grid.Widget(w.GoroutineChart, container.Border(linestyle.Light), container.BorderTitle("Goroutines"))),
+				grid.ColWidthPerc(34, grid.Widget(w.SchedLatencyHeatmap, container.Border(linestyle.Light), container.BorderTitle("Scheduler Latency"))),
+			)
+		},
+		func(height int) grid.Element {
+			return grid.RowHeightPerc(height,
+				grid.ColWidthPercWithOpts(70,
+					[]container.Option{container.Border(linestyle.Light), container.BorderTitle("Heap (MB)")},
+					grid.RowHeightPerc(97, grid.ColWidthPerc(99, grid.Widget(w.HeapChart))),
+					grid.RowHeightPercWithOpts(3,
+						[]container.Option{container.MarginLeftPercent(w.HeapChart.Options().MinimumSize.X)},
+						textsInColumn(w.HeapIdelLegend.text, w.HeapInuseLegend.text, w.HeapAllocLegend.text)...,
+					),
+				),
+				grid.ColWidthPerc(30, grid.Widget(w.MemStats, container.Border(linestyle.Light), container.BorderTitle("Memory"))),
+			)
+		},
+		func(height int) grid.Element {
+			return grid.RowHeightPerc(height,
+				grid.ColWidthPerc(40, grid.Widget(w.GCPauseChart, container.Border(linestyle.Light), container.BorderTitle("GC Pause (ms)"))),
+				grid.ColWidthPerc(40, grid.Widget(w.GCRateChart, container.Border(linestyle.Light), container.BorderTitle("GC Cycles (/s)"))),
+				grid.ColWidthPerc(20, grid.Widget(w.GCStats, container.Border(linestyle.Light), container.BorderTitle("GC"))),
+			)
+		},
+	}
+	if len(w.CustomCharts) > 0 {
+		rows = append(rows, func(height int) grid.Element {
+			return grid.RowHeightPerc(height, customChartsInColumn(w.CustomCharts, meta.CustomMetrics)...)
+		})
+	}
+	if meta.Expvar {
+		rows = append(rows, func(height int) grid.Element {
+			return grid.RowHeightPerc(height,
+				grid.ColWidthPerc(25, grid.Widget(w.ExpvarSelector, container.Border(linestyle.Light), container.BorderTitle("Expvar (↑↓ Space)"))),
+				grid.ColWidthPerc(75, grid.Widget(w.ExpvarChart, container.Border(linestyle.Light))),
+			)
+		})
+	}
+
+	builder := grid.New()
+	builder.Add(
+		grid.RowHeightPerc(metadataHeight,
+			grid.ColWidthPerc(60, grid.Widget(w.Metadata, container.Border(linestyle.Light), container.BorderTitle(title))),
+			grid.ColWidthPerc(40, grid.Widget(w.Status, container.Border(linestyle.Light), container.BorderTitle(statusTitle))),
 		),
 	)
+	// Split the rest evenly, the last row takes the remainder.
+	height := (100 - metadataHeight) / len(rows)
+	for i, row := range rows {
+		if i == len(rows)-1 {
+			height = 100 - metadataHeight - height*(len(rows)-1)
+		}
+		builder.Add(row(height))
+	}
+
+	return builder.Build()
+}
+
+// paneLayout gives back options for the layout where the given pane replaces the charts.
+func paneLayout(w *widgets, pane widgetapi.Widget, paneTitle, title, statusTitle string) ([]container.Option, error) {
+	const metadataHeight = 7
 	builder := grid.New()
 	builder.Add(
-		raw1,
-		raw2,
-		raw3,
+		grid.RowHeightPerc(metadataHeight,
+			grid.ColWidthPerc(60, grid.Widget(w.Metadata, container.Border(linestyle.Light), container.BorderTitle(title))),
+			grid.ColWidthPerc(40, grid.Widget(w.Status, container.Border(linestyle.Light), container.BorderTitle(statusTitle))),
+		),
+		grid.RowHeightPerc(100-metadataHeight,
+			grid.Widget(pane, container.Border(linestyle.Light), container.BorderTitle(paneTitle)),
+		),
 	)
-
 	return builder.Build()
 }
 
+func customChartsInColumn(charts []LineChart, metrics []stats.CustomMetric) []grid.Element {
+	els := make([]grid.Element, 0, len(charts))
+	// A column must be narrower than 100%.
+	width := 100 / len(charts)
+	if width >= 100 {
+		width = 99
+	}
+	for i, chart := range charts {
+		title := metrics[i].Name
+		if metrics[i].Kind == stats.CustomMetricCounter {
+			title += " (/s)"
+		}
+		els = append(els, grid.ColWidthPerc(width, grid.Widget(chart, container.Border(linestyle.Light), container.BorderTitle(title))))
+	}
+	return els
+}
+
 func textsInColumn(texts ...Text) []grid.Element {
 	els := make([]grid.Element, 0, len(texts))
 	for _, text := range texts {
@@ -146,9 +407,19 @@ func textsInColumn(texts ...Text) []grid.Element {
 	return els
 }
 
-// appendStats appends entities as soon as a stats arrives.
+// appendStats appends entities to the widgets of the given target as soon as a stats arrives.
 // Note that it doesn't redraw the moment stats are appended.
-func (g *TUI) appendStats(ctx context.Context) {
+func (g *TUI) appendStats(ctx context.Context, target *Target) {
+	for g.appendSeries(ctx, target) {
+		if err := g.resetWidgets(target); err != nil {
+			return
+		}
+	}
+}
+
+// appendSeries keeps appending the stats to the series held by itself,
+// and tells if it has returned to reset them.
+func (g *TUI) appendSeries(ctx context.Context, target *Target) bool {
 	const (
 		// originally based on http://golang.org/doc/progs/eff_bytesize.go
 		_               = iota
@@ -161,37 +432,404 @@ func (g *TUI) appendStats(ctx context.Context) {
 		allocs     = make([]float64, 0)
 		idles      = make([]float64, 0)
 		inuses     = make([]float64, 0)
+		gcPauses   = make([]float64, 0)
+		gcRates    = make([]float64, 0)
+		prevGC     *stats.GCStats
+
+		schedLatencies = make([][]uint64, 0)
+		schedLabels    []string
+
+		customValues = make([][]float64, len(target.Metadata.CustomMetrics))
+		prevCustom   map[string]float64
+
+		// The number of samples so far.
+		numSamples   int
+		expvarValues = make(map[string][]float64)
+		// The lower and upper bounds of the gauges sampled by the agent between the samples.
+		goroutineBand = newBand(stats.GaugeGoroutines, 1)
+		allocBand     = newBand(stats.GaugeHeapAlloc, float64(megabyte))
+		// When each sample was taken.
+		times = make([]time.Time, 0)
+		// The last error on drawing the charts, which is reported only once.
+		drawErr error
 	)
 
+	// report shows the given error on drawing in the title unless it's already shown.
+	report := func(err error) {
+		if err != nil && (drawErr == nil || err.Error() != drawErr.Error()) {
+			g.setNotice(fmt.Sprintf("Failed to draw the charts of %s: %v", target.Name, err))
+		}
+		drawErr = err
+	}
+
+	// appendSample appends the given stats, or a gap if nil, taken at the given time.
+	// The rates are computed over the time since the previous sample.
+	appendSample := func(s *stats.Stats, at time.Time) {
+		interval := g.RedrawInterval
+		if len(times) > 0 && at.After(times[len(times)-1]) {
+			interval = at.Sub(times[len(times)-1])
+		}
+		numSamples++
+		times = append(times, at)
+		if s == nil {
+			// Leave a gap where the sample was missed.
+			cpuUsages = append(cpuUsages, math.NaN())
+			goroutines = append(goroutines, math.NaN())
+			allocs = append(allocs, math.NaN())
+			idles = append(idles, math.NaN())
+			inuses = append(inuses, math.NaN())
+			gcPauses = append(gcPauses, math.NaN())
+			gcRates = append(gcRates, math.NaN())
+			goroutineBand.append(nil)
+			allocBand.append(nil)
+			if schedLabels != nil {
+				schedLatencies = append(schedLatencies, make([]uint64, len(schedLabels)))
+			}
+			for i := range customValues {
+				customValues[i] = append(customValues[i], math.NaN())
+			}
+			if target.Metadata.Expvar {
+				target.appendExpvars(expvarValues, nil, numSamples)
+			}
+			// The deltas across the gap would be inflated.
+			prevGC = nil
+			prevCustom = nil
+		} else {
+			cpuUsages = append(cpuUsages, s.CPUUsage)
+			goroutines = append(goroutines, float64(s.Goroutines))
+			allocs = append(allocs, float64(s.HeapAlloc/megabyte))
+			idles = append(idles, float64(s.HeapIdle/megabyte))
+			inuses = append(inuses, float64(s.HeapInuse/megabyte))
+			goroutineBand.append(s.Ranges)
+			allocBand.append(s.Ranges)
+			if prevGC != nil {
+				pauses := completedPauses(prevGC, &s.GCStats)
+				gcPauses = append(gcPauses, float64(maxPause(pauses))/float64(time.Millisecond))
+				gcRates = append(gcRates, float64(len(pauses))/interval.Seconds())
+			} else {
+				// Keep aligned with the other series.
+				gcPauses = append(gcPauses, math.NaN())
+				gcRates = append(gcRates, math.NaN())
+			}
+			prevGC = &s.GCStats
+			if h := s.SchedLatencies; h != nil {
+				schedLatencies = append(schedLatencies, h.Counts)
+				if schedLabels == nil {
+					schedLabels = latencyLabels(h.Buckets)
+				}
+			}
+			for i, m := range target.Metadata.CustomMetrics {
+				v, ok := s.CustomMetrics[m.Name]
+				if !ok {
+					v = math.NaN()
+				}
+				if m.Kind == stats.CustomMetricCounter {
+					if prev, ok := prevCustom[m.Name]; ok {
+						v = (v - prev) / interval.Seconds()
+					} else {
+						v = math.NaN()
+					}
+				}
+				customValues[i] = append(customValues[i], v)
+			}
+			prevCustom = s.CustomMetrics
+			if s.Expvars != nil {
+				target.appendExpvars(expvarValues, s.Expvars, numSamples)
+			}
+			target.widgets.MemStats.Write(memStatsText(&s.MemStats), text.WriteReplace())
+			target.widgets.GCStats.Write(gcStatsText(&s.GCStats), text.WriteReplace())
+		}
+
+		errs := []error{
+			target.widgets.CPUChart.Series("cpu-usage", cpuUsages,
+				linechart.SeriesCellOpts(cell.FgColor(cell.ColorNumber(87))),
+			),
+			target.widgets.GoroutineChart.Series("goroutines", goroutines,
+				linechart.SeriesCellOpts(cell.FgColor(cell.ColorNumber(87))),
+			),
+			goroutineBand.draw(target.widgets.GoroutineChart, "goroutines"),
+			target.widgets.HeapChart.Series("alloc", allocs,
+				linechart.SeriesCellOpts(target.widgets.HeapAllocLegend.cellOpts...),
+			),
+			allocBand.draw(target.widgets.HeapChart, "alloc"),
+			target.widgets.HeapChart.Series("idle", idles,
+				linechart.SeriesCellOpts(target.widgets.HeapIdelLegend.cellOpts...),
+			),
+			target.widgets.HeapChart.Series("inuse", inuses,
+				linechart.SeriesCellOpts(target.widgets.HeapInuseLegend.cellOpts...),
+			),
+			target.widgets.GCPauseChart.Series("gc-pause", gcPauses,
+				linechart.SeriesCellOpts(cell.FgColor(cell.ColorNumber(87))),
+			),
+			target.widgets.GCRateChart.Series("gc-rate", gcRates,
+				linechart.SeriesCellOpts(cell.FgColor(cell.ColorNumber(87))),
+			),
+		}
+		for i, m := range target.Metadata.CustomMetrics {
+			errs = append(errs, target.widgets.CustomCharts[i].Series(m.Name, customValues[i],
+				linechart.SeriesCellOpts(cell.FgColor(cell.ColorNumber(87))),
+			))
+		}
+		if schedLabels != nil {
+			if err := target.widgets.SchedLatencyHeatmap.Values(schedLatencies, schedLabels); err != nil {
+				errs = append(errs, fmt.Errorf("failed to draw the scheduler latencies: %w", err))
+			}
+		}
+		report(firstError(errs))
+	}
+	for _, rec := range target.History {
+		appendSample(rec.Stats, rec.Time)
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
-			return
-		case stats := <-g.StatsCh:
-			if stats == nil {
+			return false
+		case <-target.ResetCh:
+			return true
+		case resCh := <-target.exportCh:
+			series := map[string][]float64{
+				"cpu-usage-percent":  cpuUsages,
+				"goroutines":         goroutines,
+				"heap-alloc-mb":      allocs,
+				"heap-idle-mb":       idles,
+				"heap-inuse-mb":      inuses,
+				"gc-pause-ms":        gcPauses,
+				"gc-rate-per-second": gcRates,
+			}
+			for i, m := range target.Metadata.CustomMetrics {
+				series["custom:"+m.Name] = customValues[i]
+			}
+			for name, vs := range expvarValues {
+				series["expvar:"+name] = vs
+			}
+			resCh <- newSessionExport(&target.Metadata, times, series)
+		case m := <-target.MetaCh:
+			if m == nil {
 				continue
 			}
-			cpuUsages = append(cpuUsages, stats.CPUUsage)
-			goroutines = append(goroutines, float64(stats.Goroutines))
-			allocs = append(allocs, float64(stats.HeapAlloc/megabyte))
-			idles = append(idles, float64(stats.HeapIdle/megabyte))
-			inuses = append(inuses, float64(stats.HeapInuse/megabyte))
+			values, err := g.refreshMetadata(target, m, customValues, numSamples)
+			if err != nil {
+				report(err)
+				continue
+			}
+			customValues = values
+			// Mark where the samples of the restarted process start on every chart.
+			w := target.widgets
+			w.CPUChart.Mark(len(cpuUsages))
+			w.GoroutineChart.Mark(len(goroutines))
+			w.SchedLatencyHeatmap.Mark(len(schedLatencies))
+			w.HeapChart.Mark(len(allocs))
+			w.GCPauseChart.Mark(len(gcPauses))
+			w.GCRateChart.Mark(len(gcRates))
+			for i, c := range w.CustomCharts {
+				c.Mark(len(customValues[i]))
+			}
+			w.ExpvarChart.Mark(numSamples)
+			w.Metadata.Write(m.String(), text.WriteReplace())
+			// The cumulative values start over in the new process.
+			prevGC = nil
+			prevCustom = nil
+		case status := <-target.StatusCh:
+			writeStatus(target.widgets.Status, status)
+		case rec := <-target.StatsCh:
+			appendSample(rec.Stats, rec.Time)
+		}
+	}
+}
 
-			g.widgets.CPUChart.Series("cpu-usage", cpuUsages,
-				linechart.SeriesCellOpts(cell.FgColor(cell.ColorNumber(87))),
-			)
-			g.widgets.GoroutineChart.Series("goroutines", goroutines,
-				linechart.SeriesCellOpts(cell.FgColor(cell.ColorNumber(87))),
-			)
-			g.widgets.HeapChart.Series("alloc", allocs,
-				linechart.SeriesCellOpts(g.widgets.HeapAllocLegend.cellOpts...),
-			)
-			g.widgets.HeapChart.Series("idle", idles,
-				linechart.SeriesCellOpts(g.widgets.HeapIdelLegend.cellOpts...),
-			)
-			g.widgets.HeapChart.Series("inuse", inuses,
-				linechart.SeriesCellOpts(g.widgets.HeapInuseLegend.cellOpts...),
-			)
+// refreshMetadata replaces the metadata and the name of the given target with the ones
+// of the restarted process. The custom metrics still exported keep their charts, and
+// the newly exported ones start with gaps. It gives back the values of the custom metrics
+// ordered as the new metadata.
+func (g *TUI) refreshMetadata(target *Target, meta *stats.Meta, customValues [][]float64, numSamples int) ([][]float64, error) {
+	prev := target.Metadata.CustomMetrics
+	charts := make([]LineChart, 0, len(meta.CustomMetrics))
+	values := make([][]float64, 0, len(meta.CustomMetrics))
+	for _, m := range meta.CustomMetrics {
+		i := indexCustomMetric(prev, m)
+		if i >= 0 {
+			charts = append(charts, target.widgets.CustomCharts[i])
+			values = append(values, customValues[i])
+			continue
+		}
+		c, err := newLineChart()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate the chart of %s: %w", m.Name, err)
 		}
+		charts = append(charts, c)
+		values = append(values, nanValues(numSamples))
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	target.Metadata = *meta
+	if target.Rename != nil {
+		target.Name = target.Rename(meta)
+	}
+	target.widgets.CustomCharts = charts
+	if g.container == nil {
+		return values, nil
+	}
+	// The tab title lists the names of all targets.
+	return values, g.layout(g.current)
+}
+
+// indexCustomMetric gives back the index of the given custom metric in the metrics,
+// or -1 if not found.
+func indexCustomMetric(metrics []stats.CustomMetric, m stats.CustomMetric) int {
+	for i, mm := range metrics {
+		if mm == m {
+			return i
+		}
+	}
+	return -1
+}
+
+// firstError gives back the first non-nil error of the given ones.
+func firstError(errs []error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendExpvars appends the given expvar values to the history, and then
+// draws only the variables selected via the selector.
+// Missing values are filled with NaN so that all series are aligned.
+func (t *Target) appendExpvars(history map[string][]float64, values map[string]float64, numSamples int) {
+	for name, v := range values {
+		if _, ok := history[name]; !ok {
+			// Newly published variable.
+			history[name] = nanValues(numSamples - 1)
+		}
+		history[name] = append(history[name], v)
+	}
+	names := make([]string, 0, len(history))
+	for name, vs := range history {
+		if len(vs) < numSamples {
+			history[name] = append(vs, math.NaN())
+		}
+		names = append(names, name)
+	}
+	t.widgets.ExpvarSelector.SetItems(names)
+
+	selected := t.widgets.ExpvarSelector.Selected()
+	for _, name := range names {
+		color, ok := selected[name]
+		if !ok {
+			t.widgets.ExpvarChart.Series(name, nil)
+			continue
+		}
+		t.widgets.ExpvarChart.Series(name, history[name],
+			linechart.SeriesCellOpts(cell.FgColor(color)),
+		)
+	}
+}
+
+func nanValues(n int) []float64 {
+	vs := make([]float64, 0, n)
+	for i := 0; i < n; i++ {
+		vs = append(vs, math.NaN())
+	}
+	return vs
+}
+
+// memStatsText formats the given memory statistics to be shown in a column.
+func memStatsText(m *stats.MemStats) string {
+	var b strings.Builder
+	rows := []struct {
+		name  string
+		value string
+	}{
+		{"Sys", formatBytes(m.Sys)},
+		{"HeapSys", formatBytes(m.HeapSys)},
+		{"HeapAlloc", formatBytes(m.HeapAlloc)},
+		{"HeapInuse", formatBytes(m.HeapInuse)},
+		{"HeapIdle", formatBytes(m.HeapIdle)},
+		{"HeapReleased", formatBytes(m.HeapReleased)},
+		{"HeapObjects", fmt.Sprint(m.HeapObjects)},
+		{"StackInuse", formatBytes(m.StackInuse)},
+		{"MSpanInuse", formatBytes(m.MSpanInuse)},
+		{"MCacheInuse", formatBytes(m.MCacheInuse)},
+		{"Mallocs", fmt.Sprint(m.Mallocs)},
+		{"Frees", fmt.Sprint(m.Frees)},
+		{"TotalAlloc", formatBytes(m.TotalAlloc)},
+		{"NextGC", formatBytes(m.NextGC)},
+	}
+	for _, r := range rows {
+		fmt.Fprintf(&b, "%-13s %s\n", r.name, r.value)
+	}
+	return b.String()
+}
+
+// gcStatsText formats the given garbage collector statistics to be shown in a column.
+func gcStatsText(s *stats.GCStats) string {
+	lastGC := "-"
+	if s.LastGC != 0 {
+		lastGC = time.Unix(0, int64(s.LastGC)).Format("15:04:05")
+	}
+	return fmt.Sprintf("%-11s %d\n%-11s %v\n%-11s %s\n%-11s %.2f%%\n",
+		"NumGC", s.NumGC,
+		"PauseTotal", time.Duration(s.PauseTotalNs),
+		"LastGC", lastGC,
+		"GC CPU", s.GCCPUFraction*100,
+	)
+}
+
+// completedPauses gives back the pause times of the GC cycles
+// which were completed between the previous and the current samples.
+func completedPauses(prev, cur *stats.GCStats) []uint64 {
+	if cur.NumGC <= prev.NumGC {
+		return []uint64{}
+	}
+	n := cur.NumGC - prev.NumGC
+	if size := uint32(len(cur.PauseNs)); n > size {
+		// Older pauses have already been overwritten.
+		n = size
+	}
+	pauses := make([]uint64, 0, n)
+	for i := uint32(0); i < n; i++ {
+		pauses = append(pauses, cur.PauseNs[(cur.NumGC-i+255)%256])
+	}
+	return pauses
+}
+
+func maxPause(pauses []uint64) uint64 {
+	var max uint64
+	for _, p := range pauses {
+		if p > max {
+			max = p
+		}
+	}
+	return max
+}
+
+// latencyLabels gives back the labels for the buckets of a latency histogram,
+// each of which indicates the lower bound of the bucket.
+func latencyLabels(buckets []float64) []string {
+	if len(buckets) == 0 {
+		return []string{}
+	}
+	labels := make([]string, 0, len(buckets)-1)
+	for _, b := range buckets[:len(buckets)-1] {
+		labels = append(labels, time.Duration(b*float64(time.Second)).String())
+	}
+	return labels
+}
+
+// formatBytes converts the given bytes into a human-readable string.
+func formatBytes(b uint64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := uint64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
 	}
+	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
 }
@@ -3,12 +3,19 @@ package tui
 import (
 	"context"
 	"fmt"
+	"image"
+	"math"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/golang/mock/gomock"
 	"github.com/mum4k/termdash"
 	"github.com/mum4k/termdash/container"
+	"github.com/mum4k/termdash/private/faketerm"
 	"github.com/mum4k/termdash/terminal/termbox"
 	"github.com/mum4k/termdash/terminal/terminalapi"
+	"github.com/mum4k/termdash/widgets/linechart"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/nakabonne/gosivy/stats"
@@ -38,10 +45,313 @@ func TestRun(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			ctx, cancel := context.WithCancel(context.Background())
-			g := NewTUI(0, cancel, nil, &stats.Meta{})
+			g := NewTUI(0, cancel, []*Target{{}})
 			err := g.run(ctx, &termbox.Terminal{}, tt.r)
 			assert.Equal(t, tt.wantErr, err != nil)
 			cancel()
 		})
 	}
 }
+
+func TestSwitchTab(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	g := NewTUI(0, cancel, []*Target{{Name: "a"}, {Name: "b"}, {Name: "c"}})
+	term, err := faketerm.New(image.Point{X: 200, Y: 100})
+	assert.Nil(t, err)
+	err = g.run(ctx, term, func(context.Context, terminalapi.Terminal, *container.Container, ...termdash.Option) error {
+		return nil
+	})
+	assert.Nil(t, err)
+
+	assert.Nil(t, g.switchTab(1))
+	assert.Equal(t, 1, g.current)
+	assert.Nil(t, g.switchTab(-2))
+	assert.Equal(t, 2, g.current)
+	assert.Nil(t, g.switchTab(1))
+	assert.Equal(t, 0, g.current)
+	assert.NotNil(t, g.showTab(3))
+	assert.Equal(t, 0, g.current)
+	assert.Equal(t, g.Targets[0].widgets, g.currentWidgets())
+}
+
+func TestTabTitle(t *testing.T) {
+	tests := []struct {
+		name    string
+		targets []*Target
+		current int
+		want    string
+	}{
+		{
+			name:    "single target",
+			targets: []*Target{{Name: "foo(1)"}},
+			want:    "Press Q to quit",
+		},
+		{
+			name:    "multiple targets",
+			targets: []*Target{{Name: "foo(1)"}, {Name: "foo(2)"}},
+			current: 1,
+			want:    "1:foo(1) [2:foo(2)] | Press Tab to switch, Q to quit",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tabTitle(tt.targets, tt.current)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestGridLayout(t *testing.T) {
+	meta := &stats.Meta{
+		CustomMetrics: []stats.CustomMetric{
+			{Name: "queue-depth", Kind: stats.CustomMetricGauge},
+			{Name: "cache-hits", Kind: stats.CustomMetricCounter},
+		},
+	}
+	w, err := newWidgets(meta)
+	assert.Nil(t, err)
+	assert.Len(t, w.CustomCharts, 2)
+	_, err = gridLayout(w, meta, "Press Q to quit", "Connection")
+	assert.Nil(t, err)
+
+	// A single custom metric takes up the whole row.
+	meta.CustomMetrics = meta.CustomMetrics[:1]
+	w, err = newWidgets(meta)
+	assert.Nil(t, err)
+	_, err = gridLayout(w, meta, "Press Q to quit", "Connection")
+	assert.Nil(t, err)
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		name string
+		b    uint64
+		want string
+	}{
+		{
+			name: "bytes",
+			b:    512,
+			want: "512 B",
+		},
+		{
+			name: "kibibytes",
+			b:    1536,
+			want: "1.5 KiB",
+		},
+		{
+			name: "mebibytes",
+			b:    10 << 20,
+			want: "10.0 MiB",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := formatBytes(tt.b)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCompletedPauses(t *testing.T) {
+	ring := [256]uint64{}
+	for i := range ring {
+		ring[i] = uint64(i)
+	}
+	tests := []struct {
+		name string
+		prev *stats.GCStats
+		cur  *stats.GCStats
+		want []uint64
+	}{
+		{
+			name: "no cycles completed",
+			prev: &stats.GCStats{NumGC: 3, PauseNs: ring},
+			cur:  &stats.GCStats{NumGC: 3, PauseNs: ring},
+			want: []uint64{},
+		},
+		{
+			name: "two cycles completed",
+			prev: &stats.GCStats{NumGC: 3, PauseNs: ring},
+			cur:  &stats.GCStats{NumGC: 5, PauseNs: ring},
+			want: []uint64{4, 3},
+		},
+		{
+			name: "wrap around the ring",
+			prev: &stats.GCStats{NumGC: 255, PauseNs: ring},
+			cur:  &stats.GCStats{NumGC: 257, PauseNs: ring},
+			want: []uint64{0, 255},
+		},
+		{
+			name: "more cycles than the ring holds",
+			prev: &stats.GCStats{NumGC: 0, PauseNs: ring},
+			cur:  &stats.GCStats{NumGC: 1000, PauseNs: ring},
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := completedPauses(tt.prev, tt.cur)
+			if tt.want == nil {
+				assert.Len(t, got, 256)
+				return
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestAppendExpvars(t *testing.T) {
+	w, err := newWidgets(&stats.Meta{})
+	assert.Nil(t, err)
+	target := &Target{widgets: w}
+	history := make(map[string][]float64)
+
+	target.appendExpvars(history, map[string]float64{"a": 1}, 1)
+	target.appendExpvars(history, map[string]float64{"b": 2}, 2)
+
+	assert.Equal(t, []float64{1}, history["a"][:1])
+	assert.True(t, math.IsNaN(history["a"][1]))
+	assert.True(t, math.IsNaN(history["b"][0]))
+	assert.Equal(t, []float64{2}, history["b"][1:])
+}
+
+func TestAppendStatsWithGap(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	w, err := newWidgets(&stats.Meta{})
+	assert.Nil(t, err)
+	cpuValues := make(chan []float64)
+	cpuChart := NewMockLineChart(ctrl)
+	cpuChart.EXPECT().Series("cpu-usage", gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ string, values []float64, _ ...linechart.SeriesOption) error {
+			cpuValues <- append([]float64{}, values...)
+			return nil
+		},
+	).Times(3)
+	w.CPUChart = cpuChart
+
+	statsCh := make(chan *stats.Record)
+	target := &Target{StatsCh: statsCh, widgets: w}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	g := &TUI{RedrawInterval: time.Second}
+	go g.appendStats(ctx, target)
+
+	statsCh <- &stats.Record{Time: time.Now(), Stats: &stats.Stats{CPUUsage: 10}}
+	assert.Equal(t, []float64{10}, <-cpuValues)
+	// The missed sample is drawn as a gap.
+	statsCh <- &stats.Record{Time: time.Now()}
+	got := <-cpuValues
+	assert.Len(t, got, 2)
+	assert.True(t, math.IsNaN(got[1]))
+	statsCh <- &stats.Record{Time: time.Now(), Stats: &stats.Stats{CPUUsage: 20}}
+	got = <-cpuValues
+	assert.Len(t, got, 3)
+	assert.Equal(t, 20.0, got[2])
+}
+
+func TestAppendStatsWithHistory(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	w, err := newWidgets(&stats.Meta{})
+	assert.Nil(t, err)
+	cpuValues := make(chan []float64)
+	cpuChart := NewMockLineChart(ctrl)
+	cpuChart.EXPECT().Series("cpu-usage", gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ string, values []float64, _ ...linechart.SeriesOption) error {
+			cpuValues <- append([]float64{}, values...)
+			return nil
+		},
+	).Times(3)
+	w.CPUChart = cpuChart
+
+	statsCh := make(chan *stats.Record)
+	now := time.Now()
+	target := &Target{
+		StatsCh: statsCh,
+		History: []*stats.Record{
+			{Time: now.Add(-2 * time.Second), Stats: &stats.Stats{CPUUsage: 10}},
+			{Time: now.Add(-time.Second), Stats: &stats.Stats{CPUUsage: 20}},
+		},
+		widgets: w,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	g := &TUI{RedrawInterval: time.Second}
+	go g.appendStats(ctx, target)
+
+	// The history is drawn before the live samples.
+	assert.Equal(t, []float64{10}, <-cpuValues)
+	assert.Equal(t, []float64{10, 20}, <-cpuValues)
+	statsCh <- &stats.Record{Time: time.Now(), Stats: &stats.Stats{CPUUsage: 30}}
+	assert.Equal(t, []float64{10, 20, 30}, <-cpuValues)
+}
+
+func TestAppendStatsReportsDrawError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	statsCh := make(chan *stats.Record)
+	g := NewTUI(0, cancel, []*Target{{Name: "a", StatsCh: statsCh}})
+	term, err := faketerm.New(image.Point{X: 200, Y: 100})
+	assert.Nil(t, err)
+	err = g.run(ctx, term, func(context.Context, terminalapi.Terminal, *container.Container, ...termdash.Option) error {
+		return nil
+	})
+	assert.Nil(t, err)
+
+	// The number of buckets changes midway.
+	statsCh <- &stats.Record{Time: time.Now(), Stats: &stats.Stats{SchedLatencies: &stats.Histogram{Counts: []uint64{1, 2}, Buckets: []float64{0, 1, 2}}}}
+	statsCh <- &stats.Record{Time: time.Now(), Stats: &stats.Stats{SchedLatencies: &stats.Histogram{Counts: []uint64{1, 2, 3}, Buckets: []float64{0, 1, 2, 3}}}}
+	assert.Eventually(t, func() bool {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		return strings.Contains(g.notice, "failed to draw the scheduler latencies")
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestAppendStatsOnRestart(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	statsCh := make(chan *stats.Record)
+	metaCh := make(chan *stats.Meta)
+	queueDepth := stats.CustomMetric{Name: "queue-depth", Kind: stats.CustomMetricGauge}
+	cacheHits := stats.CustomMetric{Name: "cache-hits", Kind: stats.CustomMetricCounter}
+	target := &Target{
+		Name:     "foo(1)",
+		StatsCh:  statsCh,
+		Metadata: stats.Meta{PID: 1, CustomMetrics: []stats.CustomMetric{queueDepth}},
+		MetaCh:   metaCh,
+		Rename: func(meta *stats.Meta) string {
+			return fmt.Sprintf("foo(%d)", meta.PID)
+		},
+	}
+	g := NewTUI(0, cancel, []*Target{target, {Name: "bar(3)"}})
+	term, err := faketerm.New(image.Point{X: 200, Y: 100})
+	assert.Nil(t, err)
+	err = g.run(ctx, term, func(context.Context, terminalapi.Terminal, *container.Container, ...termdash.Option) error {
+		return nil
+	})
+	assert.Nil(t, err)
+
+	statsCh <- &stats.Record{Time: time.Now(), Stats: &stats.Stats{CustomMetrics: map[string]float64{"queue-depth": 3}}}
+	metaCh <- &stats.Meta{PID: 2, CustomMetrics: []stats.CustomMetric{cacheHits, queueDepth}}
+	statsCh <- &stats.Record{Time: time.Now(), Stats: &stats.Stats{CustomMetrics: map[string]float64{"queue-depth": 4, "cache-hits": 1}}}
+
+	resCh := make(chan *sessionExport, 1)
+	target.exportCh <- resCh
+	exp := <-resCh
+	assert.Equal(t, 2, exp.Meta.PID)
+	assert.Equal(t, nullableFloats{3, 4}, exp.Series["custom:queue-depth"])
+	// The metric newly exported has nothing to compare with yet.
+	assert.Len(t, exp.Series["custom:cache-hits"], 2)
+	assert.True(t, math.IsNaN(exp.Series["custom:cache-hits"][0]))
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	assert.Equal(t, "foo(2)", target.Name)
+	assert.Equal(t, 2, target.Metadata.PID)
+	assert.Len(t, target.widgets.CustomCharts, 2)
+}
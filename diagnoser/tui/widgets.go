@@ -1,6 +1,8 @@
 package tui
 
 import (
+	"time"
+
 	"github.com/mum4k/termdash/cell"
 	"github.com/mum4k/termdash/widgetapi"
 	"github.com/mum4k/termdash/widgets/linechart"
@@ -12,6 +14,8 @@ import (
 type LineChart interface {
 	widgetapi.Widget
 	Series(label string, values []float64, opts ...linechart.SeriesOption) error
+	// Mark marks the given position of the X axis with a vertical line.
+	Mark(x int)
 }
 
 type Text interface {
@@ -19,6 +23,30 @@ type Text interface {
 	Write(text string, wOpts ...text.WriteOption) error
 }
 
+type Heatmap interface {
+	widgetapi.Widget
+	Values(columns [][]uint64, yLabels []string) error
+	// Mark marks the given column with a vertical line.
+	Mark(x int)
+}
+
+type Selector interface {
+	widgetapi.Widget
+	SetItems(items []string)
+	Up()
+	Down()
+	Toggle()
+	Selected() map[string]cell.Color
+}
+
+type GoroutineList interface {
+	widgetapi.Widget
+	SetDump(groups []*stats.GoroutineGroup, at time.Time)
+	Up()
+	Down()
+	Toggle()
+}
+
 type chartLegend struct {
 	text     Text
 	cellOpts []cell.Option
@@ -26,10 +54,32 @@ type chartLegend struct {
 
 type widgets struct {
 	Metadata Text
+	// Shows the health of the connection to the agent.
+	Status Text
+	// Shows the latest values of all memory statistics.
+	MemStats Text
 
 	CPUChart       LineChart
 	GoroutineChart LineChart
-	HeapChart      LineChart
+	// Shows the scheduler latencies per interval.
+	SchedLatencyHeatmap Heatmap
+	HeapChart           LineChart
+	GCPauseChart        LineChart
+	GCRateChart         LineChart
+	// Shows the latest values of the garbage collector statistics.
+	GCStats Text
+	// Charts for the application-specific metrics,
+	// in the same order as stats.Meta.CustomMetrics.
+	CustomCharts []LineChart
+
+	// Lists the expvar variables to be selected to draw.
+	ExpvarSelector Selector
+	ExpvarChart    LineChart
+
+	// Lists the goroutines grouped by stack, shown in place of the charts.
+	Goroutines GoroutineList
+	// Shows the summary of the last execution trace, shown in place of the charts.
+	TraceSummary Text
 
 	HeapAllocLegend chartLegend
 	HeapIdelLegend  chartLegend
@@ -42,6 +92,14 @@ func newWidgets(meta *stats.Meta) (*widgets, error) {
 		return nil, err
 	}
 
+	status, err := newText("")
+	if err != nil {
+		return nil, err
+	}
+	memStats, err := newText("")
+	if err != nil {
+		return nil, err
+	}
 	cpuChart, err := newLineChart()
 	if err != nil {
 		return nil, err
@@ -55,6 +113,35 @@ func newWidgets(meta *stats.Meta) (*widgets, error) {
 		return nil, err
 	}
 
+	gcPauseChart, err := newLineChart()
+	if err != nil {
+		return nil, err
+	}
+	gcRateChart, err := newLineChart()
+	if err != nil {
+		return nil, err
+	}
+	gcStats, err := newText("")
+	if err != nil {
+		return nil, err
+	}
+	traceSummary, err := newText("")
+	if err != nil {
+		return nil, err
+	}
+	customCharts := make([]LineChart, 0, len(meta.CustomMetrics))
+	for range meta.CustomMetrics {
+		c, err := newLineChart()
+		if err != nil {
+			return nil, err
+		}
+		customCharts = append(customCharts, c)
+	}
+	expvarChart, err := newLineChart()
+	if err != nil {
+		return nil, err
+	}
+
 	allocColor := cell.FgColor(cell.ColorYellow)
 	allocText, err := newText("... alloc", text.WriteCellOpts(allocColor))
 	if err != nil {
@@ -71,18 +158,29 @@ func newWidgets(meta *stats.Meta) (*widgets, error) {
 		return nil, err
 	}
 	return &widgets{
-		Metadata:        metadata,
-		CPUChart:        cpuChart,
-		GoroutineChart:  goroutineChart,
-		HeapChart:       heapChart,
-		HeapAllocLegend: chartLegend{allocText, []cell.Option{allocColor}},
-		HeapIdelLegend:  chartLegend{idleText, []cell.Option{idleColor}},
-		HeapInuseLegend: chartLegend{inuseText, []cell.Option{inuseColor}},
+		Metadata:            metadata,
+		Status:              status,
+		MemStats:            memStats,
+		CPUChart:            cpuChart,
+		GoroutineChart:      goroutineChart,
+		SchedLatencyHeatmap: newHeatmap(),
+		HeapChart:           heapChart,
+		GCPauseChart:        gcPauseChart,
+		GCRateChart:         gcRateChart,
+		GCStats:             gcStats,
+		CustomCharts:        customCharts,
+		ExpvarSelector:      newSelector(),
+		ExpvarChart:         expvarChart,
+		Goroutines:          newGoroutineList(),
+		TraceSummary:        traceSummary,
+		HeapAllocLegend:     chartLegend{allocText, []cell.Option{allocColor}},
+		HeapIdelLegend:      chartLegend{idleText, []cell.Option{idleColor}},
+		HeapInuseLegend:     chartLegend{inuseText, []cell.Option{inuseColor}},
 	}, nil
 }
 
 func newLineChart() (LineChart, error) {
-	return linechart.New(
+	return newMarkableLineChart(
 		linechart.AxesCellOpts(cell.FgColor(cell.ColorRed)),
 		linechart.YLabelCellOpts(cell.FgColor(cell.ColorDefault)),
 		linechart.XLabelCellOpts(cell.FgColor(cell.ColorDefault)),
@@ -6,6 +6,7 @@ package tui
 
 import (
 	gomock "github.com/golang/mock/gomock"
+	cell "github.com/mum4k/termdash/cell"
 	canvas "github.com/mum4k/termdash/private/canvas"
 	terminalapi "github.com/mum4k/termdash/terminal/terminalapi"
 	widgetapi "github.com/mum4k/termdash/widgetapi"
@@ -112,6 +113,18 @@ func (mr *MockLineChartMockRecorder) Series(label, values interface{}, opts ...i
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Series", reflect.TypeOf((*MockLineChart)(nil).Series), varargs...)
 }
 
+// Mark mocks base method
+func (m *MockLineChart) Mark(x int) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Mark", x)
+}
+
+// Mark indicates an expected call of Mark
+func (mr *MockLineChartMockRecorder) Mark(x interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Mark", reflect.TypeOf((*MockLineChart)(nil).Mark), x)
+}
+
 // MockText is a mock of Text interface
 type MockText struct {
 	ctrl     *gomock.Controller
@@ -209,3 +222,249 @@ func (mr *MockTextMockRecorder) Write(text interface{}, wOpts ...interface{}) *g
 	varargs := append([]interface{}{text}, wOpts...)
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Write", reflect.TypeOf((*MockText)(nil).Write), varargs...)
 }
+
+// MockHeatmap is a mock of Heatmap interface
+type MockHeatmap struct {
+	ctrl     *gomock.Controller
+	recorder *MockHeatmapMockRecorder
+}
+
+// MockHeatmapMockRecorder is the mock recorder for MockHeatmap
+type MockHeatmapMockRecorder struct {
+	mock *MockHeatmap
+}
+
+// NewMockHeatmap creates a new mock instance
+func NewMockHeatmap(ctrl *gomock.Controller) *MockHeatmap {
+	mock := &MockHeatmap{ctrl: ctrl}
+	mock.recorder = &MockHeatmapMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockHeatmap) EXPECT() *MockHeatmapMockRecorder {
+	return m.recorder
+}
+
+// Draw mocks base method
+func (m *MockHeatmap) Draw(cvs *canvas.Canvas, meta *widgetapi.Meta) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Draw", cvs, meta)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Draw indicates an expected call of Draw
+func (mr *MockHeatmapMockRecorder) Draw(cvs, meta interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Draw", reflect.TypeOf((*MockHeatmap)(nil).Draw), cvs, meta)
+}
+
+// Keyboard mocks base method
+func (m *MockHeatmap) Keyboard(k *terminalapi.Keyboard) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Keyboard", k)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Keyboard indicates an expected call of Keyboard
+func (mr *MockHeatmapMockRecorder) Keyboard(k interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Keyboard", reflect.TypeOf((*MockHeatmap)(nil).Keyboard), k)
+}
+
+// Mouse mocks base method
+func (m_2 *MockHeatmap) Mouse(m *terminalapi.Mouse) error {
+	m_2.ctrl.T.Helper()
+	ret := m_2.ctrl.Call(m_2, "Mouse", m)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Mouse indicates an expected call of Mouse
+func (mr *MockHeatmapMockRecorder) Mouse(m interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Mouse", reflect.TypeOf((*MockHeatmap)(nil).Mouse), m)
+}
+
+// Options mocks base method
+func (m *MockHeatmap) Options() widgetapi.Options {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Options")
+	ret0, _ := ret[0].(widgetapi.Options)
+	return ret0
+}
+
+// Options indicates an expected call of Options
+func (mr *MockHeatmapMockRecorder) Options() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Options", reflect.TypeOf((*MockHeatmap)(nil).Options))
+}
+
+// Values mocks base method
+func (m *MockHeatmap) Values(columns [][]uint64, yLabels []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Values", columns, yLabels)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Values indicates an expected call of Values
+func (mr *MockHeatmapMockRecorder) Values(columns, yLabels interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Values", reflect.TypeOf((*MockHeatmap)(nil).Values), columns, yLabels)
+}
+
+// Mark mocks base method
+func (m *MockHeatmap) Mark(x int) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Mark", x)
+}
+
+// Mark indicates an expected call of Mark
+func (mr *MockHeatmapMockRecorder) Mark(x interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Mark", reflect.TypeOf((*MockHeatmap)(nil).Mark), x)
+}
+
+// MockSelector is a mock of Selector interface
+type MockSelector struct {
+	ctrl     *gomock.Controller
+	recorder *MockSelectorMockRecorder
+}
+
+// MockSelectorMockRecorder is the mock recorder for MockSelector
+type MockSelectorMockRecorder struct {
+	mock *MockSelector
+}
+
+// NewMockSelector creates a new mock instance
+func NewMockSelector(ctrl *gomock.Controller) *MockSelector {
+	mock := &MockSelector{ctrl: ctrl}
+	mock.recorder = &MockSelectorMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockSelector) EXPECT() *MockSelectorMockRecorder {
+	return m.recorder
+}
+
+// Draw mocks base method
+func (m *MockSelector) Draw(cvs *canvas.Canvas, meta *widgetapi.Meta) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Draw", cvs, meta)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Draw indicates an expected call of Draw
+func (mr *MockSelectorMockRecorder) Draw(cvs, meta interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Draw", reflect.TypeOf((*MockSelector)(nil).Draw), cvs, meta)
+}
+
+// Keyboard mocks base method
+func (m *MockSelector) Keyboard(k *terminalapi.Keyboard) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Keyboard", k)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Keyboard indicates an expected call of Keyboard
+func (mr *MockSelectorMockRecorder) Keyboard(k interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Keyboard", reflect.TypeOf((*MockSelector)(nil).Keyboard), k)
+}
+
+// Mouse mocks base method
+func (m_2 *MockSelector) Mouse(m *terminalapi.Mouse) error {
+	m_2.ctrl.T.Helper()
+	ret := m_2.ctrl.Call(m_2, "Mouse", m)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Mouse indicates an expected call of Mouse
+func (mr *MockSelectorMockRecorder) Mouse(m interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Mouse", reflect.TypeOf((*MockSelector)(nil).Mouse), m)
+}
+
+// Options mocks base method
+func (m *MockSelector) Options() widgetapi.Options {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Options")
+	ret0, _ := ret[0].(widgetapi.Options)
+	return ret0
+}
+
+// Options indicates an expected call of Options
+func (mr *MockSelectorMockRecorder) Options() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Options", reflect.TypeOf((*MockSelector)(nil).Options))
+}
+
+// SetItems mocks base method
+func (m *MockSelector) SetItems(items []string) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetItems", items)
+}
+
+// SetItems indicates an expected call of SetItems
+func (mr *MockSelectorMockRecorder) SetItems(items interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetItems", reflect.TypeOf((*MockSelector)(nil).SetItems), items)
+}
+
+// Up mocks base method
+func (m *MockSelector) Up() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Up")
+}
+
+// Up indicates an expected call of Up
+func (mr *MockSelectorMockRecorder) Up() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Up", reflect.TypeOf((*MockSelector)(nil).Up))
+}
+
+// Down mocks base method
+func (m *MockSelector) Down() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Down")
+}
+
+// Down indicates an expected call of Down
+func (mr *MockSelectorMockRecorder) Down() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Down", reflect.TypeOf((*MockSelector)(nil).Down))
+}
+
+// Toggle mocks base method
+func (m *MockSelector) Toggle() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Toggle")
+}
+
+// Toggle indicates an expected call of Toggle
+func (mr *MockSelectorMockRecorder) Toggle() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Toggle", reflect.TypeOf((*MockSelector)(nil).Toggle))
+}
+
+// Selected mocks base method
+func (m *MockSelector) Selected() map[string]cell.Color {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Selected")
+	ret0, _ := ret[0].(map[string]cell.Color)
+	return ret0
+}
+
+// Selected indicates an expected call of Selected
+func (mr *MockSelectorMockRecorder) Selected() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Selected", reflect.TypeOf((*MockSelector)(nil).Selected))
+}
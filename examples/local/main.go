@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"log"
+	"math/rand"
 	"os"
 	"time"
 
@@ -18,6 +19,13 @@ func main() {
 	}
 	defer agent.Close()
 
+	err = agent.RegisterGauge("random", func() float64 {
+		return rand.Float64() * 100
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	fmt.Println("Press Ctrl-C to quit.")
 	time.Sleep(time.Hour)
 }
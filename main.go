@@ -1,6 +1,8 @@
 package main
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"io"
@@ -11,16 +13,30 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
 	flag "github.com/spf13/pflag"
 
 	"github.com/nakabonne/gosivy/diagnoser"
+	"github.com/nakabonne/gosivy/diagnoser/tui"
 	"github.com/nakabonne/gosivy/process"
+	"github.com/nakabonne/gosivy/stats"
 )
 
-const defaultScrapeInterval = time.Second
+const (
+	defaultScrapeInterval = time.Second
+	// The agent samples via runtime/metrics, which is cheap enough
+	// to be scraped at sub-second rate.
+	minScrapeInterval = 100 * time.Millisecond
+	// The environment variable to give the token, which keeps it out of
+	// the process list unlike the flag.
+	tokenEnvKey = "GOSIVY_TOKEN"
+
+	recordCommand = "record"
+	replayCommand = "replay"
+)
 
 var (
 	flagSet = flag.NewFlagSet("gosivy", flag.ContinueOnError)
@@ -32,24 +48,44 @@ var (
 )
 
 type cli struct {
-	debug          bool
-	version        bool
-	list           bool
-	scrapeInterval time.Duration
-	stdout         io.Writer
-	stderr         io.Writer
-	diagnoser      diagnoser.Diagnoser
+	debug           bool
+	version         bool
+	list            bool
+	all             bool
+	follow          bool
+	output          string
+	scrapeInterval  time.Duration
+	profileDuration time.Duration
+	traceDuration   time.Duration
+	tlsCA           string
+	tlsCert         string
+	tlsKey          string
+	insecure        bool
+	token           string
+	stdout          io.Writer
+	stderr          io.Writer
+	diagnoser       diagnoser.Diagnoser
+	// Lets the user pick one of the processes.
+	picker func(process.Processes) (*process.Process, error)
 }
 
 func (c *cli) usage() {
 	format := `Usage:
-  gosivy [flags] <pid|host:port>
+  gosivy [flags] [<pid|host:port>...]
+  gosivy record [flags] [<pid|host:port>...]
+  gosivy replay <file>
 
 Flags:
 %s
 Examples:
   gosivy 15788
   gosivy host.xz:8080
+  gosivy host1.xz:8080 host2.xz:8080
+  gosivy --all
+  gosivy --follow 15788
+  gosivy record --output samples.jsonl 15788
+  gosivy replay samples.jsonl
+  gosivy --tls-ca ca.pem --tls-cert client.pem --tls-key client-key.pem host.xz:8080
 
 Author:
   Ryo Nakao <ryo@nakao.dev>
@@ -77,7 +113,17 @@ func parseFlags(stdout, stderr io.Writer) (*cli, error) {
 	flagSet.BoolVarP(&c.version, "version", "v", false, "Print the current version.")
 	flagSet.BoolVar(&c.debug, "debug", false, "Run in debug mode.")
 	flagSet.BoolVarP(&c.list, "list-processes", "l", false, "Show processes where gosivy agent runs on.")
-	flagSet.DurationVar(&c.scrapeInterval, "scrape-interval", defaultScrapeInterval, "Interval to scrape from the agent. It must be >= 1s")
+	flagSet.BoolVarP(&c.all, "all", "a", false, "Diagnose all processes where gosivy agent runs on, each of which is shown on its own tab.")
+	flagSet.BoolVarP(&c.follow, "follow", "f", false, "Keep following the local process across restarts by looking for the same executable.")
+	flagSet.StringVarP(&c.output, "output", "o", "", `File to append the samples to in the record command. (default "gosivy-<time>.jsonl")`)
+	flagSet.DurationVar(&c.scrapeInterval, "scrape-interval", defaultScrapeInterval, "Interval to scrape from the agent. It must be >= 100ms")
+	flagSet.DurationVar(&c.profileDuration, "profile-duration", tui.DefaultProfileDuration, "How long to profile the CPU for when captured from the TUI. It must be <= 1m.")
+	flagSet.DurationVar(&c.traceDuration, "trace-duration", tui.DefaultTraceDuration, "How long to capture an execution trace for from the TUI. It must be <= 1m.")
+	flagSet.StringVar(&c.tlsCA, "tls-ca", "", "Path to the PEM encoded CA certificates to verify the agent serving over TLS.")
+	flagSet.StringVar(&c.tlsCert, "tls-cert", "", "Path to the PEM encoded client certificate, required if the agent enables mutual TLS.")
+	flagSet.StringVar(&c.tlsKey, "tls-key", "", "Path to the PEM encoded private key of the client certificate.")
+	flagSet.BoolVar(&c.insecure, "insecure-skip-verify", false, "Connect over TLS without verifying the agent's certificate.")
+	flagSet.StringVar(&c.token, "token", "", "Shared secret to authenticate to the agent. "+tokenEnvKey+" environment variable is used if not given.")
 	flagSet.Usage = c.usage
 	if err := flagSet.Parse(os.Args[1:]); err != nil {
 		if !errors.Is(err, flag.ErrHelp) {
@@ -102,6 +148,17 @@ func (c *cli) run(args []string) int {
 		fmt.Fprintf(c.stderr, "failed to prepare for debugging: %v\n", err)
 		return 1
 	}
+	if len(args) > 0 && args[0] == replayCommand {
+		return c.replay(args[1:])
+	}
+	// Records the samples into a file without drawing.
+	record := len(args) > 0 && args[0] == recordCommand
+	if record {
+		args = args[1:]
+	} else if c.output != "" {
+		fmt.Fprintf(c.stderr, "\"--output\" can be given only along with the %q command\n", recordCommand)
+		return 1
+	}
 	if c.list {
 		ps, err := process.FindAll()
 		if err != nil {
@@ -112,25 +169,91 @@ func (c *cli) run(args []string) int {
 		return 0
 	}
 
-	var pid string
-	if len(args) == 0 {
+	targets := args
+	switch {
+	case c.all:
+		if len(args) > 0 {
+			fmt.Fprintln(c.stderr, `targets can't be given along with "--all"`)
+			return 1
+		}
+		ps, err := process.FindAll()
+		if err != nil {
+			fmt.Fprintf(c.stderr, "failed to list processes: %v\n", err)
+			return 1
+		}
+		if len(ps) == 0 {
+			fmt.Fprintln(c.stderr, "no process where the agent runs found")
+			return 1
+		}
+		targets = make([]string, 0, len(ps))
+		for _, p := range ps {
+			targets = append(targets, strconv.Itoa(p.PID))
+		}
+	case len(args) == 0:
 		// Automatically finds the process where the agent runs on if no args given.
-		p, err := process.FindOne()
+		ps, err := process.FindAll()
+		if err != nil {
+			fmt.Fprintf(c.stderr, "failed to list processes: %v\n", err)
+			return 1
+		}
+		p, err := c.pickProcess(ps)
 		if err != nil {
 			fmt.Fprintln(c.stderr, err)
 			return 1
 		}
-		pid = strconv.Itoa(p.PID)
-	} else {
-		pid = args[0]
+		if p == nil {
+			return 0
+		}
+		targets = []string{strconv.Itoa(p.PID)}
+	}
+	dTargets := make([]diagnoser.Target, 0, len(targets))
+	for _, target := range targets {
+		addr, err := targetToAddr(target)
+		if err != nil {
+			fmt.Fprintf(c.stderr, "failed to convert args into addresses: %v\n", err)
+			return 1
+		}
+		t := diagnoser.Target{Addr: addr}
+		if c.follow {
+			if t.Resolve, err = followResolver(target); err != nil {
+				fmt.Fprintf(c.stderr, "failed to follow %s: %v\n", target, err)
+				return 1
+			}
+		}
+		dTargets = append(dTargets, t)
 	}
-	addr, err := targetToAddr(pid)
+	tlsConfig, err := c.tlsConfig()
 	if err != nil {
-		fmt.Fprintf(c.stderr, "failed to convert args into addresses: %v\n", err)
+		fmt.Fprintf(c.stderr, "failed to load TLS settings: %v\n", err)
 		return 1
 	}
+	token := c.token
+	if token == "" {
+		token = os.Getenv(tokenEnvKey)
+	}
+	dialOpts := diagnoser.DialOptions{
+		TLSConfig: tlsConfig,
+		Token:     token,
+	}
+	if c.diagnoser == nil && record {
+		output := c.output
+		if output == "" {
+			output = "gosivy-" + time.Now().Format("20060102-150405") + ".jsonl"
+		}
+		f, err := os.OpenFile(output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			fmt.Fprintf(c.stderr, "failed to open the output file: %v\n", err)
+			return 1
+		}
+		defer f.Close()
+		fmt.Fprintf(c.stderr, "recording to %s, press Ctrl-C to stop\n", output)
+		c.diagnoser = diagnoser.NewRecorder(dTargets, c.scrapeInterval, f, c.stderr, dialOpts)
+	}
 	if c.diagnoser == nil {
-		c.diagnoser = diagnoser.NewDiagnoser(addr, c.scrapeInterval, nil)
+		c.diagnoser = diagnoser.NewDiagnoser(dTargets, c.scrapeInterval, nil, dialOpts, diagnoser.CaptureOptions{
+			ProfileDuration: c.profileDuration,
+			TraceDuration:   c.traceDuration,
+		})
 	}
 	if err := c.diagnoser.Run(); err != nil {
 		fmt.Fprintf(c.stderr, "failed to start diagnoser: %s\n", err.Error())
@@ -139,16 +262,102 @@ func (c *cli) run(args []string) int {
 	return 0
 }
 
+// replay draws the samples recorded in the given file.
+func (c *cli) replay(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintf(c.stderr, "the %q command requires exactly one file\n", replayCommand)
+		return 1
+	}
+	if c.diagnoser == nil {
+		f, err := os.Open(args[0])
+		if err != nil {
+			fmt.Fprintf(c.stderr, "failed to open the recording: %v\n", err)
+			return 1
+		}
+		defer f.Close()
+		c.diagnoser, err = diagnoser.NewReplayer(f, nil)
+		if err != nil {
+			fmt.Fprintf(c.stderr, "failed to read the recording: %v\n", err)
+			return 1
+		}
+	}
+	if err := c.diagnoser.Run(); err != nil {
+		fmt.Fprintf(c.stderr, "failed to start replaying: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// pickProcess attaches to the process if it's the only one found,
+// otherwise lets the user pick one of them. It gives back nil if the user quit.
+func (c *cli) pickProcess(ps process.Processes) (*process.Process, error) {
+	switch len(ps) {
+	case 0:
+		return nil, fmt.Errorf("no process where the agent runs found")
+	case 1:
+		return &ps[0], nil
+	}
+	if c.picker == nil {
+		c.picker = tui.PickProcess
+	}
+	p, err := c.picker(ps)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pick a process: %w", err)
+	}
+	return p, nil
+}
+
 func (c *cli) validate() error {
-	if c.scrapeInterval < time.Second {
-		return fmt.Errorf(`"--scrape-interval" must be >= 1s`)
+	if c.scrapeInterval < minScrapeInterval {
+		return fmt.Errorf(`"--scrape-interval" must be >= %v`, minScrapeInterval)
+	}
+	if (c.tlsCert == "") != (c.tlsKey == "") {
+		return fmt.Errorf(`"--tls-cert" and "--tls-key" must be given together`)
+	}
+	if c.profileDuration < 0 || c.traceDuration < 0 {
+		return fmt.Errorf(`"--profile-duration" and "--trace-duration" can't be negative`)
+	}
+	if c.profileDuration > stats.MaxCaptureDuration || c.traceDuration > stats.MaxCaptureDuration {
+		return fmt.Errorf(`"--profile-duration" and "--trace-duration" must be <= %v`, stats.MaxCaptureDuration)
 	}
 	return nil
 }
 
+// tlsConfig builds the TLS settings from the flags.
+// It gives back nil if none of the TLS flags is given.
+func (c *cli) tlsConfig() (*tls.Config, error) {
+	if c.tlsCA == "" && c.tlsCert == "" && !c.insecure {
+		return nil, nil
+	}
+	cfg := &tls.Config{
+		InsecureSkipVerify: c.insecure,
+		MinVersion:         tls.VersionTLS12,
+	}
+	if c.tlsCA != "" {
+		pem, err := ioutil.ReadFile(c.tlsCA)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", c.tlsCA)
+		}
+		cfg.RootCAs = pool
+	}
+	if c.tlsCert != "" {
+		cert, err := tls.LoadX509KeyPair(c.tlsCert, c.tlsKey)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
 // targetToAddr parses the target string (pid or host:port),
-// and converts it into the address of a TCP end point.
-func targetToAddr(target string) (*net.TCPAddr, error) {
+// and converts it into the address of a TCP end point, or a Unix domain socket
+// if the agent running on the given PID listens on it.
+func targetToAddr(target string) (net.Addr, error) {
 	// The case of "host:port"
 	if strings.Contains(target, ":") {
 		var err error
@@ -156,23 +365,54 @@ func targetToAddr(target string) (*net.TCPAddr, error) {
 		if err != nil {
 			return nil, fmt.Errorf("couldn't parse dst address: %w", err)
 		}
+		// Keep the host name for verifying the certificate against it.
+		if host, _, err := net.SplitHostPort(target); err == nil && net.ParseIP(host) == nil {
+			return diagnoser.HostAddr(target), nil
+		}
 		return addr, nil
 	}
 
 	// The case of PID.
-	// Find port by pid then, connect to local
+	// Find the address by pid then, connect to local
 	pid, err := strconv.Atoi(target)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't parse PID: %w", err)
 	}
-	port, err := process.GetPort(pid)
+	addr, err := process.GetAddr(pid)
 	if err != nil {
-		return nil, fmt.Errorf("couldn't get port for PID %v: %w", pid, err)
+		return nil, fmt.Errorf("couldn't get address for PID %v: %w", pid, err)
 	}
-	addr, _ := net.ResolveTCPAddr("tcp", "127.0.0.1:"+port)
 	return addr, nil
 }
 
+// followResolver gives back the function to find the address of the process
+// running the same executable as the given PID, once it's gone.
+// It gives back nil for remote targets, whose address never changes.
+func followResolver(target string) (func() (net.Addr, error), error) {
+	pid, err := strconv.Atoi(target)
+	if err != nil {
+		return nil, nil
+	}
+	p, err := process.Find(pid)
+	if err != nil {
+		return nil, err
+	}
+	// Resolve may be called from multiple goroutines, such as the scraper and the profiler.
+	var mu sync.Mutex
+	return func() (net.Addr, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if _, err := process.Find(pid); err != nil {
+			found, err := process.FindByExecutable(p.Executable, p.Path)
+			if err != nil {
+				return nil, err
+			}
+			pid = found.PID
+		}
+		return process.GetAddr(pid)
+	}, nil
+}
+
 // Makes a new file under the config directory only when debug use.
 func setLogger(w io.Writer, debug bool) error {
 	if !debug {
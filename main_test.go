@@ -10,6 +10,7 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	"github.com/nakabonne/gosivy/diagnoser"
+	"github.com/nakabonne/gosivy/process"
 )
 
 func TestRun(t *testing.T) {
@@ -21,6 +22,8 @@ func TestRun(t *testing.T) {
 		cli  cli
 		args []string
 		want int
+		// A part of what's written to stderr, checked if not empty.
+		wantStderr string
 	}{
 		{
 			name: "emit version",
@@ -36,6 +39,95 @@ func TestRun(t *testing.T) {
 			},
 			want: 1,
 		},
+		{
+			name: "tls cert without key",
+			cli: cli{
+				scrapeInterval: time.Second,
+				tlsCert:        "client.pem",
+			},
+			args: []string{"localhost:8080"},
+			want: 1,
+		},
+		{
+			name: "missing tls ca",
+			cli: cli{
+				scrapeInterval: time.Second,
+				tlsCA:          "not-exist.pem",
+			},
+			args: []string{"localhost:8080"},
+			want: 1,
+		},
+		{
+			name: "run with multiple remote addrs",
+			cli: cli{
+				scrapeInterval: time.Second,
+			},
+			args: []string{"localhost:8080", "localhost:8081"},
+			want: 0,
+		},
+		{
+			name: "all along with targets",
+			cli: cli{
+				scrapeInterval: time.Second,
+				all:            true,
+			},
+			args: []string{"localhost:8080"},
+			want: 1,
+		},
+		{
+			name: "negative profile duration",
+			cli: cli{
+				scrapeInterval:  time.Second,
+				profileDuration: -time.Second,
+			},
+			args: []string{"localhost:8080"},
+			want: 1,
+		},
+		{
+			name: "too long trace duration",
+			cli: cli{
+				scrapeInterval: time.Second,
+				traceDuration:  2 * time.Minute,
+			},
+			args:       []string{"localhost:8080"},
+			want:       1,
+			wantStderr: "\"--profile-duration\" and \"--trace-duration\" must be <= 1m0s\n",
+		},
+		{
+			name: "output without record command",
+			cli: cli{
+				scrapeInterval: time.Second,
+				output:         "samples.jsonl",
+			},
+			args:       []string{"localhost:8080"},
+			want:       1,
+			wantStderr: "\"--output\" can be given only along with the \"record\" command\n",
+		},
+		{
+			name: "record remote addr",
+			cli: cli{
+				scrapeInterval: time.Second,
+				output:         "samples.jsonl",
+			},
+			args: []string{"record", "localhost:8080"},
+			want: 0,
+		},
+		{
+			name: "replay without file",
+			cli: cli{
+				scrapeInterval: time.Second,
+			},
+			args: []string{"replay"},
+			want: 1,
+		},
+		{
+			name: "replay",
+			cli: cli{
+				scrapeInterval: time.Second,
+			},
+			args: []string{"replay", "samples.jsonl"},
+			want: 0,
+		},
 		{
 			name: "run with remote addr",
 			cli: cli{
@@ -55,6 +147,9 @@ func TestRun(t *testing.T) {
 			tt.cli.diagnoser = m
 			got := tt.cli.run(tt.args)
 			assert.Equal(t, tt.want, got)
+			if tt.wantStderr != "" {
+				assert.Contains(t, b.String(), tt.wantStderr)
+			}
 		})
 	}
 }
@@ -63,12 +158,12 @@ func TestTargetToAddr(t *testing.T) {
 	tests := []struct {
 		name    string
 		target  string
-		want    *net.TCPAddr
+		want    net.Addr
 		wantErr bool
 	}{
 		{
 			name:   "remote mode",
-			target: "localhost:8080",
+			target: "127.0.0.1:8080",
 			want: &net.TCPAddr{
 				IP:   net.ParseIP("127.0.0.1"),
 				Port: 8080,
@@ -76,6 +171,17 @@ func TestTargetToAddr(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name:    "remote mode with host name",
+			target:  "localhost:8080",
+			want:    diagnoser.HostAddr("localhost:8080"),
+			wantErr: false,
+		},
+		{
+			name:    "invalid port",
+			target:  "localhost:foo",
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -85,3 +191,46 @@ func TestTargetToAddr(t *testing.T) {
 		})
 	}
 }
+
+func TestPickProcess(t *testing.T) {
+	ps := process.Processes{{PID: 1}, {PID: 2}}
+	tests := []struct {
+		name       string
+		ps         process.Processes
+		want       *process.Process
+		wantErr    bool
+		wantPicker bool
+	}{
+		{
+			name:    "no process",
+			ps:      process.Processes{},
+			wantErr: true,
+		},
+		{
+			name: "attach to the only process",
+			ps:   ps[:1],
+			want: &ps[0],
+		},
+		{
+			name:       "pick one of processes",
+			ps:         ps,
+			want:       &ps[1],
+			wantPicker: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var picked bool
+			c := &cli{
+				picker: func(ps process.Processes) (*process.Process, error) {
+					picked = true
+					return &ps[1], nil
+				},
+			}
+			got, err := c.pickProcess(tt.ps)
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantPicker, picked)
+		})
+	}
+}
@@ -7,6 +7,7 @@ package process
 import (
 	"fmt"
 	"io/ioutil"
+	"net"
 	"os"
 	"os/user"
 	"path/filepath"
@@ -17,7 +18,8 @@ import (
 
 const ConfigDirEnvKey = "GOSIVY_CONFIG_DIR"
 
-// PIDFile gives back the path to pid file which the process port is written.
+// PIDFile gives back the path to pid file which the process port is written,
+// or the path to the socket if the agent listens on a Unix domain socket.
 // Pid file is created when the agent is launched.
 func PIDFile(pid int) (string, error) {
 	dir, err := ConfigDir()
@@ -27,6 +29,17 @@ func PIDFile(pid int) (string, error) {
 	return filepath.Join(dir, strconv.Itoa(pid)), nil
 }
 
+// SocketFile gives back the path to the Unix domain socket
+// the agent listens on in the Unix socket mode. It's put in the directory
+// of its own so that only the owner can reach it as soon as it's created.
+func SocketFile(pid int) (string, error) {
+	dir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, strconv.Itoa(pid)+".d", "agent.sock"), nil
+}
+
 func ConfigDir() (string, error) {
 	if configDir := os.Getenv(ConfigDirEnvKey); configDir != "" {
 		return configDir, nil
@@ -47,17 +60,35 @@ func ConfigDir() (string, error) {
 	return filepath.Join(homeDir, ".config", "gosivy"), nil
 }
 
+// GetPort gives back the TCP port the agent running on the given process listens on.
 func GetPort(pid int) (string, error) {
-	portfile, err := PIDFile(pid)
+	addr, err := GetAddr(pid)
 	if err != nil {
 		return "", err
 	}
-	b, err := ioutil.ReadFile(portfile)
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return "", fmt.Errorf("the agent listens on Unix domain socket %s", addr)
+	}
+	return strconv.Itoa(tcpAddr.Port), nil
+}
+
+// GetAddr gives back the address the agent running on the given process listens on,
+// which is either a TCP port on the loopback interface or a Unix domain socket.
+func GetAddr(pid int) (net.Addr, error) {
+	pidfile, err := PIDFile(pid)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	b, err := ioutil.ReadFile(pidfile)
+	if err != nil {
+		return nil, err
+	}
+	target := strings.TrimSpace(string(b))
+	if _, err := strconv.Atoi(target); err == nil {
+		return net.ResolveTCPAddr("tcp", "127.0.0.1:"+target)
 	}
-	port := strings.TrimSpace(string(b))
-	return port, nil
+	return &net.UnixAddr{Name: target, Net: "unix"}, nil
 }
 
 func guessUnixHomeDir() string {
@@ -1,6 +1,13 @@
 package process
 
-import "testing"
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
 
 func Test_guessUnixHomeDir(t *testing.T) {
 	tests := []struct {
@@ -14,3 +21,43 @@ func Test_guessUnixHomeDir(t *testing.T) {
 		})
 	}
 }
+
+func TestGetAddr(t *testing.T) {
+	os.Setenv(ConfigDirEnvKey, t.TempDir())
+	defer os.Unsetenv(ConfigDirEnvKey)
+
+	tests := []struct {
+		name     string
+		content  string
+		want     net.Addr
+		wantPort string
+		wantErr  bool
+	}{
+		{
+			name:     "tcp port",
+			content:  "8080\n",
+			want:     &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 8080},
+			wantPort: "8080",
+		},
+		{
+			name:    "unix domain socket",
+			content: "/path/to/gosivy/1.sock",
+			want:    &net.UnixAddr{Name: "/path/to/gosivy/1.sock", Net: "unix"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pidfile, err := PIDFile(1)
+			assert.Nil(t, err)
+			assert.Nil(t, ioutil.WriteFile(pidfile, []byte(tt.content), 0600))
+
+			got, err := GetAddr(1)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, got)
+			port, err := GetPort(1)
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.wantPort, port)
+		})
+	}
+}
@@ -5,8 +5,10 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/keybase/go-ps"
+	gopsutil "github.com/shirou/gopsutil/process"
 )
 
 // Process represents an OS process.
@@ -15,6 +17,18 @@ type Process struct {
 	Executable string
 	// Full path to the executable.
 	Path string
+	// When the process started. Zero if unknown.
+	CreateTime time.Time
+	// The name of the user running the process. Empty if unknown.
+	Username string
+}
+
+// Uptime gives back how long the process has been running, or zero if unknown.
+func (p *Process) Uptime() time.Duration {
+	if p.CreateTime.IsZero() {
+		return 0
+	}
+	return time.Since(p.CreateTime)
 }
 
 type Processes []Process
@@ -87,6 +101,42 @@ func FindOne() (*Process, error) {
 	return nil, fmt.Errorf("no process where the agent runs found")
 }
 
+// Find gives back the process with the given PID if the agent runs on it.
+func Find(pid int) (*Process, error) {
+	p, err := ps.FindProcess(pid)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, fmt.Errorf("process %d not found", pid)
+	}
+	return newProcess(p)
+}
+
+// FindByExecutable finds the process where the agent runs on, whose executable is
+// at the given path, or has the given name if the path is empty.
+// It gives back the most recently started one if multiple found.
+func FindByExecutable(name, path string) (*Process, error) {
+	ps, err := FindAll()
+	if err != nil {
+		return nil, err
+	}
+	var found *Process
+	for i := range ps {
+		p := &ps[i]
+		if path != "" && p.Path != path || path == "" && p.Executable != name {
+			continue
+		}
+		if found == nil || p.CreateTime.After(found.CreateTime) {
+			found = p
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("no process of %s where the agent runs found", name)
+	}
+	return found, nil
+}
+
 func newProcess(p ps.Process) (*Process, error) {
 	pid := p.Pid()
 	if pid == 0 {
@@ -103,11 +153,21 @@ func newProcess(p ps.Process) (*Process, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to detect full path to the executable: %w", err)
 	}
-	return &Process{
+	process := &Process{
 		PID:        pid,
 		Executable: p.Executable(),
 		Path:       path,
-	}, nil
+	}
+	// The rest is optional, just for display.
+	if gp, err := gopsutil.NewProcess(int32(pid)); err == nil {
+		if ms, err := gp.CreateTime(); err == nil {
+			process.CreateTime = time.Unix(0, ms*int64(time.Millisecond))
+		}
+		if u, err := gp.Username(); err == nil {
+			process.Username = u
+		}
+	}
+	return process, nil
 
 }
 
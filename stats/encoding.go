@@ -0,0 +1,450 @@
+package stats
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+)
+
+// Encoding is the way to encode stats frames, negotiated per connection
+// in the handshake.
+type Encoding string
+
+const (
+	// EncodingJSON encodes stats with encoding/json, which is the default.
+	EncodingJSON Encoding = "json"
+	// EncodingBinary encodes stats in the compact binary format,
+	// which is much cheaper in both CPU and bandwidth than JSON.
+	EncodingBinary Encoding = "binary"
+)
+
+// binaryFormatVersion is written at the head of the binary format
+// so that it can evolve.
+const binaryFormatVersion = 1
+
+// The binary format of a Stats is a sequence of the fields below,
+// where unsigned integers are encoded as uvarint, floats as 8 bytes of
+// IEEE 754 binary representation in little-endian, and strings as
+// uvarint length followed by the bytes:
+//
+//	version (1 byte)
+//	Goroutines, CPUUsage
+//	MemStats fields in the order of declaration
+//	NumGC, PauseTotalNs, the number of recent pauses n,
+//	n pauses with the most recent first, LastGC, GCCPUFraction
+//	SchedLatencies:
+//	  0 if nil,
+//	  1 followed by counts if the buckets are SchedLatencyBuckets,
+//	  2 followed by counts and buckets otherwise
+//	CustomMetrics and Expvars as the number of entries followed by the
+//	  pairs of name and value sorted by name
+//	Ranges as the number of entries followed by name, Min, Max, Mean and Last
+//	  sorted by name, omitted if empty so that the decoders predating it,
+//	  which ignore trailing bytes, can still read the rest
+//
+// A batch is the number of stats followed by the pairs of length and
+// encoded Stats.
+
+// EncodeStats encodes the given stats in the given encoding.
+func EncodeStats(enc Encoding, s *Stats) ([]byte, error) {
+	switch enc {
+	case EncodingJSON, "":
+		return json.Marshal(s)
+	case EncodingBinary:
+		return s.MarshalBinary()
+	default:
+		return nil, fmt.Errorf("unknown encoding %q", enc)
+	}
+}
+
+// DecodeStats decodes the stats encoded by EncodeStats.
+func DecodeStats(enc Encoding, b []byte) (*Stats, error) {
+	var s Stats
+	switch enc {
+	case EncodingJSON, "":
+		if err := json.Unmarshal(b, &s); err != nil {
+			return nil, err
+		}
+	case EncodingBinary:
+		if err := s.UnmarshalBinary(b); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown encoding %q", enc)
+	}
+	return &s, nil
+}
+
+// EncodeBatch encodes the given batch of stats in the given encoding.
+func EncodeBatch(enc Encoding, batch []*Stats) ([]byte, error) {
+	switch enc {
+	case EncodingJSON, "":
+		return json.Marshal(batch)
+	case EncodingBinary:
+		w := &binaryWriter{}
+		w.uvarint(uint64(len(batch)))
+		for _, s := range batch {
+			b, err := s.MarshalBinary()
+			if err != nil {
+				return nil, err
+			}
+			w.bytes(b)
+		}
+		return w.buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unknown encoding %q", enc)
+	}
+}
+
+// EncodeTimedBatch encodes the given batch of stats taken at the given times
+// into a TimedBatch, whose stats are in the given encoding.
+func EncodeTimedBatch(enc Encoding, times []time.Time, batch []*Stats) ([]byte, error) {
+	b, err := EncodeBatch(enc, batch)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(&TimedBatch{Times: times, Batch: b})
+}
+
+// DecodeTimedBatch decodes the TimedBatch encoded by EncodeTimedBatch,
+// and gives back the records holding the stats and the times, from the oldest.
+func DecodeTimedBatch(enc Encoding, b []byte) ([]*Record, error) {
+	var tb TimedBatch
+	if err := json.Unmarshal(b, &tb); err != nil {
+		return nil, err
+	}
+	batch, err := DecodeBatch(enc, tb.Batch)
+	if err != nil {
+		return nil, err
+	}
+	if len(batch) != len(tb.Times) {
+		return nil, fmt.Errorf("malformed batch: %d samples for %d times", len(batch), len(tb.Times))
+	}
+	records := make([]*Record, 0, len(batch))
+	for i, s := range batch {
+		records = append(records, &Record{Time: tb.Times[i], Stats: s})
+	}
+	return records, nil
+}
+
+// DecodeBatch decodes the batch of stats encoded by EncodeBatch.
+func DecodeBatch(enc Encoding, b []byte) ([]*Stats, error) {
+	switch enc {
+	case EncodingJSON, "":
+		var batch []*Stats
+		if err := json.Unmarshal(b, &batch); err != nil {
+			return nil, err
+		}
+		return batch, nil
+	case EncodingBinary:
+		r := &binaryReader{buf: bytes.NewReader(b)}
+		n := r.uvarint()
+		if r.err != nil {
+			return nil, r.err
+		}
+		if n > uint64(len(b)) {
+			return nil, errors.New("malformed batch")
+		}
+		batch := make([]*Stats, 0, n)
+		for i := uint64(0); i < n; i++ {
+			var s Stats
+			data := r.bytes()
+			if r.err != nil {
+				return nil, r.err
+			}
+			if err := s.UnmarshalBinary(data); err != nil {
+				return nil, err
+			}
+			batch = append(batch, &s)
+		}
+		return batch, nil
+	default:
+		return nil, fmt.Errorf("unknown encoding %q", enc)
+	}
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (s *Stats) MarshalBinary() ([]byte, error) {
+	w := &binaryWriter{}
+	w.buf.WriteByte(binaryFormatVersion)
+	w.uvarint(uint64(s.Goroutines))
+	w.float64(s.CPUUsage)
+
+	m := &s.MemStats
+	for _, v := range []uint64{
+		m.Sys, m.HeapAlloc, m.HeapSys, m.HeapIdle, m.HeapInuse, m.HeapReleased, m.HeapObjects,
+		m.StackInuse, m.MSpanInuse, m.MCacheInuse, m.Mallocs, m.Frees, m.TotalAlloc, m.NextGC,
+	} {
+		w.uvarint(v)
+	}
+
+	gc := &s.GCStats
+	w.uvarint(uint64(gc.NumGC))
+	w.uvarint(gc.PauseTotalNs)
+	n := uint32(len(gc.PauseNs))
+	if gc.NumGC < n {
+		n = gc.NumGC
+	}
+	w.uvarint(uint64(n))
+	for i := uint32(0); i < n; i++ {
+		w.uvarint(gc.PauseNs[(gc.NumGC-i+255)%256])
+	}
+	w.uvarint(gc.LastGC)
+	w.float64(gc.GCCPUFraction)
+
+	switch h := s.SchedLatencies; {
+	case h == nil:
+		w.buf.WriteByte(0)
+	case equalFloats(h.Buckets, SchedLatencyBuckets):
+		w.buf.WriteByte(1)
+		w.uvarints(h.Counts)
+	default:
+		w.buf.WriteByte(2)
+		w.uvarints(h.Counts)
+		w.uvarint(uint64(len(h.Buckets)))
+		for _, b := range h.Buckets {
+			w.float64(b)
+		}
+	}
+
+	w.floatMap(s.CustomMetrics)
+	w.floatMap(s.Expvars)
+	if len(s.Ranges) > 0 {
+		w.ranges(s.Ranges)
+	}
+	return w.buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (s *Stats) UnmarshalBinary(b []byte) error {
+	r := &binaryReader{buf: bytes.NewReader(b)}
+	version, err := r.buf.ReadByte()
+	if err != nil {
+		return err
+	}
+	if version != binaryFormatVersion {
+		return fmt.Errorf("unsupported binary format version %d", version)
+	}
+	s.Goroutines = int(r.uvarint())
+	s.CPUUsage = r.float64()
+
+	m := &s.MemStats
+	for _, v := range []*uint64{
+		&m.Sys, &m.HeapAlloc, &m.HeapSys, &m.HeapIdle, &m.HeapInuse, &m.HeapReleased, &m.HeapObjects,
+		&m.StackInuse, &m.MSpanInuse, &m.MCacheInuse, &m.Mallocs, &m.Frees, &m.TotalAlloc, &m.NextGC,
+	} {
+		*v = r.uvarint()
+	}
+
+	gc := &s.GCStats
+	gc.NumGC = uint32(r.uvarint())
+	gc.PauseTotalNs = r.uvarint()
+	n := r.uvarint()
+	if n > uint64(len(gc.PauseNs)) {
+		return errors.New("malformed pauses")
+	}
+	for i := uint32(0); i < uint32(n); i++ {
+		gc.PauseNs[(gc.NumGC-i+255)%256] = r.uvarint()
+	}
+	gc.LastGC = r.uvarint()
+	gc.GCCPUFraction = r.float64()
+
+	switch r.byte() {
+	case 0:
+	case 1:
+		s.SchedLatencies = &Histogram{Counts: r.uvarints(), Buckets: SchedLatencyBuckets}
+	case 2:
+		h := &Histogram{Counts: r.uvarints()}
+		n := r.length()
+		h.Buckets = make([]float64, 0, n)
+		for i := 0; i < n; i++ {
+			h.Buckets = append(h.Buckets, r.float64())
+		}
+		s.SchedLatencies = h
+	default:
+		return errors.New("malformed scheduler latencies")
+	}
+
+	s.CustomMetrics = r.floatMap()
+	s.Expvars = r.floatMap()
+	if r.err == nil && r.buf.Len() > 0 {
+		s.Ranges = r.ranges()
+	}
+	return r.err
+}
+
+type binaryWriter struct {
+	buf     bytes.Buffer
+	scratch [binary.MaxVarintLen64]byte
+}
+
+func (w *binaryWriter) uvarint(v uint64) {
+	n := binary.PutUvarint(w.scratch[:], v)
+	w.buf.Write(w.scratch[:n])
+}
+
+func (w *binaryWriter) uvarints(vs []uint64) {
+	w.uvarint(uint64(len(vs)))
+	for _, v := range vs {
+		w.uvarint(v)
+	}
+}
+
+func (w *binaryWriter) float64(v float64) {
+	binary.LittleEndian.PutUint64(w.scratch[:8], math.Float64bits(v))
+	w.buf.Write(w.scratch[:8])
+}
+
+func (w *binaryWriter) bytes(b []byte) {
+	w.uvarint(uint64(len(b)))
+	w.buf.Write(b)
+}
+
+// ranges writes the entries sorted by key so that the output is deterministic.
+func (w *binaryWriter) ranges(m map[string]Range) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	w.uvarint(uint64(len(keys)))
+	for _, k := range keys {
+		w.bytes([]byte(k))
+		rg := m[k]
+		for _, v := range []float64{rg.Min, rg.Max, rg.Mean, rg.Last} {
+			w.float64(v)
+		}
+	}
+}
+
+// floatMap writes the entries sorted by key so that the output is deterministic.
+// nil and an empty map are not distinguished.
+func (w *binaryWriter) floatMap(m map[string]float64) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	w.uvarint(uint64(len(keys)))
+	for _, k := range keys {
+		w.bytes([]byte(k))
+		w.float64(m[k])
+	}
+}
+
+// binaryReader reads the binary format. Once an error occurred,
+// the subsequent reads give back zero values and the error is kept in err.
+type binaryReader struct {
+	buf *bytes.Reader
+	err error
+}
+
+func (r *binaryReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(r.buf)
+	if err != nil {
+		r.err = err
+	}
+	return v
+}
+
+// length reads a length, which must not exceed the remaining bytes.
+func (r *binaryReader) length() int {
+	n := r.uvarint()
+	if r.err == nil && n > uint64(r.buf.Len()) {
+		r.err = errors.New("malformed length")
+		return 0
+	}
+	return int(n)
+}
+
+func (r *binaryReader) uvarints() []uint64 {
+	n := r.length()
+	vs := make([]uint64, 0, n)
+	for i := 0; i < n; i++ {
+		vs = append(vs, r.uvarint())
+	}
+	return vs
+}
+
+func (r *binaryReader) byte() byte {
+	if r.err != nil {
+		return 0
+	}
+	b, err := r.buf.ReadByte()
+	if err != nil {
+		r.err = err
+	}
+	return b
+}
+
+func (r *binaryReader) float64() float64 {
+	if r.err != nil {
+		return 0
+	}
+	var b [8]byte
+	if _, err := io.ReadFull(r.buf, b[:]); err != nil {
+		r.err = err
+		return 0
+	}
+	return math.Float64frombits(binary.LittleEndian.Uint64(b[:]))
+}
+
+func (r *binaryReader) bytes() []byte {
+	n := r.length()
+	if r.err != nil {
+		return nil
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r.buf, b); err != nil {
+		r.err = err
+		return nil
+	}
+	return b
+}
+
+func (r *binaryReader) ranges() map[string]Range {
+	n := r.length()
+	if n == 0 {
+		return nil
+	}
+	m := make(map[string]Range, n)
+	for i := 0; i < n; i++ {
+		k := string(r.bytes())
+		m[k] = Range{Min: r.float64(), Max: r.float64(), Mean: r.float64(), Last: r.float64()}
+	}
+	return m
+}
+
+func (r *binaryReader) floatMap() map[string]float64 {
+	n := r.length()
+	if n == 0 {
+		return nil
+	}
+	m := make(map[string]float64, n)
+	for i := 0; i < n; i++ {
+		k := string(r.bytes())
+		m[k] = r.float64()
+	}
+	return m
+}
+
+func equalFloats(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,157 @@
+package stats
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testStats() *Stats {
+	s := &Stats{
+		Goroutines:     42,
+		CPUUsage:       12.5,
+		SchedLatencies: &Histogram{Counts: make([]uint64, len(SchedLatencyBuckets)-1), Buckets: SchedLatencyBuckets},
+		CustomMetrics:  map[string]float64{"queue-depth": 3, "cache-hits": 1024},
+		Expvars:        map[string]float64{"requests.GET": 7.5},
+		MemStats: MemStats{
+			Sys:          1 << 30,
+			HeapAlloc:    1 << 20,
+			HeapSys:      1 << 21,
+			HeapIdle:     1 << 19,
+			HeapInuse:    1 << 20,
+			HeapReleased: 1 << 18,
+			HeapObjects:  1000,
+			StackInuse:   1 << 16,
+			MSpanInuse:   1 << 12,
+			MCacheInuse:  1 << 10,
+			Mallocs:      2000,
+			Frees:        1000,
+			TotalAlloc:   1 << 25,
+			NextGC:       1 << 22,
+		},
+		GCStats: GCStats{
+			NumGC:         300,
+			PauseTotalNs:  123456789,
+			LastGC:        1600000000000000000,
+			GCCPUFraction: 0.01,
+		},
+	}
+	s.SchedLatencies.Counts[3] = 100
+	for i := range s.PauseNs {
+		s.PauseNs[i] = uint64(1000 + i)
+	}
+	return s
+}
+
+func TestEncodeStats(t *testing.T) {
+	tests := []struct {
+		name string
+		enc  Encoding
+		s    *Stats
+	}{
+		{
+			name: "json",
+			enc:  EncodingJSON,
+			s:    testStats(),
+		},
+		{
+			name: "binary",
+			enc:  EncodingBinary,
+			s:    testStats(),
+		},
+		{
+			name: "binary with custom buckets",
+			enc:  EncodingBinary,
+			s: func() *Stats {
+				s := testStats()
+				s.SchedLatencies = &Histogram{Counts: []uint64{1, 2}, Buckets: []float64{0, 1, 2}}
+				return s
+			}(),
+		},
+		{
+			name: "binary with ranges",
+			enc:  EncodingBinary,
+			s: func() *Stats {
+				s := testStats()
+				s.Ranges = map[string]Range{
+					GaugeGoroutines: {Min: 1, Max: 10, Mean: 4.5, Last: 2},
+					GaugeHeapAlloc:  {Min: 100, Max: 300, Mean: 200, Last: 300},
+				}
+				return s
+			}(),
+		},
+		{
+			name: "binary with few GC cycles",
+			enc:  EncodingBinary,
+			s:    &Stats{GCStats: GCStats{NumGC: 2, PauseNs: [256]uint64{10, 20}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := EncodeStats(tt.enc, tt.s)
+			assert.Nil(t, err)
+			got, err := DecodeStats(tt.enc, b)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.s, got)
+		})
+	}
+}
+
+func TestEncodeBatch(t *testing.T) {
+	batch := []*Stats{testStats(), testStats()}
+	for _, enc := range []Encoding{EncodingJSON, EncodingBinary} {
+		t.Run(string(enc), func(t *testing.T) {
+			b, err := EncodeBatch(enc, batch)
+			assert.Nil(t, err)
+			got, err := DecodeBatch(enc, b)
+			assert.Nil(t, err)
+			assert.Equal(t, batch, got)
+		})
+	}
+}
+
+func TestBinaryIsCompact(t *testing.T) {
+	s := testStats()
+	j, err := EncodeStats(EncodingJSON, s)
+	assert.Nil(t, err)
+	b, err := EncodeStats(EncodingBinary, s)
+	assert.Nil(t, err)
+	assert.Less(t, len(b)*2, len(j))
+}
+
+func TestDecodeBinaryWithoutRanges(t *testing.T) {
+	s := testStats()
+	b, err := s.MarshalBinary()
+	assert.Nil(t, err)
+	s.Ranges = map[string]Range{GaugeGoroutines: {Min: 1, Max: 2, Mean: 1.5, Last: 2}}
+	withRanges, err := s.MarshalBinary()
+	assert.Nil(t, err)
+	// The ranges are appended so that the rest can be read as before.
+	assert.Equal(t, b, withRanges[:len(b)])
+}
+
+func TestDecodeMalformedBinary(t *testing.T) {
+	b, err := testStats().MarshalBinary()
+	assert.Nil(t, err)
+	for _, data := range [][]byte{
+		nil,
+		{binaryFormatVersion + 1},
+		b[:len(b)/2],
+	} {
+		_, err := DecodeStats(EncodingBinary, data)
+		assert.NotNil(t, err)
+	}
+	_, err = DecodeBatch(EncodingBinary, []byte{0xff, 0xff, 0x03})
+	assert.NotNil(t, err)
+}
+
+func BenchmarkEncodeStats(b *testing.B) {
+	s := testStats()
+	for _, enc := range []Encoding{EncodingJSON, EncodingBinary} {
+		b.Run(string(enc), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				EncodeStats(enc, s)
+			}
+		})
+	}
+}
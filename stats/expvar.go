@@ -0,0 +1,43 @@
+package stats
+
+import (
+	"encoding/json"
+	"expvar"
+)
+
+// excludedExpvars are the variables published by the expvar package itself,
+// which are not worth reporting. In particular, "memstats" calls
+// runtime.ReadMemStats that stops the world.
+var excludedExpvars = map[string]bool{
+	"cmdline":  true,
+	"memstats": true,
+}
+
+// NewExpvars gives back all numeric values published via the expvar package.
+// The numeric values nested in maps are flattened with their keys joined by
+// a dot, e.g. "requests.GET".
+func NewExpvars() map[string]float64 {
+	values := make(map[string]float64)
+	expvar.Do(func(kv expvar.KeyValue) {
+		if excludedExpvars[kv.Key] {
+			return
+		}
+		var v interface{}
+		if err := json.Unmarshal([]byte(kv.Value.String()), &v); err != nil {
+			return
+		}
+		flattenNumbers(kv.Key, v, values)
+	})
+	return values
+}
+
+func flattenNumbers(key string, v interface{}, dst map[string]float64) {
+	switch v := v.(type) {
+	case float64:
+		dst[key] = v
+	case map[string]interface{}:
+		for k, child := range v {
+			flattenNumbers(key+"."+k, child, dst)
+		}
+	}
+}
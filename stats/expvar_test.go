@@ -0,0 +1,25 @@
+package stats
+
+import (
+	"expvar"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewExpvars(t *testing.T) {
+	expvar.NewInt("test-int").Set(3)
+	expvar.NewFloat("test-float").Set(1.5)
+	expvar.NewString("test-string").Set("foo")
+	m := expvar.NewMap("test-map")
+	m.Add("a", 1)
+	m.AddFloat("b", 2.5)
+
+	got := NewExpvars()
+	assert.Equal(t, map[string]float64{
+		"test-int":   3,
+		"test-float": 1.5,
+		"test-map.a": 1,
+		"test-map.b": 2.5,
+	}, got)
+}
@@ -0,0 +1,104 @@
+package stats
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// GoroutineGroup is a set of goroutines sharing the same stack.
+type GoroutineGroup struct {
+	// The number of goroutines.
+	Count int
+	// The stack from the innermost call.
+	Frames []Frame
+}
+
+// Frame is a function call in a stack.
+type Frame struct {
+	// The function name, e.g. "main.main".
+	Func string
+	File string
+	Line int
+}
+
+// Key identifies the stack, which is used to compare the groups across dumps.
+func (g *GoroutineGroup) Key() string {
+	var b strings.Builder
+	for _, f := range g.Frames {
+		fmt.Fprintf(&b, "%s %s:%d\n", f.Func, f.File, f.Line)
+	}
+	return b.String()
+}
+
+// ParseGoroutineDump parses the goroutine profile in the debug=1 text format
+// of runtime/pprof, which looks like:
+//
+//	goroutine profile: total 4
+//	3 @ 0x47d82a 0x480925 0x483561
+//	#	0x480924	time.Sleep+0x164	/usr/local/go/src/runtime/time.go:368
+//
+//	1 @ 0x440e11 0x47cb9d 0x4cc7d1
+//	#	0x4de785	main.main+0x65		/tmp/main.go:14
+func ParseGoroutineDump(b []byte) ([]*GoroutineGroup, error) {
+	var (
+		groups []*GoroutineGroup
+		cur    *GoroutineGroup
+	)
+	s := bufio.NewScanner(bytes.NewReader(b))
+	s.Buffer(make([]byte, 64*1024), MaxFrameSize)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		switch {
+		case line == "", strings.HasPrefix(line, "goroutine profile:"), strings.HasPrefix(line, "# labels:"):
+		case strings.HasPrefix(line, "#"):
+			if cur == nil {
+				return nil, fmt.Errorf("frame without count at line %d", n)
+			}
+			frame, err := parseFrame(line)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse frame at line %d: %w", n, err)
+			}
+			cur.Frames = append(cur.Frames, frame)
+		default:
+			i := strings.Index(line, " @")
+			if i < 0 {
+				return nil, fmt.Errorf("unexpected line %d: %q", n, line)
+			}
+			count, err := strconv.Atoi(line[:i])
+			if err != nil {
+				return nil, fmt.Errorf("invalid count at line %d: %w", n, err)
+			}
+			cur = &GoroutineGroup{Count: count}
+			groups = append(groups, cur)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// parseFrame parses a line like "#	0x4de785	main.main+0x65	/tmp/main.go:14".
+func parseFrame(line string) (Frame, error) {
+	fields := strings.Fields(strings.TrimPrefix(line, "#"))
+	if len(fields) < 3 {
+		return Frame{}, fmt.Errorf("too few fields: %q", line)
+	}
+	fn := fields[1]
+	if i := strings.LastIndex(fn, "+0x"); i > 0 {
+		fn = fn[:i]
+	}
+	loc := strings.Join(fields[2:], " ")
+	i := strings.LastIndex(loc, ":")
+	if i < 0 {
+		return Frame{}, fmt.Errorf("no line number: %q", line)
+	}
+	lineNum, err := strconv.Atoi(loc[i+1:])
+	if err != nil {
+		return Frame{}, fmt.Errorf("invalid line number: %w", err)
+	}
+	return Frame{Func: fn, File: loc[:i], Line: lineNum}, nil
+}
@@ -0,0 +1,81 @@
+package stats
+
+import (
+	"bytes"
+	"runtime/pprof"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseGoroutineDump(t *testing.T) {
+	tests := []struct {
+		name    string
+		dump    string
+		want    []*GoroutineGroup
+		wantErr bool
+	}{
+		{
+			name: "multiple groups",
+			dump: "goroutine profile: total 4\n" +
+				"3 @ 0x47d82a 0x480925 0x483561\n" +
+				"#\t0x480924\ttime.Sleep+0x164\t/usr/local/go/src/runtime/time.go:368\n" +
+				"\n" +
+				"1 @ 0x440e11 0x47cb9d\n" +
+				"# labels: {\"worker\":\"1\"}\n" +
+				"#\t0x4de785\tmain.worker+0x65\t\t\t\t/tmp/my app/main.go:14\n" +
+				"#\t0x44aa26\truntime.main+0x426\t\t\t/usr/local/go/src/runtime/proc.go:302\n",
+			want: []*GoroutineGroup{
+				{
+					Count:  3,
+					Frames: []Frame{{Func: "time.Sleep", File: "/usr/local/go/src/runtime/time.go", Line: 368}},
+				},
+				{
+					Count: 1,
+					Frames: []Frame{
+						{Func: "main.worker", File: "/tmp/my app/main.go", Line: 14},
+						{Func: "runtime.main", File: "/usr/local/go/src/runtime/proc.go", Line: 302},
+					},
+				},
+			},
+		},
+		{
+			name: "empty",
+			dump: "",
+		},
+		{
+			name:    "frame without count",
+			dump:    "#\t0x480924\ttime.Sleep+0x164\t/usr/local/go/src/runtime/time.go:368\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid count",
+			dump:    "x @ 0x47d82a\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid line number",
+			dump:    "1 @ 0x47d82a\n#\t0x480924\ttime.Sleep+0x164\t/usr/local/go/src/runtime/time.go\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseGoroutineDump([]byte(tt.dump))
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseGoroutineDumpOfRuntime(t *testing.T) {
+	var buf bytes.Buffer
+	assert.Nil(t, pprof.Lookup("goroutine").WriteTo(&buf, 1))
+	groups, err := ParseGoroutineDump(buf.Bytes())
+	assert.Nil(t, err)
+	assert.NotEmpty(t, groups)
+	for _, g := range groups {
+		assert.NotZero(t, g.Count)
+		assert.NotEmpty(t, g.Frames)
+	}
+}
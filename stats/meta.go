@@ -16,6 +16,30 @@ type Meta struct {
 	Command    string
 	GoMaxProcs int
 	NumCPU     int
+	// When the process started in milliseconds since the epoch,
+	// used to tell a restarted process apart even if the PID is reused.
+	CreateTime int64 `json:",omitempty"`
+	// Application-specific metrics published on the agent.
+	CustomMetrics []CustomMetric `json:",omitempty"`
+	// Whether the numeric expvar variables are reported in Stats.Expvars.
+	Expvar bool `json:",omitempty"`
+}
+
+// CustomMetricKind indicates how the value of a custom metric behaves.
+type CustomMetricKind int
+
+const (
+	// CustomMetricGauge is a value that can arbitrarily go up and down.
+	CustomMetricGauge CustomMetricKind = iota
+	// CustomMetricCounter is a cumulative value that only goes up.
+	CustomMetricCounter
+)
+
+// CustomMetric represents the definition of an application-specific metric.
+// Its values are reported in Stats.CustomMetrics.
+type CustomMetric struct {
+	Name string
+	Kind CustomMetricKind
 }
 
 func NewMeta() (*Meta, error) {
@@ -26,18 +50,23 @@ func NewMeta() (*Meta, error) {
 	}
 
 	var username, command string
+	var createTime int64
 	if u, err := process.Username(); err == nil {
 		username = u
 	}
 	if c, err := process.Cmdline(); err == nil {
 		command = c
 	}
+	if t, err := process.CreateTime(); err == nil {
+		createTime = t
+	}
 	return &Meta{
 		PID:        os.Getpid(),
 		Username:   username,
 		Command:    command,
 		GoMaxProcs: runtime.GOMAXPROCS(0),
 		NumCPU:     runtime.NumCPU(),
+		CreateTime: createTime,
 	}, nil
 }
 
@@ -0,0 +1,199 @@
+package stats
+
+import (
+	"math"
+	"runtime/metrics"
+	"sort"
+	"sync"
+)
+
+// MetricKind is a tag for a metric value which indicates its type.
+type MetricKind int
+
+const (
+	// MetricKindBad indicates that the metric is not supported.
+	MetricKindBad MetricKind = iota
+	// MetricKindUint64 indicates that the type of the value is uint64.
+	MetricKindUint64
+	// MetricKindFloat64 indicates that the type of the value is float64.
+	MetricKindFloat64
+	// MetricKindHistogram indicates that the type of the value is *Histogram.
+	MetricKindHistogram
+)
+
+// Metric represents a single sample of the runtime/metrics.
+// Only the field corresponding to the Kind is populated.
+type Metric struct {
+	Kind      MetricKind
+	Uint64    uint64     `json:",omitempty"`
+	Float64   float64    `json:",omitempty"`
+	Histogram *Histogram `json:",omitempty"`
+}
+
+// Metrics is a set of metrics keyed by the metric name,
+// e.g. "/sched/latencies:seconds".
+type Metrics map[string]Metric
+
+// Histogram represents a distribution of individual values.
+// See runtime/metrics.Float64Histogram for the details.
+type Histogram struct {
+	// Counts contains the number of values in each bucket.
+	Counts []uint64
+	// Buckets contains the boundaries of the buckets, thus
+	// len(Buckets) is equal to len(Counts)+1.
+	// Infinite boundaries are replaced with the maximum finite values
+	// so that the histogram can be encoded in JSON.
+	Buckets []float64
+}
+
+// Sub gives back a new histogram that holds the values observed since prev,
+// where prev is an earlier sample of the same cumulative metric.
+// A copy of h is given back if prev is nil or has different buckets.
+func (h *Histogram) Sub(prev *Histogram) *Histogram {
+	counts := append([]uint64(nil), h.Counts...)
+	if prev != nil && len(prev.Counts) == len(counts) {
+		for i := range counts {
+			if prev.Counts[i] > counts[i] {
+				// The metric has been reset, the values since then are all we have.
+				return &Histogram{Counts: append([]uint64(nil), h.Counts...), Buckets: h.Buckets}
+			}
+			counts[i] -= prev.Counts[i]
+		}
+	}
+	return &Histogram{Counts: counts, Buckets: h.Buckets}
+}
+
+// rebucket gives back a new histogram with the given bucket boundaries.
+// Each value is assigned to the new bucket its original bucket starts in.
+func (h *Histogram) rebucket(buckets []float64) *Histogram {
+	counts := make([]uint64, len(buckets)-1)
+	for i, c := range h.Counts {
+		lower := h.Buckets[i]
+		j := sort.SearchFloat64s(buckets, lower)
+		if j == len(buckets) || buckets[j] != lower {
+			// Step back to the bucket that contains the lower bound.
+			j--
+		}
+		if j < 0 {
+			j = 0
+		}
+		if j >= len(counts) {
+			j = len(counts) - 1
+		}
+		counts[j] += c
+	}
+	return &Histogram{Counts: counts, Buckets: buckets}
+}
+
+// Collector samples the runtime metrics via runtime/metrics, which unlike
+// runtime.ReadMemStats doesn't stop the world, hence it's cheap enough to
+// call at high rate.
+type Collector struct {
+	mu      sync.Mutex
+	samples []metrics.Sample
+	// Indexes of samples keyed by the metric name.
+	index map[string]int
+}
+
+// NewCollector gives back a Collector that samples all metrics supported
+// by the running Go runtime.
+func NewCollector() *Collector {
+	descs := metrics.All()
+	c := &Collector{
+		samples: make([]metrics.Sample, len(descs)),
+		index:   make(map[string]int, len(descs)),
+	}
+	for i, d := range descs {
+		c.samples[i].Name = d.Name
+		c.index[d.Name] = i
+	}
+	return c
+}
+
+// Read samples the metrics with the given names. All supported metrics
+// are sampled if no name is given. The metrics not supported by the running
+// Go runtime are populated with MetricKindBad.
+func (c *Collector) Read(names ...string) Metrics {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(names) == 0 {
+		metrics.Read(c.samples)
+		ms := make(Metrics, len(c.samples))
+		for _, s := range c.samples {
+			ms[s.Name] = newMetric(s.Value)
+		}
+		return ms
+	}
+
+	samples := make([]metrics.Sample, 0, len(names))
+	ms := make(Metrics, len(names))
+	for _, name := range names {
+		if _, ok := c.index[name]; !ok {
+			ms[name] = Metric{Kind: MetricKindBad}
+			continue
+		}
+		samples = append(samples, metrics.Sample{Name: name})
+	}
+	metrics.Read(samples)
+	for _, s := range samples {
+		ms[s.Name] = newMetric(s.Value)
+	}
+	return ms
+}
+
+func newMetric(v metrics.Value) Metric {
+	switch v.Kind() {
+	case metrics.KindUint64:
+		return Metric{Kind: MetricKindUint64, Uint64: v.Uint64()}
+	case metrics.KindFloat64:
+		return Metric{Kind: MetricKindFloat64, Float64: v.Float64()}
+	case metrics.KindFloat64Histogram:
+		h := v.Float64Histogram()
+		buckets := make([]float64, len(h.Buckets))
+		for i, b := range h.Buckets {
+			buckets[i] = finite(b)
+		}
+		return Metric{
+			Kind: MetricKindHistogram,
+			Histogram: &Histogram{
+				// Counts will be overwritten by the next read.
+				Counts:  append([]uint64(nil), h.Counts...),
+				Buckets: buckets,
+			},
+		}
+	default:
+		return Metric{Kind: MetricKindBad}
+	}
+}
+
+// Uint64Value gives back the value of the metric with the given name
+// if its kind is MetricKindUint64, otherwise 0.
+func (ms Metrics) Uint64Value(name string) uint64 {
+	m, ok := ms[name]
+	if !ok || m.Kind != MetricKindUint64 {
+		return 0
+	}
+	return m.Uint64
+}
+
+// Float64Value gives back the value of the metric with the given name
+// if its kind is MetricKindFloat64, otherwise 0.
+func (ms Metrics) Float64Value(name string) float64 {
+	m, ok := ms[name]
+	if !ok || m.Kind != MetricKindFloat64 {
+		return 0
+	}
+	return m.Float64
+}
+
+func finite(f float64) float64 {
+	switch {
+	case math.IsInf(f, 1):
+		return math.MaxFloat64
+	case math.IsInf(f, -1):
+		return -math.MaxFloat64
+	default:
+		return f
+	}
+}
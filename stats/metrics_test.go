@@ -0,0 +1,106 @@
+package stats
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollectorRead(t *testing.T) {
+	c := NewCollector()
+	tests := []struct {
+		name     string
+		names    []string
+		wantKind map[string]MetricKind
+	}{
+		{
+			name:  "uint64 metric",
+			names: []string{"/gc/heap/goal:bytes"},
+			wantKind: map[string]MetricKind{
+				"/gc/heap/goal:bytes": MetricKindUint64,
+			},
+		},
+		{
+			name:  "histogram metric",
+			names: []string{"/gc/heap/allocs-by-size:bytes"},
+			wantKind: map[string]MetricKind{
+				"/gc/heap/allocs-by-size:bytes": MetricKindHistogram,
+			},
+		},
+		{
+			name:  "unknown metric",
+			names: []string{"/unknown:bytes"},
+			wantKind: map[string]MetricKind{
+				"/unknown:bytes": MetricKindBad,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := c.Read(tt.names...)
+			assert.Len(t, got, len(tt.wantKind))
+			for name, kind := range tt.wantKind {
+				assert.Equal(t, kind, got[name].Kind)
+			}
+		})
+	}
+}
+
+func TestCollectorReadAll(t *testing.T) {
+	got := NewCollector().Read()
+	assert.Contains(t, got, "/sched/latencies:seconds")
+	for name, m := range got {
+		if m.Kind != MetricKindHistogram {
+			continue
+		}
+		assert.Equal(t, len(m.Histogram.Counts)+1, len(m.Histogram.Buckets), name)
+		for _, b := range m.Histogram.Buckets {
+			assert.False(t, math.IsInf(b, 0), name)
+		}
+	}
+}
+
+func TestHistogramSub(t *testing.T) {
+	buckets := []float64{0, 1, 2, 3}
+	tests := []struct {
+		name string
+		h    *Histogram
+		prev *Histogram
+		want []uint64
+	}{
+		{
+			name: "no previous sample",
+			h:    &Histogram{Counts: []uint64{1, 2, 3}, Buckets: buckets},
+			prev: nil,
+			want: []uint64{1, 2, 3},
+		},
+		{
+			name: "values observed since previous sample",
+			h:    &Histogram{Counts: []uint64{1, 5, 3}, Buckets: buckets},
+			prev: &Histogram{Counts: []uint64{1, 2, 0}, Buckets: buckets},
+			want: []uint64{0, 3, 3},
+		},
+		{
+			name: "reset metric",
+			h:    &Histogram{Counts: []uint64{1, 2, 3}, Buckets: buckets},
+			prev: &Histogram{Counts: []uint64{5, 5, 5}, Buckets: buckets},
+			want: []uint64{1, 2, 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.h.Sub(tt.prev)
+			assert.Equal(t, tt.want, got.Counts)
+		})
+	}
+}
+
+func TestHistogramRebucket(t *testing.T) {
+	h := &Histogram{
+		Counts:  []uint64{1, 2, 3, 4, 5},
+		Buckets: []float64{-math.MaxFloat64, 0, 0.5, 1, 1.5, math.MaxFloat64},
+	}
+	got := h.rebucket([]float64{0, 1, math.MaxFloat64})
+	assert.Equal(t, []uint64{1 + 2 + 3, 4 + 5}, got.Counts)
+}
@@ -0,0 +1,160 @@
+package stats
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// The framed protocol is negotiated by sending a SignalHandshake frame
+// as the very first bytes of a connection. Agents that don't know the framed
+// protocol close the connection on the unknown signal, in which case the
+// diagnoser falls back to the legacy single-byte protocol.
+//
+// A frame consists of a type, a payload length and the payload:
+//
+//	+--------+--------------------------+---------------------+
+//	| 1 byte | 4 bytes (big-endian)     | length bytes        |
+//	|  type  | length                   | payload             |
+//	+--------+--------------------------+---------------------+
+//
+// The diagnoser sends a frame whose type is a signal, and then the agent
+// replies with a frame of the same type, or a FrameError frame if it
+// couldn't serve the request.
+//
+// Once subscribed with SignalSubscribe, the connection is dedicated to
+// the stream: the agent keeps pushing SignalSubscribe frames, each of which
+// holds a batch of one or more samples, until the connection is closed.
+// Since version 2, the batch is a TimedBatch so that the samples held while
+// the diagnoser falls behind keep when they were taken.
+//
+// SignalTrace is replied with as many FrameTraceData frames as the trace takes,
+// followed by the reply frame, so that the trace isn't bound by MaxFrameSize.
+
+const (
+	// ProtocolVersion is the latest version of the framed protocol.
+	ProtocolVersion = 2
+
+	// FrameError is the type of frames that carry an ErrorReply.
+	FrameError = byte(0xff)
+	// FrameTraceData is the type of frames that carry a chunk of the execution trace.
+	FrameTraceData = byte(0xfe)
+
+	// MaxFrameSize is the maximum size of a frame payload.
+	MaxFrameSize = 16 << 20
+	// MaxCaptureDuration is the longest time the agent profiles the CPU or traces for,
+	// which prevents the connection from being tied up for too long.
+	MaxCaptureDuration = time.Minute
+
+	frameHeaderSize = 5
+)
+
+// Hello is the payload of SignalHandshake frames, which both sides
+// send to each other to negotiate the protocol.
+type Hello struct {
+	// The protocol version. The agent replies with the highest version
+	// supported by both sides.
+	Version int
+	// Signals supported by the sender.
+	Signals []byte
+	// Encodings of stats frames supported by the sender in order of preference.
+	// The agent replies with the one to be used, and EncodingJSON is used
+	// if not given.
+	Encodings []Encoding `json:",omitempty"`
+	// The shared secret to authenticate the diagnoser, which is required
+	// if the agent is configured with a token. It is never sent by the agent.
+	Token string `json:",omitempty"`
+}
+
+// Subscription is the request payload of SignalSubscribe.
+type Subscription struct {
+	// How often the agent samples the stats.
+	Interval time.Duration
+}
+
+// TimedBatch is a batch of samples along with when each of them was taken.
+// It is the response payload of SignalHistory, and the payload of the frames
+// pushed on SignalSubscribe since protocol version 2.
+type TimedBatch struct {
+	// When each sample was taken, from the oldest.
+	Times []time.Time
+	// The samples corresponding to Times, encoded by EncodeBatch
+	// in the negotiated encoding.
+	Batch []byte
+}
+
+// Names of the profiles the agent can capture.
+const (
+	ProfileCPU       = "cpu"
+	ProfileHeap      = "heap"
+	ProfileAllocs    = "allocs"
+	ProfileMutex     = "mutex"
+	ProfileBlock     = "block"
+	ProfileGoroutine = "goroutine"
+)
+
+// ProfileRequest is the request payload of SignalProfile.
+type ProfileRequest struct {
+	// The name of the profile, e.g. ProfileCPU.
+	Name string
+	// How long to profile the CPU for. Ignored by the other profiles,
+	// which are snapshots.
+	Duration time.Duration `json:",omitempty"`
+}
+
+// ErrorCode indicates the kind of an ErrorReply.
+type ErrorCode int
+
+const (
+	// ErrorCodeInternal indicates that the agent failed to serve the request.
+	ErrorCodeInternal ErrorCode = iota + 1
+	// ErrorCodeUnknownSignal indicates that the agent doesn't support the signal.
+	ErrorCodeUnknownSignal
+	// ErrorCodeBadRequest indicates that the request payload is malformed.
+	ErrorCodeBadRequest
+	// ErrorCodeUnsupportedVersion indicates that the protocol versions can't be negotiated.
+	ErrorCodeUnsupportedVersion
+	// ErrorCodeUnauthorized indicates that the diagnoser failed to authenticate.
+	ErrorCodeUnauthorized
+)
+
+// ErrorReply is the payload of FrameError frames.
+type ErrorReply struct {
+	Code    ErrorCode
+	Message string
+}
+
+func (e *ErrorReply) Error() string {
+	return fmt.Sprintf("agent replied with error (code %d): %s", e.Code, e.Message)
+}
+
+// WriteFrame writes a frame with the given type and payload in a single write.
+func WriteFrame(w io.Writer, typ byte, payload []byte) error {
+	if len(payload) > MaxFrameSize {
+		return fmt.Errorf("frame payload too large: %d bytes", len(payload))
+	}
+	b := make([]byte, frameHeaderSize+len(payload))
+	b[0] = typ
+	binary.BigEndian.PutUint32(b[1:frameHeaderSize], uint32(len(payload)))
+	copy(b[frameHeaderSize:], payload)
+	_, err := w.Write(b)
+	return err
+}
+
+// ReadFrame reads a single frame, and gives back its type and payload.
+func ReadFrame(r io.Reader) (byte, []byte, error) {
+	header := make([]byte, frameHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > MaxFrameSize {
+		return 0, nil, fmt.Errorf("frame payload too large: %d bytes", size)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return header[0], payload, nil
+}
@@ -0,0 +1,46 @@
+package stats
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFrame(t *testing.T) {
+	tests := []struct {
+		name    string
+		typ     byte
+		payload []byte
+	}{
+		{
+			name:    "with payload",
+			typ:     SignalMetrics,
+			payload: []byte(`["/gc/heap/goal:bytes"]`),
+		},
+		{
+			name:    "without payload",
+			typ:     SignalStats,
+			payload: []byte{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := new(bytes.Buffer)
+			assert.Nil(t, WriteFrame(b, tt.typ, tt.payload))
+			typ, payload, err := ReadFrame(b)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.typ, typ)
+			assert.Equal(t, tt.payload, payload)
+		})
+	}
+}
+
+func TestReadFrameTooLarge(t *testing.T) {
+	header := make([]byte, frameHeaderSize)
+	header[0] = SignalStats
+	binary.BigEndian.PutUint32(header[1:], MaxFrameSize+1)
+	_, _, err := ReadFrame(bytes.NewReader(header))
+	assert.NotNil(t, err)
+}
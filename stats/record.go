@@ -0,0 +1,85 @@
+package stats
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// A recording is a JSON Lines file, where each line is a Record.
+// The metadata of the process comes first, followed by the samples
+// scraped from it:
+//
+//	{"Time":"2021-01-02T15:04:05.000000001Z","Target":"foo(15788)","Meta":{"PID":15788,...}}
+//	{"Time":"2021-01-02T15:04:06.000000001Z","Target":"foo(15788)","Stats":{"Goroutines":8,...}}
+//	{"Time":"2021-01-02T15:04:07.000000001Z","Target":"foo(15788)"}
+//
+// A record with neither metadata nor stats indicates that the sample was missed.
+// Another metadata record follows when the process restarts.
+// Records of multiple targets are interleaved, told apart by Target.
+
+// Record is an entry of a recording.
+type Record struct {
+	// When the record was taken.
+	Time time.Time
+	// The name of the process the record belongs to.
+	Target string `json:",omitempty"`
+	Meta   *Meta  `json:",omitempty"`
+	Stats  *Stats `json:",omitempty"`
+}
+
+// RecordWriter writes records in the JSON Lines format.
+// It is safe for concurrent use.
+type RecordWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func NewRecordWriter(w io.Writer) *RecordWriter {
+	return &RecordWriter{enc: json.NewEncoder(w)}
+}
+
+// Write writes the given record as a line.
+func (w *RecordWriter) Write(r *Record) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.enc.Encode(r); err != nil {
+		return fmt.Errorf("failed to write record: %w", err)
+	}
+	return nil
+}
+
+// RecordReader reads records written by RecordWriter.
+type RecordReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func NewRecordReader(r io.Reader) *RecordReader {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), MaxFrameSize)
+	return &RecordReader{scanner: s}
+}
+
+// Read gives back the next record. It gives back io.EOF once all records are read.
+func (r *RecordReader) Read() (*Record, error) {
+	for r.scanner.Scan() {
+		r.line++
+		b := r.scanner.Bytes()
+		if len(b) == 0 {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(b, &rec); err != nil {
+			return nil, fmt.Errorf("failed to decode record at line %d: %w", r.line, err)
+		}
+		return &rec, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
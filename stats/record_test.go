@@ -0,0 +1,46 @@
+package stats
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecord(t *testing.T) {
+	now := time.Date(2021, 1, 2, 15, 4, 5, 1, time.UTC)
+	records := []*Record{
+		{Time: now, Target: "foo(1)", Meta: &Meta{PID: 1, Command: "foo"}},
+		{Time: now.Add(time.Second), Target: "foo(1)", Stats: testStats()},
+		{Time: now.Add(2 * time.Second), Target: "foo(1)"},
+	}
+	var buf bytes.Buffer
+	w := NewRecordWriter(&buf)
+	for _, r := range records {
+		assert.Nil(t, w.Write(r))
+	}
+	assert.Equal(t, len(records), strings.Count(buf.String(), "\n"))
+
+	r := NewRecordReader(&buf)
+	for _, want := range records {
+		got, err := r.Read()
+		assert.Nil(t, err)
+		assert.True(t, want.Time.Equal(got.Time))
+		assert.Equal(t, want.Target, got.Target)
+		assert.Equal(t, want.Meta, got.Meta)
+		assert.Equal(t, want.Stats, got.Stats)
+	}
+	_, err := r.Read()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestReadMalformedRecord(t *testing.T) {
+	r := NewRecordReader(strings.NewReader("{\"Time\":\"2021-01-02T15:04:05Z\"}\n\n{broken\n"))
+	_, err := r.Read()
+	assert.Nil(t, err)
+	_, err = r.Read()
+	assert.EqualError(t, err, "failed to decode record at line 3: invalid character 'b' looking for beginning of object key string")
+}
@@ -9,6 +9,41 @@ const (
 	// SignalStats reports Go process stats.
 	SignalStats = byte(0x2)
 
+	// SignalMetrics reports Go runtime metrics by name. The request is
+	// a JSON array of metric names, and an empty array requests all metrics
+	// supported by the agent. In the legacy protocol, the request must follow
+	// the signal byte, terminated by Delimiter.
+	SignalMetrics = byte(0x3)
+
+	// SignalHandshake starts the framed protocol. See protocol.go for details.
+	SignalHandshake = byte(0x4)
+
+	// SignalSubscribe makes the agent push stats on its own ticker
+	// instead of replying to each request. It is available only in
+	// the framed protocol, and the request is a Subscription.
+	SignalSubscribe = byte(0x5)
+
+	// SignalProfile makes the agent capture a profile, and reply with it
+	// in the gzip-compressed protocol buffer format of pprof. It is available
+	// only in the framed protocol, and the request is a ProfileRequest.
+	SignalProfile = byte(0x6)
+
+	// SignalGoroutines reports the stacks of all goroutines grouped by stack,
+	// in the debug=1 text format of the goroutine profile, which can be parsed
+	// by ParseGoroutineDump. It is available only in the framed protocol.
+	SignalGoroutines = byte(0x7)
+
+	// SignalTrace makes the agent capture an execution trace. It is available
+	// only in the framed protocol, and the request is a TraceRequest. The trace
+	// is streamed in FrameTraceData frames while tracing, followed by the
+	// response, which is a TraceReply.
+	SignalTrace = byte(0x8)
+
+	// SignalHistory reports the samples the agent kept before the diagnoser
+	// attached. It is available only in the framed protocol, and the response
+	// is a TimedBatch, which is empty unless the agent is configured to keep it.
+	SignalHistory = byte(0x9)
+
 	// Delimiter indicates to complete the writing.
 	Delimiter = '\n'
 )
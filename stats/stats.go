@@ -1,8 +1,10 @@
 package stats
 
 import (
+	"math"
 	"os"
 	"runtime"
+	"runtime/debug"
 
 	"github.com/shirou/gopsutil/process"
 )
@@ -13,18 +15,172 @@ type Stats struct {
 	Goroutines int
 	// How many percent of the CPU time this process uses
 	CPUUsage float64
+	// Distribution of the time in seconds goroutines have spent in the
+	// scheduler in a runnable state before actually running.
+	// NewStats gives back the cumulative one since the process started,
+	// whereas the agent serves the one observed since the previous sample.
+	SchedLatencies *Histogram
+	// Values of the application-specific metrics keyed by the name.
+	// See Meta.CustomMetrics for their definitions.
+	CustomMetrics map[string]float64 `json:",omitempty"`
+	// Numeric values published via the expvar package keyed by the name.
+	// It is populated only if Meta.Expvar is true.
+	Expvars map[string]float64 `json:",omitempty"`
+	// Ranges of the gauges sampled by the agent at a higher frequency since
+	// the previous sample, including this one, keyed by the names of Gauges.
+	// It is populated only if the agent samples them.
+	Ranges map[string]Range `json:",omitempty"`
 	MemStats
+	GCStats
+}
+
+// Range summarizes the values of a gauge sampled over an interval.
+type Range struct {
+	Min  float64
+	Max  float64
+	Mean float64
+	// The value at the end of the interval.
+	Last float64
+}
+
+// Names of the gauges, which are the names of the fields.
+const (
+	GaugeGoroutines   = "Goroutines"
+	GaugeSys          = "Sys"
+	GaugeHeapAlloc    = "HeapAlloc"
+	GaugeHeapSys      = "HeapSys"
+	GaugeHeapIdle     = "HeapIdle"
+	GaugeHeapInuse    = "HeapInuse"
+	GaugeHeapReleased = "HeapReleased"
+	GaugeHeapObjects  = "HeapObjects"
+	GaugeStackInuse   = "StackInuse"
+	GaugeNextGC       = "NextGC"
+)
+
+// Gauges gives back the values of the fields that can go up and down between
+// samples, keyed by the field name. CPUUsage is excluded because it is
+// the average over the interval, as well as the cumulative counters.
+func (s *Stats) Gauges() map[string]float64 {
+	return map[string]float64{
+		GaugeGoroutines:   float64(s.Goroutines),
+		GaugeSys:          float64(s.Sys),
+		GaugeHeapAlloc:    float64(s.HeapAlloc),
+		GaugeHeapSys:      float64(s.HeapSys),
+		GaugeHeapIdle:     float64(s.HeapIdle),
+		GaugeHeapInuse:    float64(s.HeapInuse),
+		GaugeHeapReleased: float64(s.HeapReleased),
+		GaugeHeapObjects:  float64(s.HeapObjects),
+		GaugeStackInuse:   float64(s.StackInuse),
+		GaugeNextGC:       float64(s.NextGC),
+	}
 }
 
 // MemStats records statistics about the memory allocator.
+// See runtime.MemStats for the details of each field.
 type MemStats struct {
+	// Total bytes of memory obtained from the OS.
+	Sys uint64
+
+	// Bytes of allocated heap objects.
 	HeapAlloc uint64
-	HeapIdle  uint64
+	// Bytes of heap memory obtained from the OS.
+	HeapSys uint64
+	// Bytes in idle (unused) spans.
+	HeapIdle uint64
+	// Bytes in in-use spans.
 	HeapInuse uint64
+	// Bytes of physical memory returned to the OS.
+	HeapReleased uint64
+	// The number of allocated heap objects.
+	HeapObjects uint64
+
+	// Bytes in stack spans.
+	StackInuse uint64
+	// Bytes of allocated mspan structures.
+	MSpanInuse uint64
+	// Bytes of allocated mcache structures.
+	MCacheInuse uint64
+
+	// Cumulative count of heap objects allocated.
+	Mallocs uint64
+	// Cumulative count of heap objects freed.
+	Frees uint64
+	// Cumulative bytes allocated for heap objects.
+	TotalAlloc uint64
+
+	// The target heap size of the next GC cycle.
+	NextGC uint64
+}
+
+// GCStats records statistics about the garbage collector.
+// The target heap size of the next GC cycle is available as MemStats.NextGC.
+type GCStats struct {
+	// The number of completed GC cycles.
+	NumGC uint32
+	// Cumulative nanoseconds in GC stop-the-world pauses.
+	PauseTotalNs uint64
+	// Circular buffer of recent GC stop-the-world pause times in nanoseconds.
+	// The most recent pause is at PauseNs[(NumGC+255)%256].
+	PauseNs [256]uint64
+	// The time the last GC cycle finished, as nanoseconds since the Unix epoch.
+	LastGC uint64
+	// The fraction of this program's available CPU time used by the GC
+	// since the program started.
+	GCCPUFraction float64
+}
+
+// Names of the runtime metrics used to populate Stats.
+const (
+	metricTotal        = "/memory/classes/total:bytes"
+	metricHeapObjects  = "/memory/classes/heap/objects:bytes"
+	metricHeapUnused   = "/memory/classes/heap/unused:bytes"
+	metricHeapFree     = "/memory/classes/heap/free:bytes"
+	metricHeapReleased = "/memory/classes/heap/released:bytes"
+	metricHeapStacks   = "/memory/classes/heap/stacks:bytes"
+	metricMSpanInuse   = "/memory/classes/metadata/mspan/inuse:bytes"
+	metricMCacheInuse  = "/memory/classes/metadata/mcache/inuse:bytes"
+	metricObjects      = "/gc/heap/objects:objects"
+	metricAllocs       = "/gc/heap/allocs:objects"
+	metricFrees        = "/gc/heap/frees:objects"
+	metricTinyAllocs   = "/gc/heap/tiny/allocs:objects"
+	metricAllocBytes   = "/gc/heap/allocs:bytes"
+	metricHeapGoal     = "/gc/heap/goal:bytes"
+	metricGCCPU        = "/cpu/classes/gc/total:cpu-seconds"
+	metricTotalCPU     = "/cpu/classes/total:cpu-seconds"
+	metricSchedLatency = "/sched/latencies:seconds"
+)
+
+// SchedLatencyBuckets are the boundaries of Stats.SchedLatencies in seconds.
+// The fine-grained buckets the runtime provides are merged into them
+// to keep the stats small.
+var SchedLatencyBuckets = []float64{
+	0,
+	1e-6, 2e-6, 5e-6,
+	1e-5, 2e-5, 5e-5,
+	1e-4, 2e-4, 5e-4,
+	1e-3, 2e-3, 5e-3,
+	1e-2, 2e-2, 5e-2,
+	1e-1, 2e-1, 5e-1,
+	1,
+	math.MaxFloat64,
+}
+
+var collector = NewCollector()
+
+// NewSchedLatencies gives back the distribution of the scheduler latencies since
+// the process started, in the buckets of Stats.SchedLatencies. It gives back nil if
+// the running Go runtime doesn't support it.
+func NewSchedLatencies() *Histogram {
+	h := collector.Read(metricSchedLatency)[metricSchedLatency].Histogram
+	if h == nil {
+		return nil
+	}
+	return h.rebucket(SchedLatencyBuckets)
 }
 
 // NewStats gives back a Stats after getting the statistical data
-// at that point in time. Undesirable to call it at high rate.
+// at that point in time. It is built on runtime/metrics rather than
+// runtime.ReadMemStats so that it doesn't stop the world.
 func NewStats() (*Stats, error) {
 	// TODO: Make it singleton if possible.
 	process, err := process.NewProcess(int32(os.Getpid()))
@@ -35,15 +191,96 @@ func NewStats() (*Stats, error) {
 	if c, err := process.CPUPercent(); err == nil {
 		cpuUsage = c
 	}
-	var m runtime.MemStats
-	runtime.ReadMemStats(&m)
+	m := collector.Read(append(memStatsMetrics, metricGCCPU, metricTotalCPU, metricSchedLatency)...)
+	var gcCPUFraction float64
+	if total := m.Float64Value(metricTotalCPU); total > 0 {
+		gcCPUFraction = m.Float64Value(metricGCCPU) / total
+	}
+	var schedLatencies *Histogram
+	if h := m[metricSchedLatency].Histogram; h != nil {
+		schedLatencies = h.rebucket(SchedLatencyBuckets)
+	}
 	return &Stats{
-		Goroutines: runtime.NumGoroutine(),
-		CPUUsage:   cpuUsage,
-		MemStats: MemStats{
-			HeapAlloc: m.HeapAlloc,
-			HeapIdle:  m.HeapIdle,
-			HeapInuse: m.HeapInuse,
-		},
+		Goroutines:     runtime.NumGoroutine(),
+		CPUUsage:       cpuUsage,
+		SchedLatencies: schedLatencies,
+		MemStats:       newMemStats(m),
+		GCStats:        newGCStats(gcCPUFraction),
 	}, nil
 }
+
+// memStatsMetrics are the runtime metrics newMemStats requires.
+var memStatsMetrics = []string{
+	metricTotal,
+	metricHeapObjects,
+	metricHeapUnused,
+	metricHeapFree,
+	metricHeapReleased,
+	metricHeapStacks,
+	metricMSpanInuse,
+	metricMCacheInuse,
+	metricObjects,
+	metricAllocs,
+	metricFrees,
+	metricTinyAllocs,
+	metricAllocBytes,
+	metricHeapGoal,
+}
+
+func newMemStats(m Metrics) MemStats {
+	var (
+		heapInuse = m.Uint64Value(metricHeapObjects) + m.Uint64Value(metricHeapUnused)
+		heapIdle  = m.Uint64Value(metricHeapFree) + m.Uint64Value(metricHeapReleased)
+		// Tiny allocations are counted as both mallocs and frees, as runtime.ReadMemStats does.
+		tinyAllocs = m.Uint64Value(metricTinyAllocs)
+	)
+	return MemStats{
+		Sys:          m.Uint64Value(metricTotal),
+		HeapAlloc:    m.Uint64Value(metricHeapObjects),
+		HeapSys:      heapInuse + heapIdle,
+		HeapIdle:     heapIdle,
+		HeapInuse:    heapInuse,
+		HeapReleased: m.Uint64Value(metricHeapReleased),
+		HeapObjects:  m.Uint64Value(metricObjects),
+		StackInuse:   m.Uint64Value(metricHeapStacks),
+		MSpanInuse:   m.Uint64Value(metricMSpanInuse),
+		MCacheInuse:  m.Uint64Value(metricMCacheInuse),
+		Mallocs:      m.Uint64Value(metricAllocs) + tinyAllocs,
+		Frees:        m.Uint64Value(metricFrees) + tinyAllocs,
+		TotalAlloc:   m.Uint64Value(metricAllocBytes),
+		NextGC:       m.Uint64Value(metricHeapGoal),
+	}
+}
+
+// SampleGauges samples only the values Stats.Gauges gives back,
+// which is cheap enough to be called at a high frequency.
+func SampleGauges() map[string]float64 {
+	s := Stats{
+		Goroutines: runtime.NumGoroutine(),
+		MemStats:   newMemStats(collector.Read(memStatsMetrics...)),
+	}
+	return s.Gauges()
+}
+
+// newGCStats reads the garbage collector statistics via runtime/debug,
+// which doesn't stop the world either.
+func newGCStats(cpuFraction float64) GCStats {
+	var s debug.GCStats
+	debug.ReadGCStats(&s)
+	gc := GCStats{
+		NumGC:         uint32(s.NumGC),
+		PauseTotalNs:  uint64(s.PauseTotal),
+		GCCPUFraction: cpuFraction,
+	}
+	if !s.LastGC.IsZero() {
+		gc.LastGC = uint64(s.LastGC.UnixNano())
+	}
+	// s.Pause holds the recent pauses with the most recent first.
+	for i, p := range s.Pause {
+		if i >= len(gc.PauseNs) {
+			break
+		}
+		gc.PauseNs[(gc.NumGC-uint32(i)+255)%256] = uint64(p)
+	}
+	return gc
+}
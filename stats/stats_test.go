@@ -1,24 +1,42 @@
 package stats
 
 import (
+	"runtime"
+	"runtime/debug"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 )
 
 func TestNewStats(t *testing.T) {
-	tests := []struct {
-		name    string
-		want    *Stats
-		wantErr bool
-	}{
-		// TODO: Add test cases.
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got, err := NewStats()
-			assert.Equal(t, tt.wantErr, err != nil)
-			assert.Equal(t, tt.want, got)
-		})
+	runtime.GC()
+	got, err := NewStats()
+	assert.Nil(t, err)
+	assert.NotZero(t, got.Goroutines)
+	assert.NotZero(t, got.Sys)
+	assert.NotZero(t, got.HeapAlloc)
+	assert.Equal(t, got.HeapSys, got.HeapInuse+got.HeapIdle)
+	assert.NotZero(t, got.NumGC)
+	assert.NotZero(t, got.LastGC)
+
+	var gc debug.GCStats
+	debug.ReadGCStats(&gc)
+	if int64(got.NumGC) == gc.NumGC {
+		assert.Equal(t, uint64(gc.Pause[0]), got.PauseNs[(got.NumGC+255)%256])
 	}
 }
+
+func TestSampleGauges(t *testing.T) {
+	got := SampleGauges()
+	assert.Len(t, got, len((&Stats{}).Gauges()))
+	assert.NotZero(t, got[GaugeGoroutines])
+	assert.NotZero(t, got[GaugeHeapAlloc])
+	assert.Equal(t, got[GaugeHeapSys], got[GaugeHeapInuse]+got[GaugeHeapIdle])
+}
+
+func TestNewSchedLatencies(t *testing.T) {
+	got := NewSchedLatencies()
+	assert.NotNil(t, got)
+	assert.Equal(t, SchedLatencyBuckets, got.Buckets)
+	assert.Len(t, got.Counts, len(SchedLatencyBuckets)-1)
+}
@@ -0,0 +1,43 @@
+package stats
+
+import "time"
+
+// TraceRequest is the request payload of SignalTrace.
+type TraceRequest struct {
+	// How long to trace for.
+	Duration time.Duration
+}
+
+// TraceReply is the response payload of SignalTrace.
+type TraceReply struct {
+	Summary TraceSummary
+	// The execution trace, which can be viewed by "go tool trace".
+	// It isn't a part of the payload but streamed ahead in FrameTraceData frames.
+	Trace []byte `json:"-"`
+}
+
+// TraceSummary outlines what happened while tracing. It is derived from
+// the runtime metrics sampled alongside the trace rather than from the trace
+// itself, hence the durations of the pauses are estimated from the histogram
+// buckets. The values the running Go runtime doesn't support are negative.
+type TraceSummary struct {
+	// How long it was traced for.
+	Duration time.Duration
+	// The number of completed GC cycles.
+	GCCycles uint64
+	// The number of stop-the-world pauses, along with the total and the longest.
+	STWPauses     uint64
+	STWPauseTotal time.Duration
+	STWPauseMax   time.Duration
+	// The number of goroutines created, or negative if the Go runtime doesn't report it.
+	GoroutinesCreated int64
+	// The time goroutines spent in each state, summed over the goroutines,
+	// e.g. two goroutines running for a second make it two seconds.
+	// They are negative if the Go runtime doesn't report the states.
+	Running  time.Duration
+	Runnable time.Duration
+	// Waiting for something, e.g. a channel, a lock or the network.
+	Blocked time.Duration
+	// Running outside of Go, e.g. in a system call or cgo.
+	Syscall time.Duration
+}